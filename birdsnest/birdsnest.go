@@ -6,9 +6,13 @@ SPDX-License-Identifier: Apache-2.0
 package birdsnest
 
 import (
+	"context"
 	"errors"
 	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/atomic"
 
 	"chainmaker.org/chainmaker/pb-go/v2/common"
@@ -33,20 +37,53 @@ type BirdsNestImpl struct {
 	filters []CuckooFilter
 	// BirdsNest Bird's Nest configuration
 	config *common.BirdsNestConfig
-	// Max strategy function
+	// Filter rotation strategy function, executed before every Add
 	strategy Strategy
 	// The cuckoo filter is currently operational for use by the Add method
 	currentIndex int
+	// rotatedAt the time the current filter was opened, used by time based strategies
+	rotatedAt time.Time
 	// rules Bird's Nest rule
 	rules map[common.RuleType]Rule
 	// log Logger wrapper
 	log Logger
-
+	// number the number of the nest in a sharded nest, -1 if not sharded
+	number int
+	// verifier confirms the positive hits, optional
+	verifier ExistenceVerifier
+	// falsePositiveCounter false positives per filter, set with the verifier
+	falsePositiveCounter *prometheus.CounterVec
+	// falsePositiveRate observed false positive rate per filter, set with the verifier
+	falsePositiveRate *prometheus.GaugeVec
+	// exitC closing it stops the goroutines started by Start, like canceling their context
 	exitC chan struct{}
 	// serializeC serialize channel
 	serializeC chan serializeSignal
 	// snapshot Wal implementation
 	snapshot *WalSnapshot
+	// serializeM serializes the snapshot writes
+	serializeM sync.Mutex
+	// hasBase whether a base snapshot exists, deltas are written after it
+	hasBase bool
+	// deltas number of deltas written after the base snapshot
+	deltas int
+	// compactC compaction signal, the base snapshot is rewritten in the background
+	compactC chan struct{}
+	// dirtyM protects dirty and layoutChanged
+	dirtyM sync.Mutex
+	// dirty indexes of the filters changed since the last snapshot
+	dirty map[int]struct{}
+	// layoutChanged the filters moved since the last snapshot
+	layoutChanged bool
+	// lifecycleM protects cancel, doneC and stopped
+	lifecycleM sync.Mutex
+	// cancel stops the goroutines started by Start
+	cancel context.CancelFunc
+	doneC  <-chan struct{}
+	// stopped whether Stop was called
+	stopped bool
+	// wg the goroutines started by Start
+	wg sync.WaitGroup
 }
 
 // NewBirdsNest Create a BirdsNest
@@ -75,11 +112,12 @@ func NewBirdsNestByNumber(config *common.BirdsNestConfig, exitC chan struct{}, s
 		currentIndex: 0,
 		exitC:        exitC,
 		serializeC:   make(chan serializeSignal),
+		compactC:     make(chan struct{}, 1),
+		dirty:        make(map[int]struct{}),
 		log:          logger,
-		// There is currently only one rule
-		rules: map[common.RuleType]Rule{
-			common.RuleType_AbsoluteExpireTime: NewAETRule(config.Rules.AbsoluteExpireTime),
-		},
+		number:       number,
+		// each rule dispatches to the rule of the kind of the key
+		rules:    newKeyTypeRules(config.Rules),
 		snapshot: snapshot,
 		strategy: strategy,
 	}
@@ -131,8 +169,8 @@ func (b *BirdsNestImpl) Add(key Key) error {
 	}
 	for {
 		var add bool
-		// fullStrategy Execute strategy when cuckoo filter is full
-		err := b.fullStrategy()
+		// executeStrategy rotates the filters if the strategy decides so
+		err := b.executeStrategy()
 		if err != nil {
 			return err
 		}
@@ -141,6 +179,7 @@ func (b *BirdsNestImpl) Add(key Key) error {
 			return err
 		}
 		if add {
+			b.markDirty(b.currentIndex)
 			return nil
 		}
 	}
@@ -163,11 +202,8 @@ func (b *BirdsNestImpl) ValidateRule(key Key, rules ...common.RuleType) error {
 	return nil
 }
 
-// fullStrategy Execute strategy when cuckoo filter is full
-func (b *BirdsNestImpl) fullStrategy() error {
-	if !b.filters[b.currentIndex].IsFull() {
-		return nil
-	}
+// executeStrategy Execute strategy before adding a key
+func (b *BirdsNestImpl) executeStrategy() error {
 	err := b.strategy(b)
 	if err != nil {
 		return err
@@ -181,8 +217,9 @@ func (b *BirdsNestImpl) fullStrategy() error {
 // index 2 current index
 // index 3 total cuckoo size
 // index 4 total space occupied by cuckoo
+// index 5 number of cuckoo filters
 func (b *BirdsNestImpl) Info() []uint64 {
-	var infos = make([]uint64, 5)
+	var infos = make([]uint64, 6)
 	infos[0] = b.height
 	infos[1] = uint64(b.config.GetLength()) // cuckoo size
 	infos[2] = uint64(b.currentIndex)       // current index
@@ -191,19 +228,17 @@ func (b *BirdsNestImpl) Info() []uint64 {
 		infos[3] += info[0] // total keys size
 		infos[4] += info[1] // total space
 	}
+	infos[5] = uint64(len(b.filters)) // number of cuckoo filters
 	return infos
 }
 
 // Convert common.KeyType to common.FilterExtensionType
 func statusConvertExtension(kt common.KeyType) common.FilterExtensionType {
-	switch kt {
-	case common.KeyType_KTDefault:
-		return common.FilterExtensionType_FETDefault
-	case common.KeyType_KTTimestampKey:
-		return common.FilterExtensionType_FETTimestamp
-	default:
+	keyType, ok := GetKeyType(kt)
+	if !ok {
 		return -1
 	}
+	return keyType.ExtensionType
 }
 
 // TODO 下一版优化 go Encode
@@ -6,6 +6,7 @@ SPDX-License-Identifier: Apache-2.0
 package birdsnest
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -247,7 +248,7 @@ func TestBirdsNestImpl_SetHeight(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.fields.bn.Start()
+			tt.fields.bn.Start(context.Background())
 			tt.fields.bn.SetHeight(tt.args.height)
 			if tt.fields.bn.GetHeight() != tt.args.height {
 				t.Errorf("SetHeight() got = %v, want %v", tt.fields.bn.GetHeight(), tt.args.height)
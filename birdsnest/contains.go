@@ -26,7 +26,8 @@ func (b *BirdsNestImpl) Contains(key Key, rules ...common.RuleType) (bool, error
 			return false, err
 		}
 		if contains {
-			return true, nil
+			// the filters may return false positives
+			return b.verifyPositive(i, key)
 		}
 	}
 	// Does not exist in any filter
@@ -35,6 +35,7 @@ type CuckooFilterImpl struct {
 	cuckoo    cuckoo.Filter
 	extension FilterExtension
 	config    *common.CuckooConfig
+	stats     *FilterStats
 }
 
 // newCuckooFilters Create multiple CuckooFilter
@@ -95,6 +96,7 @@ func NewCuckooFilter(config *common.CuckooConfig) CuckooFilter {
 			uint(config.TableType)),
 		extension: extension,
 		config:    config,
+		stats:     newFilterStats(),
 	}
 }
 
@@ -119,6 +121,7 @@ func NewCuckooFilterByDecode(filter *common.CuckooFilter) (*CuckooFilterImpl, er
 		cuckoo:    *decode,
 		extension: extension,
 		config:    &config,
+		stats:     newFilterStats(),
 	}, nil
 }
 
@@ -126,6 +129,10 @@ func (c *CuckooFilterImpl) Extension() FilterExtension {
 	return c.extension
 }
 
+func (c *CuckooFilterImpl) Stats() *FilterStats {
+	return c.stats
+}
+
 func (c *CuckooFilterImpl) IsFull() bool {
 	if c.cuckoo.IsFull() {
 		return true
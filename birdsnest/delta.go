@@ -0,0 +1,181 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package birdsnest
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/gogo/protobuf/proto"
+)
+
+const (
+	// maxSnapshotDeltas Number of deltas after which the base snapshot is compacted in the background
+	maxSnapshotDeltas = 16
+	// deltaMagic identifies a delta snapshot
+	deltaMagic = "BNDT"
+	// delta header: magic(4) | height(8) | current index(4) | filter count(4) | changed filter count(4)
+	deltaHeaderSize = 24
+)
+
+var (
+	ErrInvalidSnapshotDelta = errors.New("invalid snapshot delta")
+)
+
+// snapshotDelta the filters changed since the previous snapshot
+type snapshotDelta struct {
+	height       uint64
+	currentIndex uint32
+	// filterCount the number of filters of the nest
+	filterCount uint32
+	// filters changed filter index -> filter
+	filters map[uint32]*common.CuckooFilter
+}
+
+// markDirty Record that the filter at index changed since the last snapshot
+func (b *BirdsNestImpl) markDirty(index int) {
+	b.dirtyM.Lock()
+	defer b.dirtyM.Unlock()
+	if b.dirty == nil {
+		b.dirty = make(map[int]struct{})
+	}
+	b.dirty[index] = struct{}{}
+}
+
+// markLayoutChanged Record that the filters moved, so the next snapshot must be a base snapshot
+func (b *BirdsNestImpl) markLayoutChanged() {
+	b.dirtyM.Lock()
+	defer b.dirtyM.Unlock()
+	b.layoutChanged = true
+}
+
+// takeDirty Take the changes recorded since the last snapshot
+func (b *BirdsNestImpl) takeDirty() (map[int]struct{}, bool) {
+	b.dirtyM.Lock()
+	defer b.dirtyM.Unlock()
+	dirty, layoutChanged := b.dirty, b.layoutChanged
+	b.dirty, b.layoutChanged = make(map[int]struct{}), false
+	return dirty, layoutChanged
+}
+
+// restoreDirty Give back the changes of a snapshot that failed
+func (b *BirdsNestImpl) restoreDirty(dirty map[int]struct{}, layoutChanged bool) {
+	b.dirtyM.Lock()
+	defer b.dirtyM.Unlock()
+	if b.dirty == nil {
+		b.dirty = make(map[int]struct{})
+	}
+	for i := range dirty {
+		b.dirty[i] = struct{}{}
+	}
+	b.layoutChanged = b.layoutChanged || layoutChanged
+}
+
+// newSnapshotDelta Encode the changed filters
+func (b *BirdsNestImpl) newSnapshotDelta(dirty map[int]struct{}) (*snapshotDelta, error) {
+	delta := &snapshotDelta{
+		height:       b.preHeight.Load(),
+		currentIndex: uint32(b.currentIndex),
+		filterCount:  uint32(len(b.filters)),
+		filters:      make(map[uint32]*common.CuckooFilter, len(dirty)),
+	}
+	for i := range dirty {
+		if i >= len(b.filters) {
+			continue
+		}
+		filters, err := analysisCuckooFilters(b.filters[i : i+1])
+		if err != nil {
+			return nil, err
+		}
+		delta.filters[uint32(i)] = filters[0]
+	}
+	return delta, nil
+}
+
+// applySnapshotDelta Replay a delta on the filters read from the base snapshot
+func (b *BirdsNestImpl) applySnapshotDelta(delta *snapshotDelta) error {
+	filters := b.filters
+	if int(delta.filterCount) < len(filters) {
+		filters = filters[:delta.filterCount]
+	}
+	for len(filters) < int(delta.filterCount) {
+		filters = append(filters, NewCuckooFilter(b.config.Cuckoo))
+	}
+	for i, f := range delta.filters {
+		if int(i) >= len(filters) {
+			return ErrInvalidSnapshotDelta
+		}
+		filter, err := NewCuckooFilterByDecode(f)
+		if err != nil {
+			return err
+		}
+		filters[i] = filter
+	}
+	if int(delta.currentIndex) >= len(filters) {
+		return ErrInvalidSnapshotDelta
+	}
+	b.filters = filters
+	b.currentIndex = int(delta.currentIndex)
+	b.height = delta.height
+	return nil
+}
+
+func (d *snapshotDelta) Marshal() ([]byte, error) {
+	data := make([]byte, deltaHeaderSize, deltaHeaderSize+len(d.filters)*8)
+	copy(data, deltaMagic)
+	binary.BigEndian.PutUint64(data[4:12], d.height)
+	binary.BigEndian.PutUint32(data[12:16], d.currentIndex)
+	binary.BigEndian.PutUint32(data[16:20], d.filterCount)
+	binary.BigEndian.PutUint32(data[20:24], uint32(len(d.filters)))
+	var buf [8]byte
+	for i, f := range d.filters {
+		filter, err := proto.Marshal(f)
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(buf[0:4], i)
+		binary.BigEndian.PutUint32(buf[4:8], uint32(len(filter)))
+		data = append(data, buf[:]...)
+		data = append(data, filter...)
+	}
+	return data, nil
+}
+
+// isSnapshotDelta whether the snapshot entry is a delta, the other entries are base snapshots
+func isSnapshotDelta(data []byte) bool {
+	return len(data) >= len(deltaMagic) && string(data[:len(deltaMagic)]) == deltaMagic
+}
+
+func (d *snapshotDelta) Unmarshal(data []byte) error {
+	if len(data) < deltaHeaderSize || string(data[:4]) != deltaMagic {
+		return ErrInvalidSnapshotDelta
+	}
+	d.height = binary.BigEndian.Uint64(data[4:12])
+	d.currentIndex = binary.BigEndian.Uint32(data[12:16])
+	d.filterCount = binary.BigEndian.Uint32(data[16:20])
+	n := binary.BigEndian.Uint32(data[20:24])
+	d.filters = make(map[uint32]*common.CuckooFilter)
+	data = data[deltaHeaderSize:]
+	for j := uint32(0); j < n; j++ {
+		if len(data) < 8 {
+			return ErrInvalidSnapshotDelta
+		}
+		i := binary.BigEndian.Uint32(data[0:4])
+		size := binary.BigEndian.Uint32(data[4:8])
+		data = data[8:]
+		if uint32(len(data)) < size {
+			return ErrInvalidSnapshotDelta
+		}
+		f := new(common.CuckooFilter)
+		if err := proto.Unmarshal(data[:size], f); err != nil {
+			return err
+		}
+		d.filters[i] = f
+		data = data[size:]
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ package birdsnest
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"time"
 
 	"chainmaker.org/chainmaker/pb-go/v2/common"
 	"go.uber.org/atomic"
@@ -17,18 +19,20 @@ var (
 
 	// ErrKeyTimeIsNotInTheFilterRange Not error; Key time is not in the filter range
 	ErrKeyTimeIsNotInTheFilterRange = errors.New("key time is not in the filter range")
+	// ErrFilterExtensionTruncated the serialized filter extension is shorter than its encoding
+	ErrFilterExtensionTruncated = errors.New("filter extension data is truncated")
 )
 
 func ExtensionDeserialize(bytes []byte) (FilterExtension, error) {
+	if len(bytes) < 8 {
+		return nil, ErrFilterExtensionTruncated
+	}
 	extensionType := common.FilterExtensionType(binary.BigEndian.Uint64(bytes[:8]))
-	switch extensionType {
-	case common.FilterExtensionType_FETDefault:
-		return DeserializeDefault(), nil
-	case common.FilterExtensionType_FETTimestamp:
-		return DeserializeTimestamp(bytes)
-	default:
+	kt, ok := getKeyTypeByExtension(extensionType)
+	if !ok {
 		return nil, ErrFilterExtensionNotSupport.Error(extensionType)
 	}
+	return kt.DeserializeExtension(bytes)
 }
 
 type DefaultFilterExtension struct {
@@ -69,6 +73,10 @@ func NewTimestampFilterExtension() FilterExtension {
 	}
 }
 
+// timestampExtensionVersion the version of the encoding of the TimestampFilterExtension, whose range is made of
+// Key.GetNano timestamps. The range of the unversioned encoding was decoded with another byte order.
+const timestampExtensionVersion = 1
+
 func (t *TimestampFilterExtension) Serialize() []byte {
 	var type0 = make([]byte, 8)
 	binary.BigEndian.PutUint64(type0, uint64(common.FilterExtensionType_FETTimestamp))
@@ -79,14 +87,31 @@ func (t *TimestampFilterExtension) Serialize() []byte {
 	var last = make([]byte, 8)
 	binary.BigEndian.PutUint64(last, uint64(t.lastTimestamp.Load()))
 
+	var version = make([]byte, 8)
+	binary.BigEndian.PutUint64(version, timestampExtensionVersion)
+
 	var result []byte
 	result = append(result, type0...)
 	result = append(result, first...)
 	result = append(result, last...)
+	result = append(result, version...)
 	return result
 }
 
+// FirstTimestamp the timestamp of the oldest key stored, 0 if empty
+func (t *TimestampFilterExtension) FirstTimestamp() int64 {
+	return t.firstTimestamp.Load()
+}
+
+// LastTimestamp the timestamp of the newest key stored, 0 if empty
+func (t *TimestampFilterExtension) LastTimestamp() int64 {
+	return t.lastTimestamp.Load()
+}
+
 func (t *TimestampFilterExtension) Validate(key Key, full bool) error {
+	if KeyTypeOf(key) != common.KeyType_KTTimestampKey {
+		return nil
+	}
 	nano := key.GetNano()
 	if full {
 		first := t.firstTimestamp.Load()
@@ -103,16 +128,21 @@ func (t *TimestampFilterExtension) Validate(key Key, full bool) error {
 }
 
 func (t *TimestampFilterExtension) Store(key Key) error {
-	split, err := key.Parse()
+	_, err := key.Parse()
 	if err != nil {
 		return err
 	}
-	nano := int64(binary.LittleEndian.Uint64(split[0]))
-	//timestamp := nano / time.Millisecond.Nanoseconds()
-	if t.firstTimestamp.Load() == 0 {
-		t.firstTimestamp.Store(nano)
+	if KeyTypeOf(key) != common.KeyType_KTTimestampKey {
+		return ErrNotTimestampKey
 	}
-	if nano < t.firstTimestamp.Load() {
+	// same byte order as Key.GetNano, which Validate compares against
+	nano := key.GetNano()
+	first := t.firstTimestamp.Load()
+	if t.lastTimestamp.Load() == 0 {
+		// the first key of the filter
+		t.firstTimestamp.Store(nano)
+	} else if first != 0 && nano < first {
+		// a first timestamp of 0 is an unknown lower bound, which is kept
 		t.firstTimestamp.Store(nano)
 	}
 	if nano > t.lastTimestamp.Load() {
@@ -126,8 +156,20 @@ func DeserializeTimestamp(bytes []byte) (*TimestampFilterExtension, error) {
 		firstTimestamp: atomic.NewInt64(0),
 		lastTimestamp:  atomic.NewInt64(0),
 	}
-	if len(bytes) != 24 {
-		return nil, ErrKeyCannotBeEmpty
+	switch len(bytes) {
+	case 24:
+		// the range of an unversioned extension does not bound the timestamps of its keys. The lower bound is
+		// unknown, and the keys are considered as recent as the load, so that the filter expires a window later.
+		if binary.BigEndian.Uint64(bytes[16:24]) != 0 {
+			t.lastTimestamp.Store(time.Now().UnixNano())
+		}
+		return t, nil
+	case 32:
+		if version := binary.BigEndian.Uint64(bytes[24:32]); version != timestampExtensionVersion {
+			return nil, ErrFilterExtensionNotSupport.Error(fmt.Sprintf("timestamp version %d", version))
+		}
+	default:
+		return nil, ErrFilterExtensionTruncated
 	}
 
 	t.firstTimestamp.Store(int64(binary.BigEndian.Uint64(bytes[8:16])))
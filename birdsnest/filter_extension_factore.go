@@ -29,12 +29,9 @@ func Factory() *factory {
 }
 
 func (cf *factory) New(fet common.FilterExtensionType) (FilterExtension, error) {
-	switch fet {
-	case common.FilterExtensionType_FETDefault:
-		return NewDefaultFilterExtension(), nil
-	case common.FilterExtensionType_FETTimestamp:
-		return NewTimestampFilterExtension(), nil
-	default:
+	kt, ok := getKeyTypeByExtension(fet)
+	if !ok {
 		return nil, ErrFilterExtensionNotSupport.Error(fet)
 	}
+	return kt.NewExtension(), nil
 }
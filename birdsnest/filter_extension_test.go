@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 )
 
@@ -74,6 +75,40 @@ func TestDeserializeTimestamp(t *testing.T) {
 	}
 }
 
+func TestDeserializeTimestamp_Unversioned(t *testing.T) {
+	key, err := ToTimestampKey(GenTimestampKey())
+	require.Nil(t, err)
+	extension := NewTimestampFilterExtension().(*TimestampFilterExtension)
+	require.Nil(t, extension.Store(key))
+	unversioned := extension.Serialize()[:24]
+
+	// the range of an unversioned extension is not trusted, no key is out of it
+	got, err := DeserializeTimestamp(unversioned)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), got.FirstTimestamp())
+	require.True(t, got.LastTimestamp() >= key.GetNano())
+	require.Nil(t, got.Validate(GetTimestampKeyByNano(key.GetNano()-time.Hour.Nanoseconds()), true))
+	older := GetTimestampKeyByNano(key.GetNano() - time.Minute.Nanoseconds())
+	require.Nil(t, got.Store(older))
+	require.Equal(t, int64(0), got.FirstTimestamp())
+
+	// and stays so once serialized again
+	got, err = DeserializeTimestamp(got.Serialize())
+	require.Nil(t, err)
+	require.Equal(t, int64(0), got.FirstTimestamp())
+
+	// an empty unversioned extension stays empty
+	got, err = DeserializeTimestamp(NewTimestampFilterExtension().Serialize()[:24])
+	require.Nil(t, err)
+	require.Equal(t, int64(0), got.LastTimestamp())
+
+	// an unknown version is rejected
+	data := extension.Serialize()
+	data[31] = 2
+	_, err = DeserializeTimestamp(data)
+	require.NotNil(t, err)
+}
+
 // TestFilterExtension_Serialize This test is not implemented see: TestDeserialize
 func TestTimestampFilterExtension_Serialize(t1 *testing.T) {
 }
@@ -5,7 +5,11 @@ SPDX-License-Identifier: Apache-2.0
 */
 package birdsnest
 
-import "chainmaker.org/chainmaker/pb-go/v2/common"
+import (
+	"context"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+)
 
 type Serializer interface {
 	Serialize() error
@@ -25,10 +29,16 @@ type BirdsNest interface {
 	// Contains the key
 	Contains(key Key, rules ...common.RuleType) (bool, error)
 	ValidateRule(key Key, rules ...common.RuleType) error
+	// SetExistenceVerifier Set the verifier confirming the keys the filters contain, see ExistenceVerifier
+	SetExistenceVerifier(verifier ExistenceVerifier)
 	// Info Current cuckoos nest information and status
 	Info() []uint64
 
-	Start()
+	// Start the background serialization, it runs until ctx is done or Stop is called
+	Start(ctx context.Context)
+	// Stop the background serialization, flush a final snapshot and close the snapshot files. ctx bounds the wait
+	// for the in-flight serialization
+	Stop(ctx context.Context) error
 }
 
 type CuckooFilter interface {
@@ -38,6 +48,8 @@ type CuckooFilter interface {
 	Encode() (FilterEncoder, error)
 	Extension() FilterExtension
 	Info() []uint64
+	// Stats the positive hits checked by the ExistenceVerifier
+	Stats() *FilterStats
 }
 
 // FilterExtension filter extension
@@ -8,6 +8,8 @@ package birdsnest
 import (
 	"encoding/hex"
 	"errors"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
 )
 
 var (
@@ -31,6 +33,60 @@ type Key interface {
 	GetNano() int64
 }
 
+// TypedKey A key of a kind registered with RegisterKeyType
+type TypedKey interface {
+	Key
+	// Type The kind of the key
+	Type() common.KeyType
+}
+
+// KeyTypeOf The kind of the key, the keys which are not a TypedKey are timestamp keys
+func KeyTypeOf(key Key) common.KeyType {
+	if typed, ok := key.(TypedKey); ok {
+		return typed.Type()
+	}
+	return common.KeyType_KTTimestampKey
+}
+
+// DefaultKey A key without any structure, e.g. a hash-only txId
+type DefaultKey []byte
+
+// ToDefaultKey Convert the txId to a DefaultKey holding its raw bytes, as the normal keys have always been stored
+func ToDefaultKey(txId string) (DefaultKey, error) {
+	if len(txId) == 0 {
+		return nil, ErrKeyLengthCannotBeZero
+	}
+	return DefaultKey(txId), nil
+}
+
+func (k DefaultKey) Len() int {
+	return len(k)
+}
+
+func (k DefaultKey) Key() []byte {
+	return k
+}
+
+func (k DefaultKey) String() string {
+	return hex.EncodeToString(k)
+}
+
+func (k DefaultKey) Type() common.KeyType {
+	return common.KeyType_KTDefault
+}
+
+// GetNano A DefaultKey carries no timestamp
+func (k DefaultKey) GetNano() int64 {
+	return 0
+}
+
+func (k DefaultKey) Parse() ([][]byte, error) {
+	if len(k) == 0 {
+		return nil, ErrKeyLengthCannotBeZero
+	}
+	return [][]byte{k}, nil
+}
+
 // TimestampKey Converting TxId directly using TimestampKey is not allowed, see ToTimestampKey
 type TimestampKey []byte
 
@@ -39,7 +95,7 @@ func ToTimestampKey(txId string) (TimestampKey, error) {
 	if err != nil {
 		return nil, err
 	}
-	if b[8] != Separator {
+	if len(b) < 32 || b[8] != Separator {
 		return nil, ErrNotTimestampKey
 	}
 	if bytes2nano(b[:8]) < 0 {
@@ -70,6 +126,10 @@ func (k TimestampKey) String() string {
 	return hex.EncodeToString(k)
 }
 
+func (k TimestampKey) Type() common.KeyType {
+	return common.KeyType_KTTimestampKey
+}
+
 func (k TimestampKey) GetNano() int64 {
 	return bytes2nano(k[:8])
 }
@@ -0,0 +1,181 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package birdsnest
+
+import (
+	"sync"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+var (
+	ErrKeyTypeAlreadyRegistered = NewError("key type %v or filter extension type %v already registered")
+	ErrInvalidKeyType           = NewError("key type %v: Parse, NewExtension and DeserializeExtension are required")
+)
+
+// KeyType A kind of key, registered with RegisterKeyType. The filters of a Bird's Nest hold the keys of the kind
+// selected by CuckooConfig.KeyType
+type KeyType struct {
+	// Type the value of CuckooConfig.KeyType selecting this kind, custom kinds use values beyond the common.KeyType
+	// enum
+	Type common.KeyType
+	// ExtensionType the filter extension type written in the snapshots, custom kinds use values beyond the
+	// common.FilterExtensionType enum
+	ExtensionType common.FilterExtensionType
+	// Parse converts a txId to a key of this kind, it returns an error when the txId is not of this kind
+	Parse func(txId string) (Key, error)
+	// NewExtension creates the FilterExtension of an empty filter
+	NewExtension func() FilterExtension
+	// DeserializeExtension decodes a FilterExtension serialized by FilterExtension.Serialize
+	DeserializeExtension func(data []byte) (FilterExtension, error)
+	// NewRule optional, creates the rule of the rule type for the keys of this kind, nil when the rule does not apply
+	NewRule func(ruleType common.RuleType, config *common.RulesConfig) Rule
+}
+
+// keyTypeRegistry the registered key kinds, in registration order
+type keyTypeRegistry struct {
+	sync.RWMutex
+	types      []KeyType
+	byType     map[common.KeyType]KeyType
+	byExtenion map[common.FilterExtensionType]KeyType
+}
+
+var keyTypes = &keyTypeRegistry{
+	byType:     make(map[common.KeyType]KeyType),
+	byExtenion: make(map[common.FilterExtensionType]KeyType),
+}
+
+func init() {
+	_ = RegisterKeyType(KeyType{
+		Type:          common.KeyType_KTDefault,
+		ExtensionType: common.FilterExtensionType_FETDefault,
+		Parse: func(txId string) (Key, error) {
+			return ToDefaultKey(txId)
+		},
+		NewExtension: func() FilterExtension {
+			return NewDefaultFilterExtension()
+		},
+		DeserializeExtension: func([]byte) (FilterExtension, error) {
+			return DeserializeDefault(), nil
+		},
+	})
+	_ = RegisterKeyType(KeyType{
+		Type:          common.KeyType_KTTimestampKey,
+		ExtensionType: common.FilterExtensionType_FETTimestamp,
+		Parse: func(txId string) (Key, error) {
+			return ToTimestampKey(txId)
+		},
+		NewExtension: NewTimestampFilterExtension,
+		DeserializeExtension: func(data []byte) (FilterExtension, error) {
+			return DeserializeTimestamp(data)
+		},
+		NewRule: func(ruleType common.RuleType, config *common.RulesConfig) Rule {
+			if ruleType != common.RuleType_AbsoluteExpireTime {
+				return nil
+			}
+			return NewAETRule(config.GetAbsoluteExpireTime())
+		},
+	})
+}
+
+// RegisterKeyType Register a kind of key, the kinds should be registered before the Bird's Nests are created
+func RegisterKeyType(kt KeyType) error {
+	if kt.Parse == nil || kt.NewExtension == nil || kt.DeserializeExtension == nil {
+		return ErrInvalidKeyType.Error(kt.Type)
+	}
+	keyTypes.Lock()
+	defer keyTypes.Unlock()
+	_, typeExists := keyTypes.byType[kt.Type]
+	_, extensionExists := keyTypes.byExtenion[kt.ExtensionType]
+	if typeExists || extensionExists {
+		return ErrKeyTypeAlreadyRegistered.Error(kt.Type, kt.ExtensionType)
+	}
+	keyTypes.types = append(keyTypes.types, kt)
+	keyTypes.byType[kt.Type] = kt
+	keyTypes.byExtenion[kt.ExtensionType] = kt
+	return nil
+}
+
+// GetKeyType Get a registered kind of key
+func GetKeyType(t common.KeyType) (KeyType, bool) {
+	keyTypes.RLock()
+	defer keyTypes.RUnlock()
+	kt, ok := keyTypes.byType[t]
+	return kt, ok
+}
+
+// getKeyTypeByExtension Get the kind of key of a filter extension type
+func getKeyTypeByExtension(t common.FilterExtensionType) (KeyType, bool) {
+	keyTypes.RLock()
+	defer keyTypes.RUnlock()
+	kt, ok := keyTypes.byExtenion[t]
+	return kt, ok
+}
+
+// ParseKey Convert a txId to a key of the first registered kind (other than the default one) that accepts it, or to
+// a DefaultKey
+func ParseKey(txId string) (Key, error) {
+	keyTypes.RLock()
+	types := keyTypes.types
+	keyTypes.RUnlock()
+	for _, kt := range types {
+		if kt.Type == common.KeyType_KTDefault {
+			continue
+		}
+		key, err := kt.Parse(txId)
+		if err == nil {
+			return key, nil
+		}
+	}
+	return ToDefaultKey(txId)
+}
+
+// ToKeysByType Convert txIds with ParseKey and group the keys by kind
+func ToKeysByType(txIds []string) (map[common.KeyType][]Key, error) {
+	keys := make(map[common.KeyType][]Key)
+	for _, txId := range txIds {
+		key, err := ParseKey(txId)
+		if err != nil {
+			return nil, err
+		}
+		keyType := KeyTypeOf(key)
+		keys[keyType] = append(keys[keyType], key)
+	}
+	return keys, nil
+}
+
+// keyTypeRule Dispatch the validation of a rule type to the rule of the kind of the key, the keys of kinds without
+// a rule pass
+type keyTypeRule map[common.KeyType]Rule
+
+func (r keyTypeRule) Validate(key Key) error {
+	rule, ok := r[KeyTypeOf(key)]
+	if !ok {
+		return nil
+	}
+	return rule.Validate(key)
+}
+
+// newKeyTypeRules Create the rules of the registered key kinds
+func newKeyTypeRules(config *common.RulesConfig) map[common.RuleType]Rule {
+	keyTypes.RLock()
+	defer keyTypes.RUnlock()
+	rules := make(map[common.RuleType]Rule)
+	for value := range common.RuleType_name {
+		ruleType := common.RuleType(value)
+		rule := make(keyTypeRule)
+		for _, kt := range keyTypes.types {
+			if kt.NewRule == nil {
+				continue
+			}
+			if r := kt.NewRule(ruleType, config); r != nil {
+				rule[kt.Type] = r
+			}
+		}
+		rules[ruleType] = rule
+	}
+	return rules
+}
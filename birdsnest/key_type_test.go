@@ -0,0 +1,205 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package birdsnest
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+const (
+	testKTHeight  = common.KeyType(100)
+	testFETHeight = common.FilterExtensionType(100)
+	// testHeightSeparator separates the block height from the hash of a heightKey
+	testHeightSeparator = byte(203)
+)
+
+var errNotHeightKey = errors.New("not height txid")
+
+// heightKey height(8) | separator(1) | hash
+type heightKey []byte
+
+func toHeightKey(txId string) (Key, error) {
+	b, err := hex.DecodeString(txId)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 10 || b[8] != testHeightSeparator {
+		return nil, errNotHeightKey
+	}
+	return heightKey(b), nil
+}
+
+func newHeightKey(height uint64) heightKey {
+	key := make([]byte, 32)
+	binary.BigEndian.PutUint64(key, height)
+	key[8] = testHeightSeparator
+	copy(key[9:], GetTimestampKey().Key()[9:])
+	return key
+}
+
+func (k heightKey) Parse() ([][]byte, error) { return [][]byte{k[:8], k[9:]}, nil }
+func (k heightKey) Key() []byte              { return k }
+func (k heightKey) Len() int                 { return len(k) }
+func (k heightKey) String() string           { return hex.EncodeToString(k) }
+func (k heightKey) GetNano() int64           { return 0 }
+func (k heightKey) Type() common.KeyType     { return testKTHeight }
+func (k heightKey) height() uint64           { return binary.BigEndian.Uint64(k[:8]) }
+
+// heightFilterExtension records the highest block height stored
+type heightFilterExtension struct {
+	height uint64
+}
+
+func (e *heightFilterExtension) Validate(Key, bool) error { return nil }
+
+func (e *heightFilterExtension) Store(key Key) error {
+	k, ok := key.(heightKey)
+	if !ok {
+		return errNotHeightKey
+	}
+	if k.height() > e.height {
+		e.height = k.height()
+	}
+	return nil
+}
+
+func (e *heightFilterExtension) Serialize() []byte {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data, uint64(testFETHeight))
+	binary.BigEndian.PutUint64(data[8:], e.height)
+	return data
+}
+
+// maxHeightRule rejects the keys above a block height
+type maxHeightRule uint64
+
+func (r maxHeightRule) Validate(key Key) error {
+	if key.(heightKey).height() > uint64(r) {
+		return errNotHeightKey
+	}
+	return nil
+}
+
+func init() {
+	err := RegisterKeyType(KeyType{
+		Type:          testKTHeight,
+		ExtensionType: testFETHeight,
+		Parse:         toHeightKey,
+		NewExtension: func() FilterExtension {
+			return &heightFilterExtension{}
+		},
+		DeserializeExtension: func(data []byte) (FilterExtension, error) {
+			return &heightFilterExtension{height: binary.BigEndian.Uint64(data[8:16])}, nil
+		},
+		NewRule: func(ruleType common.RuleType, config *common.RulesConfig) Rule {
+			if ruleType != common.RuleType_AbsoluteExpireTime {
+				return nil
+			}
+			return maxHeightRule(config.GetAbsoluteExpireTime())
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterKeyType(t *testing.T) {
+	err := RegisterKeyType(KeyType{Type: common.KeyType_KTTimestampKey})
+	require.NotNil(t, err)
+	err = RegisterKeyType(KeyType{
+		Type:                 common.KeyType_KTTimestampKey,
+		ExtensionType:        common.FilterExtensionType(101),
+		Parse:                toHeightKey,
+		NewExtension:         func() FilterExtension { return &heightFilterExtension{} },
+		DeserializeExtension: func([]byte) (FilterExtension, error) { return &heightFilterExtension{}, nil },
+	})
+	require.NotNil(t, err)
+
+	key, err := ParseKey(newHeightKey(1).String())
+	require.Nil(t, err)
+	require.Equal(t, testKTHeight, KeyTypeOf(key))
+	key, err = ParseKey(GenTimestampKey())
+	require.Nil(t, err)
+	require.Equal(t, common.KeyType_KTTimestampKey, KeyTypeOf(key))
+	key, err = ParseKey(hex.EncodeToString([]byte("hash only")))
+	require.Nil(t, err)
+	require.Equal(t, common.KeyType_KTDefault, KeyTypeOf(key))
+}
+
+func TestParseKey_DefaultKey(t *testing.T) {
+	// hex and non-hex txIds are converted the same way by both paths
+	txIds := []string{hex.EncodeToString([]byte("hash only")), "not hex txId", "abcd"}
+	_, normalKeys := ToTimestampKeysAndNormalKeys(append(txIds, ""))
+	require.Equal(t, len(txIds), len(normalKeys))
+	keys, err := ToKeysByType(txIds)
+	require.Nil(t, err)
+	require.Equal(t, normalKeys, keys[common.KeyType_KTDefault])
+	require.Equal(t, []byte(txIds[0]), normalKeys[0].Key())
+	require.Equal(t, []byte("not hex txId"), normalKeys[1].Key())
+
+	_, err = ParseKey("")
+	require.Equal(t, ErrKeyLengthCannotBeZero, err)
+}
+
+func TestExtensionDeserialize_Truncated(t *testing.T) {
+	_, err := ExtensionDeserialize([]byte{0, 0, 0})
+	require.Equal(t, ErrFilterExtensionTruncated, err)
+	_, err = ExtensionDeserialize(NewTimestampFilterExtension().Serialize()[:20])
+	require.Equal(t, ErrFilterExtensionTruncated, err)
+}
+
+func TestBirdsNestImpl_CustomKeyType(t *testing.T) {
+	config := &common.BirdsNestConfig{
+		ChainId: "chain1",
+		Length:  2,
+		Rules: &common.RulesConfig{
+			AbsoluteExpireTime: 100,
+		},
+		Cuckoo: &common.CuckooConfig{
+			KeyType:       testKTHeight,
+			TagsPerBucket: 4,
+			BitsPerItem:   9,
+			MaxNumKeys:    10,
+			TableType:     1,
+		},
+		Snapshot: &common.SnapshotSerializerConfig{
+			Type:        common.SerializeIntervalType_Timed,
+			Timed:       &common.TimedSerializeIntervalConfig{Interval: 5},
+			BlockHeight: &common.BlockHeightSerializeIntervalConfig{Interval: 5},
+			Path:        TestDir + "CustomKeyType",
+		},
+	}
+	bn, err := NewBirdsNest(config, make(chan struct{}), LruStrategy, TestLogger{t})
+	require.Nil(t, err)
+	_, ok := bn.filters[0].Extension().(*heightFilterExtension)
+	require.True(t, ok)
+
+	key := newHeightKey(10)
+	require.Nil(t, bn.Add(key))
+	contains, err := bn.Contains(key, common.RuleType_AbsoluteExpireTime)
+	require.Nil(t, err)
+	require.True(t, contains)
+	require.Equal(t, uint64(10), bn.filters[0].Extension().(*heightFilterExtension).height)
+
+	// the rule dispatches per key type
+	require.NotNil(t, bn.ValidateRule(newHeightKey(101), common.RuleType_AbsoluteExpireTime))
+	require.Nil(t, bn.ValidateRule(GetTimestampKey(), common.RuleType_AbsoluteExpireTime))
+	require.NotNil(t, bn.ValidateRule(GetTimestampKeyByNano(1), common.RuleType_AbsoluteExpireTime))
+	require.Nil(t, bn.ValidateRule(DefaultKey("hash only"), common.RuleType_AbsoluteExpireTime))
+
+	// the extension is restored through the registry
+	require.Nil(t, bn.Serialize())
+	bn2, err := NewBirdsNest(config, make(chan struct{}), LruStrategy, TestLogger{t})
+	require.Nil(t, err)
+	require.Equal(t, uint64(10), bn2.filters[0].Extension().(*heightFilterExtension).height)
+}
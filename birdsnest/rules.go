@@ -7,6 +7,8 @@ package birdsnest
 
 import (
 	"time"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
 )
 
 type Rule interface {
@@ -21,7 +23,11 @@ type AbsoluteExpireTimeRule struct {
 	absoluteExpireTime int64
 }
 
+// Validate the keys without a timestamp are not restricted by the rule
 func (r AbsoluteExpireTimeRule) Validate(key Key) error {
+	if KeyTypeOf(key) != common.KeyType_KTTimestampKey {
+		return nil
+	}
 	nano := key.GetNano()
 	seconds := time.Now().UnixNano()
 	start := seconds - r.absoluteExpireTime
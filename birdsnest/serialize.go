@@ -6,6 +6,8 @@ SPDX-License-Identifier: Apache-2.0
 package birdsnest
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"chainmaker.org/chainmaker/pb-go/v2/common"
@@ -14,16 +16,86 @@ import (
 
 // TODO Split BirdsNestImpl and Serialize
 
-// Start TODO Goroutinue should be turned off using context.Context here
-func (b *BirdsNestImpl) Start() {
-	go b.serializeMonitor()
-	go b.serializeTimed()
+// Start the serialization goroutines, they run until ctx is done, exitC is closed or Stop is called
+func (b *BirdsNestImpl) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	b.lifecycleM.Lock()
+	defer b.lifecycleM.Unlock()
+	if b.cancel != nil || b.stopped {
+		cancel()
+		return
+	}
+	b.cancel = cancel
+	b.doneC = ctx.Done()
+	b.wg.Add(3)
+	go b.serializeMonitor(ctx)
+	go b.serializeTimed(ctx)
+	go b.compactMonitor(ctx)
+	if b.exitC != nil {
+		go func() {
+			select {
+			case <-b.exitC:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+}
+
+// Stop the serialization goroutines, waits for the in-flight serialization, flushes a final snapshot and closes the
+// snapshot wal. ctx bounds the wait for the in-flight serialization.
+func (b *BirdsNestImpl) Stop(ctx context.Context) error {
+	b.lifecycleM.Lock()
+	defer b.lifecycleM.Unlock()
+	if b.stopped {
+		return nil
+	}
+	if b.cancel != nil {
+		b.cancel()
+		if err := waitGroupContext(ctx, &b.wg); err != nil {
+			return err
+		}
+	}
+	b.stopped = true
+	if b.doneC == nil {
+		// never started, signals are dropped from now on
+		doneC := make(chan struct{})
+		close(doneC)
+		b.doneC = doneC
+	}
+	err := b.Serialize()
+	if err != nil {
+		b.log.Errorf("bird's nest final serialize error: %v", err)
+	}
+	closeErr := b.snapshot.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// waitGroupContext Wait for the wait group until ctx is done
+func waitGroupContext(ctx context.Context, wg *sync.WaitGroup) error {
+	doneC := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(doneC)
+	}()
+	select {
+	case <-doneC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // serializeMonitor
-func (b *BirdsNestImpl) serializeMonitor() {
-	for { // nolint
+func (b *BirdsNestImpl) serializeMonitor(ctx context.Context) {
+	defer b.wg.Done()
+	for {
 		select {
+		case <-ctx.Done():
+			return
 		// Only signals for the current filter "serialized type" are received
 		case signal := <-b.serializeC:
 			t, ok := common.SerializeIntervalType_name[int32(signal.typ)]
@@ -51,13 +123,52 @@ func (b *BirdsNestImpl) serializeMonitor() {
 	}
 }
 
-// Serialize all cuckoos in the current BirdsNest
+// Serialize the changes since the last snapshot as a delta. A full base snapshot is written instead when there is no
+// base yet or the filters moved
 func (b *BirdsNestImpl) Serialize() error {
+	b.serializeM.Lock()
+	defer b.serializeM.Unlock()
 	t := time.Now()
-	defer func(log Logger) {
-		elapsed := time.Since(t)
-		log.Debugf("bird's nest serialize success elapsed: %v", elapsed)
-	}(b.log)
+	dirty, layoutChanged := b.takeDirty()
+	if layoutChanged || !b.hasBase {
+		err := b.serializeBase()
+		if err != nil {
+			b.restoreDirty(dirty, layoutChanged)
+			return err
+		}
+		b.log.Debugf("bird's nest base serialize success elapsed: %v", time.Since(t))
+		return nil
+	}
+	if len(dirty) == 0 && b.preHeight.Load() == b.height {
+		return nil
+	}
+	delta, err := b.newSnapshotDelta(dirty)
+	if err == nil {
+		var data []byte
+		data, err = delta.Marshal()
+		if err == nil {
+			err = b.snapshot.WriteDelta(data)
+		}
+	}
+	if err != nil {
+		b.restoreDirty(dirty, false)
+		return err
+	}
+	b.preHeight.Store(b.height)
+	b.deltas++
+	if b.deltas >= maxSnapshotDeltas {
+		// compact in the background, a pending compaction is enough
+		select {
+		case b.compactC <- struct{}{}:
+		default:
+		}
+	}
+	b.log.Debugf("bird's nest delta serialize success filters: %v elapsed: %v", len(delta.filters), time.Since(t))
+	return nil
+}
+
+// serializeBase Serialize all cuckoos in the current BirdsNest, serializeM must be held
+func (b *BirdsNestImpl) serializeBase() error {
 	// convert []CuckooFilter to []*common.CuckooFilter
 	var filters []*common.CuckooFilter
 	filters, err := analysisCuckooFilters(b.filters)
@@ -79,11 +190,44 @@ func (b *BirdsNestImpl) Serialize() error {
 		return err
 	}
 	b.preHeight.Store(b.height)
+	b.hasBase = true
+	b.deltas = 0
 	return nil
 }
 
+// compactMonitor Write a new base snapshot once too many deltas were written
+func (b *BirdsNestImpl) compactMonitor(ctx context.Context) {
+	defer b.wg.Done()
+	for {
+		select {
+		case <-b.compactC:
+			if err := b.compact(); err != nil {
+				b.log.Errorf("bird's nest snapshot compact error: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// compact Replace the base snapshot and its deltas by a new base snapshot
+func (b *BirdsNestImpl) compact() error {
+	b.serializeM.Lock()
+	defer b.serializeM.Unlock()
+	t := time.Now()
+	dirty, layoutChanged := b.takeDirty()
+	err := b.serializeBase()
+	if err != nil {
+		b.restoreDirty(dirty, layoutChanged)
+		return err
+	}
+	b.log.Debugf("bird's nest snapshot compact success elapsed: %v", time.Since(t))
+	return nil
+}
+
+// Deserialize Read the base snapshot and replay its deltas
 func (b *BirdsNestImpl) Deserialize() error {
-	data, err := b.snapshot.Read()
+	data, deltas, err := b.snapshot.ReadIncremental()
 	if err != nil {
 		return err
 	}
@@ -99,40 +243,72 @@ func (b *BirdsNestImpl) Deserialize() error {
 	if err != nil {
 		return err
 	}
+	var configErr error
 	if !proto.Equal(bn.Config, b.config) {
-		err = ErrCannotModifyTheNestConfiguration
+		configErr = ErrCannotModifyTheNestConfiguration
 	}
 	b.filters = filters
 	b.config = bn.Config
 	b.height = bn.Height
 	b.currentIndex = int(bn.CurrentIndex)
-	return err
+	for _, data := range deltas {
+		delta := new(snapshotDelta)
+		err = delta.Unmarshal(data)
+		if err != nil {
+			return err
+		}
+		err = b.applySnapshotDelta(delta)
+		if err != nil {
+			return err
+		}
+	}
+	b.hasBase = true
+	b.deltas = len(deltas)
+	return configErr
 }
 
-func (b *BirdsNestImpl) serializeTimed() {
+func (b *BirdsNestImpl) serializeTimed(ctx context.Context) {
+	defer b.wg.Done()
 	if b.config.Snapshot.Type != common.SerializeIntervalType_Timed {
 		return
 	}
 	ticker := time.NewTicker(time.Second * time.Duration(b.config.Snapshot.Timed.Interval))
-	// nolint
+	defer ticker.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
-			b.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Timed}
+			select {
+			case b.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Timed}:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
 }
 
 // nolint
 func (b *BirdsNestImpl) serializeExit() {
-	b.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Exit}
+	b.sendSerializeSignal(serializeSignal{typ: common.SerializeIntervalType_Exit})
 }
 
 func (b *BirdsNestImpl) serializeHeight(height uint64) {
 	if b.config.Snapshot.Type != common.SerializeIntervalType_Height {
 		return
 	}
-	b.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Height, height: height}
+	b.sendSerializeSignal(serializeSignal{typ: common.SerializeIntervalType_Height, height: height})
+}
+
+// sendSerializeSignal Send the signal to serializeMonitor, dropped once the nest is stopped
+func (b *BirdsNestImpl) sendSerializeSignal(signal serializeSignal) {
+	b.lifecycleM.Lock()
+	doneC := b.doneC
+	b.lifecycleM.Unlock()
+	select {
+	case b.serializeC <- signal:
+	case <-doneC:
+	}
 }
 
 // Serialize signal
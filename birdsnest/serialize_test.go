@@ -6,9 +6,18 @@ SPDX-License-Identifier: Apache-2.0
 package birdsnest
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TODO 偶尔报错
@@ -50,6 +59,51 @@ func TestBirdsNestImpl_Deserialize(t *testing.T) {
 	}
 }
 
+// TestBirdsNestImpl_DeserializeBaseline the snapshot of testdata/baseline was written by the first release, with
+// the hash-only txIds stored as raw bytes
+func TestBirdsNestImpl_DeserializeBaseline(t *testing.T) {
+	dir := TestDir + "_baseline"
+	require.Nil(t, os.RemoveAll(dir))
+	segment := filepath.Join("chain1", Filepath, "00000000000000000001")
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "baseline", segment))
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, segment)), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, segment), data, 0644))
+
+	config := &common.BirdsNestConfig{
+		ChainId: "chain1",
+		Length:  2,
+		Rules:   &common.RulesConfig{AbsoluteExpireTime: 10000},
+		Cuckoo: &common.CuckooConfig{
+			KeyType:       common.KeyType_KTDefault,
+			TagsPerBucket: 2,
+			BitsPerItem:   11,
+			MaxNumKeys:    16,
+			TableType:     0,
+		},
+		Snapshot: &common.SnapshotSerializerConfig{
+			Type:        common.SerializeIntervalType_Timed,
+			Timed:       &common.TimedSerializeIntervalConfig{Interval: 20},
+			BlockHeight: &common.BlockHeightSerializeIntervalConfig{Interval: 20},
+			Path:        dir,
+		},
+	}
+	bn, err := NewBirdsNest(config, make(chan struct{}), LruStrategy, TestLogger{t})
+	require.Nil(t, err)
+	var txIds []string
+	for i := 0; i < 8; i++ {
+		txIds = append(txIds, fmt.Sprintf("%064x", i*7919+1))
+	}
+	keys, err := ToKeysByType(txIds)
+	require.Nil(t, err)
+	for _, key := range keys[common.KeyType_KTDefault] {
+		contains, err := bn.Contains(key)
+		require.Nil(t, err)
+		require.True(t, contains, "key %v", key)
+	}
+	require.Nil(t, bn.Stop(context.Background()))
+}
+
 func TestBirdsNestImpl_Start(t *testing.T) {
 }
 
@@ -67,3 +121,101 @@ func TestBirdsNestImpl_serializeTimed(t *testing.T) {
 
 func TestBirdsNestImpl_timedAndExitSerialize(t *testing.T) {
 }
+
+func TestBirdsNestImpl_SerializeDelta(t *testing.T) {
+	path := TestDir + "SerializeDelta"
+	assert.Nil(t, os.RemoveAll(path))
+	bn := getTBN(path, t)
+	keys := GetTimestampKeys(15)
+	assert.Nil(t, bn.AddsAndSetHeight(keys[:5], 1))
+	// the first snapshot is a base snapshot
+	assert.Nil(t, bn.Serialize())
+	assert.Nil(t, bn.AddsAndSetHeight(keys[5:], 2))
+	assert.Nil(t, bn.Serialize())
+	base, deltas, err := bn.snapshot.ReadIncremental()
+	assert.Nil(t, err)
+	assert.NotNil(t, base)
+	assert.Equal(t, 1, len(deltas))
+	delta := new(snapshotDelta)
+	assert.Nil(t, delta.Unmarshal(deltas[0]))
+	// only the filters changed by the second Adds
+	assert.Equal(t, 2, len(delta.filters))
+
+	// base plus deltas are replayed
+	restored := getTBN(path, t)
+	assert.Equal(t, bn.currentIndex, restored.currentIndex)
+	assert.Equal(t, 1, restored.deltas)
+	for _, key := range keys {
+		contains, err := restored.Contains(key)
+		assert.Nil(t, err)
+		assert.True(t, contains)
+	}
+
+	// compaction writes a new base snapshot
+	assert.Nil(t, bn.compact())
+	_, deltas, err = bn.snapshot.ReadIncremental()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deltas))
+}
+
+func TestBirdsNestImpl_DeserializeUncheckpointedBase(t *testing.T) {
+	path := TestDir + "UncheckpointedBase"
+	assert.Nil(t, os.RemoveAll(path))
+	bn := getTBN(path, t)
+	keys := GetTimestampKeys(15)
+	assert.Nil(t, bn.AddsAndSetHeight(keys[:5], 1))
+	assert.Nil(t, bn.Serialize())
+	assert.Nil(t, bn.AddsAndSetHeight(keys[5:10], 2))
+	assert.Nil(t, bn.Serialize())
+
+	// a crash between the write of a base snapshot and the save of its checkpoint
+	assert.Nil(t, bn.AddsAndSetHeight(keys[10:], 3))
+	filters, err := analysisCuckooFilters(bn.filters)
+	assert.Nil(t, err)
+	data, err := proto.Marshal(&common.BirdsNest{
+		Config:       bn.config,
+		Height:       bn.height,
+		CurrentIndex: uint32(bn.currentIndex),
+		Filters:      filters,
+	})
+	assert.Nil(t, err)
+	last, err := bn.snapshot.wal.LastIndex()
+	assert.Nil(t, err)
+	assert.Nil(t, bn.snapshot.wal.Write(last+1, data))
+	assert.Nil(t, bn.snapshot.Close())
+
+	restored := getTBN(path, t)
+	assert.Equal(t, uint64(3), restored.height)
+	assert.Equal(t, 0, restored.deltas)
+	for _, key := range keys {
+		contains, err := restored.Contains(key)
+		assert.Nil(t, err)
+		assert.True(t, contains)
+	}
+}
+
+func TestBirdsNestImpl_Stop(t *testing.T) {
+	path := TestDir + "Stop"
+	assert.Nil(t, os.RemoveAll(path))
+	bn := getTBN(path, t)
+	bn.Start(context.Background())
+	keys := GetTimestampKeys(15)
+	assert.Nil(t, bn.AddsAndSetHeight(keys, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, bn.Stop(ctx))
+	// stopping twice is a no-op
+	assert.Nil(t, bn.Stop(ctx))
+	// the snapshot wal is closed
+	assert.NotNil(t, bn.snapshot.Write([]byte("closed")))
+
+	// the final snapshot is restored
+	restored := getTBN(path, t)
+	defer func() { _ = restored.Stop(ctx) }()
+	for _, key := range keys {
+		contains, err := restored.Contains(key)
+		assert.Nil(t, err)
+		assert.True(t, contains)
+	}
+}
@@ -21,8 +21,11 @@ type WalSnapshot struct {
 
 // eg: data/tx_filter/chainN/birdsnestN
 func NewWalSnapshot(path, name string, number int) (*WalSnapshot, error) {
-	opts := wal.DefaultOptions
+	opts := *wal.DefaultOptions
 	opts.NoSync = false
+	// the segments holding only older snapshots are truncated by the wal, the superseded snapshots sharing
+	// a segment with the latest one stay on disk until that segment is truncated, up to a segment size
+	opts.CheckpointRetention = 1
 	if number > 0 {
 		// eg: data/txfilter/chainN/birdnest1
 		path = filepath.Join(path, name+strconv.Itoa(number))
@@ -34,7 +37,7 @@ func NewWalSnapshot(path, name string, number int) (*WalSnapshot, error) {
 	if err != nil {
 		return nil, err
 	}
-	file, err := wal.Open(path, opts)
+	file, err := wal.Open(path, &opts)
 	if err != nil {
 		return nil, err
 	}
@@ -63,8 +66,45 @@ func (s *WalSnapshot) Read() ([]byte, error) {
 	return read, nil
 }
 
-// TODO Filter 单独持久化 优化 下一版优化
-// Write safe
+// ReadIncremental safe, returns the latest base snapshot and the deltas written after it. A base snapshot written
+// after the checkpoint, whose checkpoint was not saved before a crash, replaces the previous one
+func (s *WalSnapshot) ReadIncremental() (base []byte, deltas [][]byte, err error) {
+	s.snapshotM.Lock()
+	defer s.snapshotM.Unlock()
+	last, err := s.wal.LastIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	if last == 0 {
+		return nil, nil, nil
+	}
+	index, _, err := s.wal.LoadCheckpoint()
+	if err == wal.ErrNotFound {
+		// written before checkpoints, only the latest snapshot was kept
+		index, err = s.wal.FirstIndex()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	base, err = s.wal.Read(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := index + 1; i <= last; i++ {
+		data, err := s.wal.Read(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !isSnapshotDelta(data) {
+			base, deltas = data, nil
+			continue
+		}
+		deltas = append(deltas, data)
+	}
+	return base, deltas, nil
+}
+
+// Write safe, writes a base snapshot, the older snapshots and deltas are truncated in the background
 func (s *WalSnapshot) Write(data []byte) error {
 	s.snapshotM.Lock()
 	defer s.snapshotM.Unlock()
@@ -77,11 +117,25 @@ func (s *WalSnapshot) Write(data []byte) error {
 	if err != nil {
 		return err
 	}
-	err = s.wal.TruncateFront(index)
+	return s.wal.SaveCheckpoint(index, nil)
+}
+
+// Close safe, closes the wal
+func (s *WalSnapshot) Close() error {
+	s.snapshotM.Lock()
+	defer s.snapshotM.Unlock()
+	return s.wal.Close()
+}
+
+// WriteDelta safe, appends a delta to the latest base snapshot
+func (s *WalSnapshot) WriteDelta(data []byte) error {
+	s.snapshotM.Lock()
+	defer s.snapshotM.Unlock()
+	index, err := s.wal.LastIndex()
 	if err != nil {
 		return err
 	}
-	return nil
+	return s.wal.Write(index+1, data)
 }
 
 func createDirIfNotExist(path string) error {
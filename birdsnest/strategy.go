@@ -5,17 +5,80 @@ SPDX-License-Identifier: Apache-2.0
 */
 package birdsnest
 
+import (
+	"time"
+)
+
+// Strategy Nest filter rotation strategy, executed before every Add. It rotates the filters when it decides so and
+// must open a new filter when the current one is full.
 type Strategy func(bn *BirdsNestImpl) error
 
-// LruStrategy Nest filter cycle elimination strategy
+// LruStrategy Nest filter cycle elimination strategy, rotates when the current filter is full
 func LruStrategy(bn *BirdsNestImpl) error {
+	if !bn.filters[bn.currentIndex].IsFull() {
+		return nil
+	}
 	i := seeNextIndex(bn.currentIndex, int(bn.config.GetLength()+1))
 	bn.filters[i] = NewCuckooFilter(bn.config.Cuckoo)
+	bn.markDirty(i)
 	bn.log.Debugf("filter %v is full, filter %v eliminate success", bn.currentIndex, i)
 	bn.currentIndex = i
 	return nil
 }
 
+// SlidingWindowStrategy Nest filter rotation by time, a new filter is opened every interval (or earlier when the
+// current filter is full) and the filters whose keys are all older than the AbsoluteExpireTime rule window are
+// dropped. The memory is therefore bounded by the replay-protection window. Only filters with a
+// TimestampFilterExtension expire and nothing expires when the window is 0, so at most BirdsNestConfig.Length+1
+// filters are kept, the oldest being dropped first.
+func SlidingWindowStrategy(interval time.Duration) Strategy {
+	return func(bn *BirdsNestImpl) error {
+		now := time.Now()
+		if bn.rotatedAt.IsZero() {
+			// the current filter is kept after a restart
+			bn.rotatedAt = now
+		}
+		full := bn.filters[bn.currentIndex].IsFull()
+		if !full && now.Sub(bn.rotatedAt) < interval {
+			return nil
+		}
+		window := bn.config.GetRules().GetAbsoluteExpireTime() * time.Second.Nanoseconds()
+		expire := now.UnixNano() - window
+		filters := make([]CuckooFilter, 0, len(bn.filters)+1)
+		for _, filter := range bn.filters {
+			if window > 0 && isExpiredFilter(filter, expire) {
+				continue
+			}
+			filters = append(filters, filter)
+		}
+		if max := int(bn.config.GetLength()) + 1; len(filters) >= max {
+			filters = filters[len(filters)-max+1:]
+		}
+		filters = append(filters, NewCuckooFilter(bn.config.Cuckoo))
+		dropped := len(bn.filters) + 1 - len(filters)
+		bn.log.Debugf("filter %v rotated (full: %v), %v expired filters dropped", bn.currentIndex, full, dropped)
+		bn.filters = filters
+		bn.currentIndex = len(filters) - 1
+		bn.rotatedAt = now
+		if dropped > 0 {
+			// the filters moved, the next snapshot is a base snapshot
+			bn.markLayoutChanged()
+		} else {
+			bn.markDirty(bn.currentIndex)
+		}
+		return nil
+	}
+}
+
+// isExpiredFilter whether all keys of the filter are older than expire, empty filters are expired as well
+func isExpiredFilter(filter CuckooFilter, expire int64) bool {
+	extension, ok := filter.Extension().(*TimestampFilterExtension)
+	if !ok {
+		return false
+	}
+	return extension.LastTimestamp() < expire
+}
+
 // see next index and currentIndex reset
 func seeNextIndex(index, both int) int {
 	index++
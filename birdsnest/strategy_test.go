@@ -8,6 +8,11 @@ package birdsnest
 import (
 	"io/ioutil"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainmaker.org/chainmaker/pb-go/v2/common"
 )
 
 func TestLruStrategy(t *testing.T) {
@@ -69,3 +74,89 @@ func Test_loopIReset(t *testing.T) {
 		})
 	}
 }
+
+func TestSlidingWindowStrategy(t *testing.T) {
+	config := &common.BirdsNestConfig{
+		ChainId: "chain1",
+		Length:  10,
+		Rules: &common.RulesConfig{
+			AbsoluteExpireTime: 60,
+		},
+		Cuckoo: &common.CuckooConfig{
+			KeyType:       common.KeyType_KTTimestampKey,
+			TagsPerBucket: 4,
+			BitsPerItem:   9,
+			MaxNumKeys:    10,
+			TableType:     1,
+		},
+		Snapshot: &common.SnapshotSerializerConfig{
+			Type:        common.SerializeIntervalType_Timed,
+			Timed:       &common.TimedSerializeIntervalConfig{Interval: 5},
+			BlockHeight: &common.BlockHeightSerializeIntervalConfig{Interval: 5},
+			Path:        TestDir + "SlidingWindowStrategy",
+		},
+	}
+	bn, err := NewBirdsNest(config, make(chan struct{}), SlidingWindowStrategy(50*time.Millisecond), TestLogger{t})
+	require.Nil(t, err)
+
+	// keys older than the window
+	old := GetTimestampKeyByNano(time.Now().Add(-2 * time.Minute).UnixNano())
+	require.Nil(t, bn.Add(old))
+	require.Equal(t, 11, len(bn.filters))
+
+	// a new filter is opened once the interval elapsed, the empty and expired filters are dropped
+	time.Sleep(60 * time.Millisecond)
+	fresh := GetTimestampKey()
+	require.Nil(t, bn.Add(fresh))
+	require.Equal(t, 1, len(bn.filters))
+	require.Equal(t, 0, bn.currentIndex)
+	contains, err := bn.Contains(old)
+	require.Nil(t, err)
+	require.False(t, contains)
+	contains, err = bn.Contains(fresh)
+	require.Nil(t, err)
+	require.True(t, contains)
+
+	// filters in the window are kept, a full filter rotates before the interval
+	require.Nil(t, bn.Adds(GetTimestampKeys(25)))
+	require.True(t, len(bn.filters) > 1)
+	require.Equal(t, len(bn.filters)-1, bn.currentIndex)
+	contains, err = bn.Contains(fresh)
+	require.Nil(t, err)
+	require.True(t, contains)
+}
+
+func TestSlidingWindowStrategy_NoWindow(t *testing.T) {
+	config := &common.BirdsNestConfig{
+		ChainId: "chain1",
+		Length:  3,
+		Rules:   &common.RulesConfig{},
+		Cuckoo: &common.CuckooConfig{
+			KeyType:       common.KeyType_KTTimestampKey,
+			TagsPerBucket: 4,
+			BitsPerItem:   9,
+			MaxNumKeys:    10,
+			TableType:     1,
+		},
+		Snapshot: &common.SnapshotSerializerConfig{
+			Type:        common.SerializeIntervalType_Timed,
+			Timed:       &common.TimedSerializeIntervalConfig{Interval: 5},
+			BlockHeight: &common.BlockHeightSerializeIntervalConfig{Interval: 5},
+			Path:        TestDir + "SlidingWindowStrategyNoWindow",
+		},
+	}
+	bn, err := NewBirdsNest(config, make(chan struct{}), SlidingWindowStrategy(time.Hour), TestLogger{t})
+	require.Nil(t, err)
+
+	// without a window the filters rotate like LruStrategy, the oldest being dropped
+	first := GetTimestampKey()
+	require.Nil(t, bn.Add(first))
+	require.Nil(t, bn.Adds(GetTimestampKeys(200)))
+	require.Equal(t, 4, len(bn.filters))
+	require.Equal(t, 3, bn.currentIndex)
+	require.Equal(t, uint64(3), bn.Info()[1])
+	require.Equal(t, uint64(4), bn.Info()[5])
+	contains, err := bn.Contains(first)
+	require.Nil(t, err)
+	require.False(t, contains)
+}
@@ -11,12 +11,16 @@ import (
 	"time"
 )
 
-// ToTimestampKeysAndNormalKeys string to TimestampKey return timestampKeys and normalKeys
+// ToTimestampKeysAndNormalKeys string to TimestampKey return timestampKeys and normalKeys, the normal keys are
+// converted with ToDefaultKey like in ParseKey and the empty ones are skipped
 func ToTimestampKeysAndNormalKeys(key []string) (timestampKeys []Key, normalKeys []Key) {
 	for i := 0; i < len(key); i++ {
 		timestampKey, err := ToTimestampKey(key[i])
 		if err != nil {
-			normalKeys = append(normalKeys, TimestampKey(key[i]))
+			defaultKey, err := ToDefaultKey(key[i])
+			if err == nil {
+				normalKeys = append(normalKeys, defaultKey)
+			}
 		} else {
 			timestampKeys = append(timestampKeys, timestampKey)
 		}
@@ -0,0 +1,109 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package birdsnest
+
+import (
+	"strconv"
+
+	"go.uber.org/atomic"
+
+	"chainmaker.org/chainmaker/common/v2/monitor"
+)
+
+const (
+	labelNest                      = "nest"
+	labelFilter                    = "filter"
+	metricFalsePositiveCounter     = "metric_false_positive_counter"
+	metricFalsePositiveRate        = "metric_false_positive_rate"
+	helpFalsePositiveCounterMetric = "false positives per filter detected by the existence verifier metric"
+	helpFalsePositiveRateMetric    = "observed false positive rate per filter metric"
+)
+
+// ExistenceVerifier Confirms a positive hit of the filters against the authoritative storage (e.g. the block
+// store), it is called only when a filter contains the key and returns whether the key really exists
+type ExistenceVerifier func(key Key) (bool, error)
+
+// FilterStats The positive hits of a filter checked by the ExistenceVerifier, the stats are not serialized
+type FilterStats struct {
+	positives      *atomic.Uint64
+	falsePositives *atomic.Uint64
+}
+
+func newFilterStats() *FilterStats {
+	return &FilterStats{
+		positives:      atomic.NewUint64(0),
+		falsePositives: atomic.NewUint64(0),
+	}
+}
+
+// Positives the number of positive hits checked
+func (s *FilterStats) Positives() uint64 {
+	return s.positives.Load()
+}
+
+// FalsePositives the number of positive hits the verifier did not confirm
+func (s *FilterStats) FalsePositives() uint64 {
+	return s.falsePositives.Load()
+}
+
+// FalsePositiveRate the observed false positive rate, 0 if no hit was checked
+func (s *FilterStats) FalsePositiveRate() float64 {
+	positives := s.positives.Load()
+	if positives == 0 {
+		return 0
+	}
+	return float64(s.falsePositives.Load()) / float64(positives)
+}
+
+// record a checked positive hit
+func (s *FilterStats) record(falsePositive bool) {
+	s.positives.Inc()
+	if falsePositive {
+		s.falsePositives.Inc()
+	}
+}
+
+// SetExistenceVerifier Set the verifier of the positive hits, it must be set before the nest is used. The
+// false positive rate of each filter is then recorded with the monitor package
+func (b *BirdsNestImpl) SetExistenceVerifier(verifier ExistenceVerifier) {
+	b.verifier = verifier
+	if verifier == nil {
+		return
+	}
+	b.falsePositiveCounter = monitor.NewCounterVec(monitor.SUBSYSTEM_BIRDSNEST, metricFalsePositiveCounter,
+		helpFalsePositiveCounterMetric, monitor.ChainId, labelNest, labelFilter)
+	b.falsePositiveRate = monitor.NewGaugeVec(monitor.SUBSYSTEM_BIRDSNEST, metricFalsePositiveRate,
+		helpFalsePositiveRateMetric, monitor.ChainId, labelNest, labelFilter)
+}
+
+// FalsePositiveRates The observed false positive rate of each filter
+func (b *BirdsNestImpl) FalsePositiveRates() []float64 {
+	rates := make([]float64, len(b.filters))
+	for i, filter := range b.filters {
+		rates[i] = filter.Stats().FalsePositiveRate()
+	}
+	return rates
+}
+
+// verifyPositive Confirm that the key contained by the filter at index exists
+func (b *BirdsNestImpl) verifyPositive(index int, key Key) (bool, error) {
+	if b.verifier == nil {
+		return true, nil
+	}
+	exists, err := b.verifier(key)
+	if err != nil {
+		return false, err
+	}
+	stats := b.filters[index].Stats()
+	stats.record(!exists)
+	nest, filter := strconv.Itoa(b.number), strconv.Itoa(index)
+	if !exists {
+		b.log.Debugf("key %v is a false positive of filter %v", key, index)
+		b.falsePositiveCounter.WithLabelValues(b.config.ChainId, nest, filter).Inc()
+	}
+	b.falsePositiveRate.WithLabelValues(b.config.ChainId, nest, filter).Set(stats.FalsePositiveRate())
+	return exists, nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package birdsnest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBirdsNestImpl_SetExistenceVerifier(t *testing.T) {
+	bn := getTBN(TestDir+"ExistenceVerifier", t)
+	require.NotNil(t, bn)
+	stored, evicted := GetTimestampKey(), GetTimestampKey()
+	require.Nil(t, bn.Add(stored))
+	require.Nil(t, bn.Add(evicted))
+
+	// the block store only knows the stored key
+	var calls int
+	errStore := errors.New("block store unavailable")
+	var storeErr error
+	bn.SetExistenceVerifier(func(key Key) (bool, error) {
+		calls++
+		if storeErr != nil {
+			return false, storeErr
+		}
+		return key.String() == stored.String(), nil
+	})
+
+	contains, err := bn.Contains(stored)
+	require.Nil(t, err)
+	require.True(t, contains)
+	contains, err = bn.Contains(evicted)
+	require.Nil(t, err)
+	require.False(t, contains)
+	require.Equal(t, 2, calls)
+
+	// the verifier runs only on positive hits
+	contains, err = bn.Contains(GetTimestampKey())
+	require.Nil(t, err)
+	require.False(t, contains)
+	require.Equal(t, 2, calls)
+
+	stats := bn.filters[bn.currentIndex].Stats()
+	require.Equal(t, uint64(2), stats.Positives())
+	require.Equal(t, uint64(1), stats.FalsePositives())
+	require.Equal(t, 0.5, bn.FalsePositiveRates()[bn.currentIndex])
+
+	storeErr = errStore
+	_, err = bn.Contains(stored)
+	require.Equal(t, errStore, err)
+	require.Equal(t, uint64(2), stats.Positives())
+
+	// without a verifier the positive hits are trusted
+	bn.SetExistenceVerifier(nil)
+	contains, err = bn.Contains(evicted)
+	require.Nil(t, err)
+	require.True(t, contains)
+}
@@ -14,6 +14,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	cmx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
 )
@@ -136,3 +137,45 @@ func addSM2CertPool(certPool *cmx509.CertPool, trustRoot string) error {
 
 	return nil
 }
+
+// verifyRevocation wraps the verification of the peer certificates of crypto/tls,
+// so that the chains with a revoked certificate are rejected as by cmtls
+func verifyRevocation(checker cmx509.RevocationChecker,
+	verify func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) func(
+	rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if checker == nil {
+		return verify
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var (
+			chains   [][]*x509.Certificate
+			firstErr error
+		)
+		for _, chain := range verifiedChains {
+			sm2Chain := make([]*cmx509.Certificate, 0, len(chain))
+			for _, cert := range chain {
+				sm2Cert, err := cmx509.ParseCertificate(cert.Raw)
+				if err != nil {
+					return fmt.Errorf("parse peer cert failed, %s", err.Error())
+				}
+				sm2Chain = append(sm2Chain, sm2Cert)
+			}
+			if err := cmx509.CheckChainRevocation(checker, sm2Chain, time.Now()); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			chains = append(chains, chain)
+		}
+		if len(verifiedChains) > 0 && len(chains) == 0 {
+			return firstErr
+		}
+
+		if verify != nil {
+			return verify(rawCerts, chains)
+		}
+		return nil
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"fmt"
 
 	cmtls "chainmaker.org/chainmaker/common/v2/crypto/tls"
+	tlsconfig "chainmaker.org/chainmaker/common/v2/crypto/tls/config"
 	cmcred "chainmaker.org/chainmaker/common/v2/crypto/tls/credentials"
 	cmx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
 	"chainmaker.org/chainmaker/common/v2/log"
@@ -40,6 +41,13 @@ type CAClient struct {
 	EncKeyFile   string
 	EncCertBytes []byte
 	EncKeyBytes  []byte
+
+	// CertProvider, if not nil, supplies the certificates and the CA certificates
+	// instead of the fields above, and the handshakes use those it reloaded last
+	CertProvider *tlsconfig.CertProvider
+
+	// RevocationChecker, if not nil, rejects the revoked server certificates
+	RevocationChecker cmx509.RevocationChecker
 }
 
 func (c *CAClient) GetCredentialsByCA() (*credentials.TransportCredentials, error) {
@@ -48,6 +56,10 @@ func (c *CAClient) GetCredentialsByCA() (*credentials.TransportCredentials, erro
 		err, encErr   error
 	)
 
+	if c.CertProvider != nil {
+		return c.getCredentialsByProvider()
+	}
+
 	if c.CertBytes != nil && c.KeyBytes != nil {
 		cert, err = cmtls.X509KeyPair(c.CertBytes, c.KeyBytes)
 	} else {
@@ -82,10 +94,11 @@ func (c *CAClient) getCredentialsByCA(cert *tls.Certificate) (*credentials.Trans
 	}
 
 	clientTLS := credentials.NewTLS(&tls.Config{
-		Certificates:       []tls.Certificate{*cert},
-		ServerName:         c.ServerName,
-		RootCAs:            certPool,
-		InsecureSkipVerify: false,
+		Certificates:          []tls.Certificate{*cert},
+		ServerName:            c.ServerName,
+		RootCAs:               certPool,
+		InsecureSkipVerify:    false,
+		VerifyPeerCertificate: verifyRevocation(c.RevocationChecker, nil),
 	})
 
 	return &clientTLS, nil
@@ -137,6 +150,7 @@ func (c *CAClient) getGMCredentialsByCA(cert, encCert *cmtls.Certificate) (*cred
 		ServerName:         c.ServerName,
 		RootCAs:            certPool,
 		InsecureSkipVerify: false,
+		RevocationChecker:  c.RevocationChecker,
 	}
 
 	if encCert != nil {
@@ -149,6 +163,17 @@ func (c *CAClient) getGMCredentialsByCA(cert, encCert *cmtls.Certificate) (*cred
 	return &clientTLS, nil
 }
 
+func (c *CAClient) getCredentialsByProvider() (*credentials.TransportCredentials, error) {
+	cfg := c.CertProvider.GetConfig(false)
+	cfg.ServerName = c.ServerName
+	cfg.InsecureSkipVerify = false
+	cfg.RevocationChecker = c.RevocationChecker
+
+	clientTLS := cmcred.NewTLS(cfg)
+
+	return &clientTLS, nil
+}
+
 func (c *CAClient) appendCertsToSM2CertPool(certPool *cmx509.CertPool) {
 	for _, caCert := range c.CaCerts {
 		if caCert != "" {
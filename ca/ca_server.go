@@ -14,10 +14,12 @@ import (
 	"fmt"
 
 	cmtls "chainmaker.org/chainmaker/common/v2/crypto/tls"
+	tlsconfig "chainmaker.org/chainmaker/common/v2/crypto/tls/config"
 	cmcred "chainmaker.org/chainmaker/common/v2/crypto/tls/credentials"
 	cmx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
 	"chainmaker.org/chainmaker/common/v2/log"
 
+	"golang.org/x/net/http2"
 	"google.golang.org/grpc/credentials"
 )
 
@@ -27,6 +29,13 @@ type CAServer struct {
 	CertFile string
 	KeyFile  string
 	Logger   log.LoggerInterface
+
+	// CertProvider, if not nil, supplies the certificates and the CA certificates
+	// instead of the fields above, and the handshakes use those it reloaded last
+	CertProvider *tlsconfig.CertProvider
+
+	// RevocationChecker, if not nil, rejects the revoked client certificates
+	RevocationChecker cmx509.RevocationChecker
 }
 
 type CustomVerify struct {
@@ -37,6 +46,10 @@ type CustomVerify struct {
 func (s *CAServer) GetCredentialsByCA(checkClientAuth bool, customVerify CustomVerify) (
 	*credentials.TransportCredentials, error) {
 
+	if s.CertProvider != nil {
+		return s.getCredentialsByProvider(checkClientAuth, customVerify.GMVerifyPeerCertificate)
+	}
+
 	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
 	if err == nil {
 		return s.getCredentialsByCA(checkClientAuth, &cert, customVerify.VerifyPeerCertificate)
@@ -87,7 +100,7 @@ func (s *CAServer) getCredentialsByCA(checkClientAuth bool,
 		ClientAuth:            clientAuth,
 		ClientCAs:             clientCAs,
 		InsecureSkipVerify:    false,
-		VerifyPeerCertificate: customVerifyFunc,
+		VerifyPeerCertificate: verifyRevocation(s.RevocationChecker, customVerifyFunc),
 	})
 
 	return &c, nil
@@ -162,11 +175,34 @@ func (s *CAServer) getGMCredentialsByCA(checkClientAuth bool,
 		ClientCAs:             clientCAs,
 		InsecureSkipVerify:    false,
 		VerifyPeerCertificate: customVerifyFunc,
+		RevocationChecker:     s.RevocationChecker,
 	})
 
 	return &c, nil
 }
 
+func (s *CAServer) getCredentialsByProvider(checkClientAuth bool,
+	customVerifyFunc func(rawCerts [][]byte, verifiedChains [][]*cmx509.Certificate) error) (
+	*credentials.TransportCredentials, error) {
+
+	clientAuth := cmtls.NoClientCert
+	if checkClientAuth {
+		clientAuth = cmtls.RequireAndVerifyClientCert
+	}
+
+	cfg := s.CertProvider.GetConfig(true)
+	cfg.ClientAuth = clientAuth
+	cfg.InsecureSkipVerify = false
+	cfg.VerifyPeerCertificate = customVerifyFunc
+	cfg.RevocationChecker = s.RevocationChecker
+	// the config of each handshake is cloned from this one, not from the one of the credentials
+	cfg.NextProtos = []string{http2.NextProtoTLS}
+
+	c := cmcred.NewTLS(cfg)
+
+	return &c, nil
+}
+
 func (s *CAServer) addCertsToSM2CertPool(certPool *cmx509.CertPool) error {
 	for _, caCert := range s.CaCerts {
 		if caCert != "" {
@@ -0,0 +1,394 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cert
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	bcx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+	"github.com/tjfoc/gmsm/sm2"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+)
+
+// Profile names the policy template a certificate is issued with
+type Profile string
+
+const (
+	// ProfileNode the sign certificate of a consensus node
+	ProfileNode Profile = "node"
+	// ProfileClient the sign certificate of a client
+	ProfileClient Profile = "client"
+	// ProfileAdmin the sign certificate of an administrator
+	ProfileAdmin Profile = "admin"
+	// ProfileTLS the TLS certificate of a node or a client, used on both sides of a connection
+	ProfileTLS Profile = "tls"
+	// ProfileGMEnc the enc certificate of GMSSL, paired with a TLS certificate
+	ProfileGMEnc Profile = "gm_enc"
+)
+
+var oidExtensionCRLReasons = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// Policy the template of the certificates of a profile
+type Policy struct {
+	// OrganizationalUnit, if not empty, replaces the one of the CSR, being the role of the certificate
+	OrganizationalUnit string
+	KeyUsages          []x509.KeyUsage
+	ExtKeyUsages       []x509.ExtKeyUsage
+	ExpireYear         int32
+	// AllowSans whether the certificate may carry DNS names and IP addresses
+	AllowSans bool
+	// SM2Only whether the key of the CSR must be an SM2 key
+	SM2Only bool
+}
+
+// DefaultPolicies the policies of the profiles, unless overridden by AuthorityConfig.Policies
+var DefaultPolicies = map[Profile]*Policy{
+	ProfileNode: {
+		OrganizationalUnit: "consensus",
+		KeyUsages:          []x509.KeyUsage{x509.KeyUsageDigitalSignature, x509.KeyUsageContentCommitment},
+	},
+	ProfileClient: {
+		OrganizationalUnit: "client",
+		KeyUsages:          []x509.KeyUsage{x509.KeyUsageDigitalSignature, x509.KeyUsageContentCommitment},
+	},
+	ProfileAdmin: {
+		OrganizationalUnit: "admin",
+		KeyUsages:          []x509.KeyUsage{x509.KeyUsageDigitalSignature, x509.KeyUsageContentCommitment},
+	},
+	ProfileTLS: {
+		KeyUsages: []x509.KeyUsage{x509.KeyUsageDigitalSignature, x509.KeyUsageKeyEncipherment,
+			x509.KeyUsageKeyAgreement},
+		ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		AllowSans:    true,
+	},
+	ProfileGMEnc: {
+		KeyUsages: []x509.KeyUsage{x509.KeyUsageKeyEncipherment, x509.KeyUsageDataEncipherment,
+			x509.KeyUsageKeyAgreement},
+		ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		AllowSans:    true,
+		SM2Only:      true,
+	},
+}
+
+// AuthorityConfig contains necessary parameters for running a CA.
+type AuthorityConfig struct {
+	Store    Store
+	HashType crypto.HashType
+	// PrivKey and Cert the key and certificate of the CA, loaded from the files below if PrivKey is nil
+	PrivKey         crypto.PrivateKey
+	Cert            *x509.Certificate
+	PrivKeyFilePath string
+	CertFilePath    string
+	PrivKeyPwd      []byte
+	// Policies overrides DefaultPolicies by profile
+	Policies map[Profile]*Policy
+}
+
+// Authority issues certificates from CSRs, revokes them and produces the CRLs
+// of a CA, keeping their serial numbers and index in its Store
+type Authority struct {
+	store    Store
+	hashType crypto.HashType
+	privKey  crypto.PrivateKey
+	cert     *x509.Certificate
+	policies map[Profile]*Policy
+
+	// mu serializes the revocations of a certificate
+	mu sync.Mutex
+}
+
+// IssueConfig contains necessary parameters for issuing cert from a CSR.
+type IssueConfig struct {
+	// CSR PEM or DER certificate request, whose signature proves the possession of the key
+	CSR     []byte
+	Profile Profile
+	Sans    []string
+	// ExpireYear overrides the one of the policy if not 0
+	ExpireYear int32
+}
+
+// NewAuthority returns the Authority of the CA
+func NewAuthority(cfg *AuthorityConfig) (*Authority, error) {
+	if cfg.Store == nil {
+		return nil, errors.New("nil store")
+	}
+
+	privKey, caCert := cfg.PrivKey, cfg.Cert
+	if privKey == nil {
+		var err error
+		privKey, caCert, err = loadPrivKeyAndCert(cfg.PrivKeyFilePath, cfg.CertFilePath, cfg.PrivKeyPwd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if caCert == nil {
+		return nil, errors.New("nil CA cert")
+	}
+	if !caCert.IsCA {
+		return nil, fmt.Errorf("cert [%s] is not a CA cert", caCert.Subject)
+	}
+
+	policies := make(map[Profile]*Policy, len(DefaultPolicies)+len(cfg.Policies))
+	for profile, policy := range DefaultPolicies {
+		policies[profile] = policy
+	}
+	for profile, policy := range cfg.Policies {
+		policies[profile] = policy
+	}
+
+	return &Authority{
+		store:    cfg.Store,
+		hashType: cfg.HashType,
+		privKey:  privKey,
+		cert:     caCert,
+		policies: policies,
+	}, nil
+}
+
+// CACert returns the certificate of the CA
+func (a *Authority) CACert() *x509.Certificate {
+	return a.cert
+}
+
+// Issue issues a certificate from the CSR, with the template of the policy of its profile
+func (a *Authority) Issue(cfg *IssueConfig) (*x509.Certificate, error) {
+	policy, ok := a.policies[cfg.Profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile [%s]", cfg.Profile)
+	}
+	if len(cfg.Sans) > 0 && !policy.AllowSans {
+		return nil, fmt.Errorf("profile [%s] does not allow sans", cfg.Profile)
+	}
+
+	csr, err := parseCSR(cfg.CSR)
+	if err != nil {
+		return nil, err
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("csr CheckSignature failed, %s", err)
+	}
+	pub := csr.PublicKey.ToStandardKey()
+	if _, isSM2 := pub.(*sm2.PublicKey); policy.SM2Only && !isSM2 {
+		return nil, fmt.Errorf("profile [%s] requires an SM2 key", cfg.Profile)
+	}
+
+	template, err := a.issueTemplate(csr, policy, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	certDER, err := bcx509.CreateCertificate(rand.Reader, template, a.cert, pub, a.privKey.ToStandardKey())
+	if err != nil {
+		return nil, fmt.Errorf("issue certificate failed, %s", err)
+	}
+	cert, err := parseCertificateDER(certDER)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.store.Put(&CertRecord{
+		SerialNumber: cert.SerialNumber,
+		Profile:      cfg.Profile,
+		Subject:      cert.Subject.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Raw:          cert.Raw,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("store cert failed, %s", err.Error())
+	}
+
+	return cert, nil
+}
+
+func (a *Authority) issueTemplate(csr *bcx509.CertificateRequest, policy *Policy,
+	cfg *IssueConfig) (*x509.Certificate, error) {
+
+	sn, err := a.nextSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	signatureAlgorithm, err := getSignatureAlgorithm(a.privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	expireYear := cfg.ExpireYear
+	if expireYear <= 0 {
+		expireYear = policy.ExpireYear
+	}
+	if expireYear <= 0 {
+		expireYear = defaultExpireYear
+	}
+	notBefore := time.Now().Add(-10 * time.Minute).UTC()
+	notAfter := notBefore.Add(time.Duration(expireYear) * 365 * 24 * time.Hour).UTC()
+	// a certificate cannot outlive its issuer
+	if notAfter.After(a.cert.NotAfter) {
+		notAfter = a.cert.NotAfter
+	}
+
+	var keyUsages x509.KeyUsage
+	for _, keyUsage := range policy.KeyUsages {
+		keyUsages |= keyUsage
+	}
+
+	subject := issueSubject(csr, policy)
+
+	dnsName, ipAddrs := dealSANS(cfg.Sans)
+
+	template := &x509.Certificate{
+		SignatureAlgorithm: signatureAlgorithm,
+		SerialNumber:       sn,
+		NotBefore:          notBefore,
+		NotAfter:           notAfter,
+		Issuer:             a.cert.Subject,
+		KeyUsage:           keyUsages,
+		ExtKeyUsage:        policy.ExtKeyUsages,
+		IPAddresses:        ipAddrs,
+		DNSNames:           dnsName,
+		Subject:            subject,
+	}
+
+	if a.cert.SubjectKeyId != nil {
+		template.AuthorityKeyId = a.cert.SubjectKeyId
+	} else {
+		template.AuthorityKeyId, err = ComputeSKI(a.hashType, a.cert.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("issue cert compute issuer cert SKI failed, %s", err.Error())
+		}
+	}
+
+	template.SubjectKeyId, err = ComputeSKI(a.hashType, csr.PublicKey.ToStandardKey())
+	if err != nil {
+		return nil, fmt.Errorf("issue cert compute csr SKI failed, %s", err.Error())
+	}
+
+	return template, nil
+}
+
+// issueSubject returns the subject of a certificate issued from the CSR, whose OU the policy overrides
+func issueSubject(csr *bcx509.CertificateRequest, policy *Policy) pkix.Name {
+	subject := csr.Subject
+	if policy.OrganizationalUnit != "" {
+		subject.OrganizationalUnit = []string{policy.OrganizationalUnit}
+	}
+	return subject
+}
+
+// nextSerial returns the next serial number of the store, skipping the one of the CA certificate
+func (a *Authority) nextSerial() (*big.Int, error) {
+	for {
+		sn, err := a.store.NextSerial()
+		if err != nil {
+			return nil, fmt.Errorf("get sn failed, %s", err)
+		}
+		if sn.Cmp(a.cert.SerialNumber) != 0 {
+			return sn, nil
+		}
+	}
+}
+
+// Certificate returns the record of an issued certificate, or ErrCertNotFound
+func (a *Authority) Certificate(serial *big.Int) (*CertRecord, error) {
+	return a.store.Get(serial)
+}
+
+// Certificates returns the records of the issued certificates by serial number
+func (a *Authority) Certificates() ([]*CertRecord, error) {
+	return a.store.List()
+}
+
+// Revoke revokes an issued certificate, reason being the CRLReason of RFC 5280, Section 5.3.1
+func (a *Authority) Revoke(serial *big.Int, reason int) error {
+	if reason < 0 || reason > 10 || reason == 7 {
+		return fmt.Errorf("invalid revocation reason [%d]", reason)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	record, err := a.store.Get(serial)
+	if err != nil {
+		return err
+	}
+	if record.Revoked {
+		return fmt.Errorf("cert [%s] already revoked", serial)
+	}
+	record.Revoked = true
+	record.RevokedAt = time.Now().UTC()
+	record.Reason = reason
+	if err = a.store.Put(record); err != nil {
+		return fmt.Errorf("store cert failed, %s", err.Error())
+	}
+	return nil
+}
+
+// CreateCRL returns the DER CRL of the revoked certificates which have not
+// expired yet, valid for the given duration
+func (a *Authority) CreateCRL(validity time.Duration) ([]byte, error) {
+	records, err := a.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var revokedCerts []pkix.RevokedCertificate
+	for _, record := range records {
+		if !record.Revoked || now.After(record.NotAfter) {
+			continue
+		}
+		revokedCert := pkix.RevokedCertificate{
+			SerialNumber:   record.SerialNumber,
+			RevocationTime: record.RevokedAt,
+		}
+		if record.Reason != 0 {
+			reason, err := asn1.Marshal(asn1.Enumerated(record.Reason))
+			if err != nil {
+				return nil, err
+			}
+			revokedCert.Extensions = []pkix.Extension{{Id: oidExtensionCRLReasons, Value: reason}}
+		}
+		revokedCerts = append(revokedCerts, revokedCert)
+	}
+
+	crl, err := bcx509.CreateCRL(rand.Reader, a.cert, a.privKey.ToStandardKey(), revokedCerts, now, now.Add(validity))
+	if err != nil {
+		return nil, fmt.Errorf("create CRL failed, %s", err.Error())
+	}
+	return crl, nil
+}
+
+// parseCSR parses a PEM or DER certificate request
+func parseCSR(csrRaw []byte) (*bcx509.CertificateRequest, error) {
+	if block, _ := pem.Decode(csrRaw); block != nil {
+		csrRaw = block.Bytes
+	}
+	csr, err := bcx509.ParseCertificateRequest(csrRaw)
+	if err != nil {
+		return nil, fmt.Errorf(parseCertificateFailedErrorTemplate, err)
+	}
+	return csr, nil
+}
+
+func parseCertificateDER(certDER []byte) (*x509.Certificate, error) {
+	cert, err := bcx509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("ParseCertificate cert failed, %s", err)
+	}
+	return bcx509.ChainMakerCertToX509Cert(cert)
+}
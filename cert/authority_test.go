@@ -0,0 +1,149 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cert
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	bcx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthority(t *testing.T, dir string, keyType crypto.KeyType, hashType crypto.HashType) *Authority {
+	caKey, err := CreatePrivKey(keyType, dir, "ca.key", true)
+	require.NoError(t, err)
+	err = CreateCACertificate(&CACertificateConfig{
+		PrivKey:      caKey,
+		HashType:     hashType,
+		CertPath:     dir,
+		CertFileName: "ca.crt",
+		CommonName:   "ca.chainmaker.org",
+	})
+	require.NoError(t, err)
+
+	store, err := NewFileStore(filepath.Join(dir, "db"))
+	require.NoError(t, err)
+	authority, err := NewAuthority(&AuthorityConfig{
+		Store:           store,
+		HashType:        hashType,
+		PrivKeyFilePath: filepath.Join(dir, "ca.key"),
+		CertFilePath:    filepath.Join(dir, "ca.crt"),
+	})
+	require.NoError(t, err)
+	return authority
+}
+
+func newTestCSR(t *testing.T, dir string, keyType crypto.KeyType, commonName string) []byte {
+	key, err := CreatePrivKey(keyType, "", "", true)
+	require.NoError(t, err)
+	err = CreateCSR(&CSRConfig{
+		PrivKey:     key,
+		CsrPath:     dir,
+		CsrFileName: commonName + ".csr",
+		CommonName:  commonName,
+	})
+	require.NoError(t, err)
+	csr, err := ioutil.ReadFile(filepath.Join(dir, commonName+".csr"))
+	require.NoError(t, err)
+	return csr
+}
+
+func TestAuthority(t *testing.T) {
+	for _, keyType := range []crypto.KeyType{crypto.SM2, crypto.ECC_NISTP256} {
+		dir := t.TempDir()
+		hashType := crypto.HASH_TYPE_SHA256
+		if keyType == crypto.SM2 {
+			hashType = crypto.HASH_TYPE_SM3
+		}
+		authority := newTestAuthority(t, dir, keyType, hashType)
+
+		node, err := authority.Issue(&IssueConfig{
+			CSR:     newTestCSR(t, dir, keyType, "consensus1.chainmaker.org"),
+			Profile: ProfileNode,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"consensus"}, node.Subject.OrganizationalUnit)
+		require.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment, node.KeyUsage)
+		require.Equal(t, authority.CACert().SubjectKeyId, node.AuthorityKeyId)
+		require.False(t, node.NotAfter.After(authority.CACert().NotAfter))
+
+		tlsCert, err := authority.Issue(&IssueConfig{
+			CSR:     newTestCSR(t, dir, keyType, "tls1.chainmaker.org"),
+			Profile: ProfileTLS,
+			Sans:    []string{"127.0.0.1", "chainmaker.org"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"chainmaker.org"}, tlsCert.DNSNames)
+		require.Len(t, tlsCert.IPAddresses, 1)
+		require.Equal(t, 1, new(big.Int).Sub(tlsCert.SerialNumber, node.SerialNumber).Sign())
+
+		// the policies are enforced
+		_, err = authority.Issue(&IssueConfig{
+			CSR:     newTestCSR(t, dir, keyType, "client1.chainmaker.org"),
+			Profile: ProfileClient,
+			Sans:    []string{"chainmaker.org"},
+		})
+		require.Error(t, err)
+		_, err = authority.Issue(&IssueConfig{
+			CSR:     newTestCSR(t, dir, keyType, "client1.chainmaker.org"),
+			Profile: "unknown",
+		})
+		require.Error(t, err)
+		_, err = authority.Issue(&IssueConfig{
+			CSR:     newTestCSR(t, dir, keyType, "tls1.chainmaker.org"),
+			Profile: ProfileGMEnc,
+		})
+		require.Equal(t, keyType == crypto.SM2, err == nil)
+		_, err = authority.Issue(&IssueConfig{CSR: []byte("not a CSR"), Profile: ProfileAdmin})
+		require.Error(t, err)
+
+		// the revoked certificates are listed in the CRL
+		require.NoError(t, authority.Revoke(node.SerialNumber, 1))
+		require.Error(t, authority.Revoke(node.SerialNumber, 1))
+		require.Equal(t, ErrCertNotFound, authority.Revoke(big.NewInt(1000000000), 0))
+
+		crl, err := authority.CreateCRL(time.Hour)
+		require.NoError(t, err)
+		cache := bcx509.NewCRLCache()
+		require.NoError(t, cache.AddCRL(crl))
+		caCert, err := bcx509.ParseCertificate(authority.CACert().Raw)
+		require.NoError(t, err)
+		bcNode, err := bcx509.ParseCertificate(node.Raw)
+		require.NoError(t, err)
+		bcTLS, err := bcx509.ParseCertificate(tlsCert.Raw)
+		require.NoError(t, err)
+		now := time.Now().Add(time.Second)
+		err = cache.CheckRevocation(bcNode, caCert, now)
+		require.Equal(t, 1, err.(bcx509.RevokedError).Reason)
+		require.NoError(t, cache.CheckRevocation(bcTLS, caCert, now))
+
+		// the index and the serial numbers are kept across restarts
+		store, err := NewFileStore(filepath.Join(dir, "db"))
+		require.NoError(t, err)
+		records, err := store.List()
+		require.NoError(t, err)
+		// the GM enc certificate is only issued for an SM2 key
+		issued := 2
+		if keyType == crypto.SM2 {
+			issued = 3
+		}
+		require.Len(t, records, issued)
+		require.True(t, records[0].Revoked)
+		require.Equal(t, ProfileNode, records[0].Profile)
+		require.Equal(t, node.Raw, records[0].Raw)
+		serial, err := store.NextSerial()
+		require.NoError(t, err)
+		require.Equal(t, 1, serial.Cmp(records[len(records)-1].SerialNumber))
+	}
+}
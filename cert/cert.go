@@ -152,6 +152,27 @@ type CSRConfig struct {
 }
 
 func CreateCSR(cfg *CSRConfig) error {
+	data, err := createCSR(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(cfg.CsrPath, os.ModePerm); err != nil {
+		return fmt.Errorf("mk csr dir failed, %s", err.Error())
+	}
+
+	path := filepath.Join(cfg.CsrPath, cfg.CsrFileName)
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf(createFileFailedErrorTemplate, err.Error())
+	}
+	defer f.Close()
+
+	return pem.Encode(f, &pem.Block{Type: "CSR", Bytes: data})
+}
+
+// createCSR returns the DER CSR of the config, signed by its private key
+func createCSR(cfg *CSRConfig) ([]byte, error) {
 	templateX509, err := GenerateCSRTemplate(
 		cfg.PrivKey,
 		cfg.Country,
@@ -162,31 +183,19 @@ func CreateCSR(cfg *CSRConfig) error {
 		cfg.CommonName,
 	)
 	if err != nil {
-		return fmt.Errorf("generate csr template failed, %s", err.Error())
+		return nil, fmt.Errorf("generate csr template failed, %s", err.Error())
 	}
 
 	template, err := bcx509.X509CertCsrToChainMakerCertCsr(templateX509)
 	if err != nil {
-		return fmt.Errorf("generate csr failed, %s", err.Error())
+		return nil, fmt.Errorf("generate csr failed, %s", err.Error())
 	}
 
 	data, err := bcx509.CreateCertificateRequest(rand.Reader, template, cfg.PrivKey.ToStandardKey())
 	if err != nil {
-		return fmt.Errorf("CreateCertificateRequest failed, %s", err.Error())
+		return nil, fmt.Errorf("CreateCertificateRequest failed, %s", err.Error())
 	}
-
-	if err = os.MkdirAll(cfg.CsrPath, os.ModePerm); err != nil {
-		return fmt.Errorf("mk csr dir failed, %s", err.Error())
-	}
-
-	path := filepath.Join(cfg.CsrPath, cfg.CsrFileName)
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf(createFileFailedErrorTemplate, err.Error())
-	}
-	defer f.Close()
-
-	return pem.Encode(f, &pem.Block{Type: "CSR", Bytes: data})
+	return data, nil
 }
 
 // IssueCertificateConfig contains necessary parameters for issuing cert.
@@ -298,29 +307,8 @@ func IssueCertificate(cfg *IssueCertificateConfig) error {
 func issueCertificatePrepare(cfg *IssueCertificateConfig) (privKey crypto.PrivateKey, issuerCert *x509.Certificate,
 	csr *bcx509.CertificateRequest, sn *big.Int, err error) {
 
-	privKeyRaw, err := ioutil.ReadFile(cfg.IssuerPrivKeyFilePath)
-	if err != nil {
-		err = fmt.Errorf("read private key file [%s] failed, %s", cfg.IssuerPrivKeyFilePath, err)
-		return
-	}
-
-	if P11Context != nil && P11Context.enable {
-		privKey, err = ParseP11PrivKey(P11Context.handle, privKeyRaw)
-		if err != nil {
-			err = fmt.Errorf("parse pkcs11 privakey failed, %s", err)
-			return
-		}
-	} else {
-		privKey, err = asym.PrivateKeyFromPEM(privKeyRaw, cfg.IssuerPrivKeyPwd)
-		if err != nil {
-			err = fmt.Errorf("PrivateKeyFromPEM failed, %s", err)
-			return
-		}
-	}
-
-	issuerCert, err = ParseCertificate(cfg.IssuerCertFilePath)
+	privKey, issuerCert, err = loadPrivKeyAndCert(cfg.IssuerPrivKeyFilePath, cfg.IssuerCertFilePath, cfg.IssuerPrivKeyPwd)
 	if err != nil {
-		err = fmt.Errorf("ParseCertificate cert failed, %s", err)
 		return
 	}
 
@@ -346,6 +334,38 @@ func issueCertificatePrepare(cfg *IssueCertificateConfig) (privKey crypto.Privat
 	return
 }
 
+// loadPrivKeyAndCert loads a private key, from a pkcs11 key spec when enabled, and its certificate
+func loadPrivKeyAndCert(privKeyFilePath, certFilePath string, privKeyPwd []byte) (privKey crypto.PrivateKey,
+	cert *x509.Certificate, err error) {
+
+	privKeyRaw, err := ioutil.ReadFile(privKeyFilePath)
+	if err != nil {
+		err = fmt.Errorf("read private key file [%s] failed, %s", privKeyFilePath, err)
+		return
+	}
+
+	if P11Context != nil && P11Context.enable {
+		privKey, err = ParseP11PrivKey(P11Context.handle, privKeyRaw)
+		if err != nil {
+			err = fmt.Errorf("parse pkcs11 privakey failed, %s", err)
+			return
+		}
+	} else {
+		privKey, err = asym.PrivateKeyFromPEM(privKeyRaw, privKeyPwd)
+		if err != nil {
+			err = fmt.Errorf("PrivateKeyFromPEM failed, %s", err)
+			return
+		}
+	}
+
+	cert, err = ParseCertificate(certFilePath)
+	if err != nil {
+		err = fmt.Errorf("ParseCertificate cert failed, %s", err)
+		return
+	}
+	return
+}
+
 // ParseCertificate - parse certification
 func ParseCertificate(certFilePath string) (*x509.Certificate, error) {
 	certRaw, err := ioutil.ReadFile(certFilePath)
@@ -0,0 +1,345 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bcx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+)
+
+const (
+	defaultEnrollTimeout       = 30 * time.Second
+	defaultRenewRetryInterval  = time.Minute
+	maxEnrollResponseSize      = 1 << 20
+	enrollRequestFailedMessage = "enroll request failed, %s"
+)
+
+// EnrollClientConfig contains necessary parameters for enrolling and renewing a cert.
+type EnrollClientConfig struct {
+	// ServerURL the base URL of the EnrollServer
+	ServerURL  string
+	HTTPClient *http.Client
+	Token      string
+	Profile    Profile
+	Sans       []string
+	// PrivKey, e.g. a pkcs11 or KMS key, is certified by each renewal if not
+	// nil, otherwise a new key of KeyType is generated for each of them
+	PrivKey            crypto.PrivateKey
+	KeyType            crypto.KeyType
+	CertPath           string
+	CertFileName       string
+	PrivKeyFileName    string
+	CACertFileName     string
+	Country            string
+	Locality           string
+	Province           string
+	OrganizationalUnit string
+	Organization       string
+	CommonName         string
+	// RenewBefore how long before its NotAfter the cert is renewed, a third of its validity by default
+	RenewBefore time.Duration
+	// RetryInterval the delay before another attempt of a failed renewal, a minute by default
+	RetryInterval time.Duration
+}
+
+// EnrollClient enrolls a cert with an EnrollServer, and renews it before it
+// expires. The cert, its key and the CA cert are written atomically to their
+// files, so that a config.CertProvider watching them reloads them.
+type EnrollClient struct {
+	cfg        EnrollClientConfig
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	privKey crypto.PrivateKey
+	cert    *x509.Certificate
+
+	stopC    chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEnrollClient returns the client of the config, with the cert and key of
+// its files if they were enrolled before
+func NewEnrollClient(cfg *EnrollClientConfig) (*EnrollClient, error) {
+	if cfg.ServerURL == "" {
+		return nil, errors.New("empty server url")
+	}
+	c := &EnrollClient{
+		cfg:        *cfg,
+		httpClient: cfg.HTTPClient,
+		privKey:    cfg.PrivKey,
+		stopC:      make(chan struct{}),
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: defaultEnrollTimeout}
+	}
+	if c.cfg.RetryInterval <= 0 {
+		c.cfg.RetryInterval = defaultRenewRetryInterval
+	}
+
+	certFilePath := filepath.Join(cfg.CertPath, cfg.CertFileName)
+	if _, err := os.Stat(certFilePath); os.IsNotExist(err) {
+		return c, nil
+	}
+	var err error
+	if c.privKey != nil {
+		c.cert, err = ParseCertificate(certFilePath)
+	} else {
+		c.privKey, c.cert, err = loadPrivKeyAndCert(filepath.Join(cfg.CertPath, cfg.PrivKeyFileName), certFilePath, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Certificate returns the cert enrolled or renewed last, nil before the first enrollment
+func (c *EnrollClient) Certificate() *x509.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert
+}
+
+// Enroll enrolls a cert with the token
+func (c *EnrollClient) Enroll() (*x509.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.request(enrollPath, func(req *EnrollRequest, csr []byte) error {
+		req.Profile = c.cfg.Profile
+		req.Sans = c.cfg.Sans
+		req.Token = c.cfg.Token
+		return nil
+	})
+}
+
+// Renew renews the cert, the request being signed by its key
+func (c *EnrollClient) Renew() (*x509.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert == nil {
+		return nil, errors.New("no cert to renew, enroll first")
+	}
+	return c.request(renewPath, func(req *EnrollRequest, csr []byte) error {
+		signature, err := c.privKey.SignWithOpts(csr, enrollSignOpts(c.privKey.Type()))
+		if err != nil {
+			return fmt.Errorf("sign renewal failed, %s", err.Error())
+		}
+		req.Cert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}))
+		req.Signature = signature
+		return nil
+	})
+}
+
+// request requests a cert for a new key, or the configured one, and writes
+// them to their files once issued
+func (c *EnrollClient) request(path string, prepare func(req *EnrollRequest, csr []byte) error) (
+	*x509.Certificate, error) {
+
+	privKey, privKeyTmpPath, err := c.newPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	if privKeyTmpPath != "" {
+		defer os.Remove(privKeyTmpPath)
+	}
+
+	csr, err := createCSR(&CSRConfig{
+		PrivKey:            privKey,
+		Country:            c.cfg.Country,
+		Locality:           c.cfg.Locality,
+		Province:           c.cfg.Province,
+		OrganizationalUnit: c.cfg.OrganizationalUnit,
+		Organization:       c.cfg.Organization,
+		CommonName:         c.cfg.CommonName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req := &EnrollRequest{CSR: string(pem.EncodeToMemory(&pem.Block{Type: "CSR", Bytes: csr}))}
+	if err = prepare(req, csr); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.post(path, req)
+	if err != nil {
+		return nil, err
+	}
+	cert, caCertPEM, err := c.parseResponse(resp, privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the key comes first, a reload between the two writes fails and keeps the previous pair
+	if privKeyTmpPath != "" {
+		if err = syncFile(privKeyTmpPath); err != nil {
+			return nil, err
+		}
+		if err = renameFileSync(privKeyTmpPath, filepath.Join(c.cfg.CertPath, c.cfg.PrivKeyFileName)); err != nil {
+			return nil, err
+		}
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err = writeFileAtomic(filepath.Join(c.cfg.CertPath, c.cfg.CertFileName), certPEM); err != nil {
+		return nil, err
+	}
+	if c.cfg.CACertFileName != "" {
+		if err = writeFileAtomic(filepath.Join(c.cfg.CertPath, c.cfg.CACertFileName), caCertPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	c.privKey, c.cert = privKey, cert
+	return cert, nil
+}
+
+// newPrivKey returns the configured key, or a new key written to a temporary
+// file, which replaces the key file once its cert is issued
+func (c *EnrollClient) newPrivKey() (crypto.PrivateKey, string, error) {
+	if c.cfg.PrivKey != nil {
+		return c.cfg.PrivKey, "", nil
+	}
+	privKeyTmpFileName := c.cfg.PrivKeyFileName + ".tmp"
+	isTLS := c.cfg.Profile == ProfileTLS || c.cfg.Profile == ProfileGMEnc
+	privKey, err := CreatePrivKey(c.cfg.KeyType, c.cfg.CertPath, privKeyTmpFileName, isTLS)
+	if err != nil {
+		return nil, "", err
+	}
+	return privKey, filepath.Join(c.cfg.CertPath, privKeyTmpFileName), nil
+}
+
+// syncFile flushes the file written by another writer to the disk
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("sync file [%s] failed, %s", path, err.Error())
+	}
+	defer f.Close()
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("sync file [%s] failed, %s", path, err.Error())
+	}
+	return nil
+}
+
+func (c *EnrollClient) post(path string, req *EnrollRequest) (*EnrollResponse, error) {
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal request failed, %s", err.Error())
+	}
+
+	url := strings.TrimSuffix(c.cfg.ServerURL, "/") + path
+	httpResp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, fmt.Errorf(enrollRequestFailedMessage, err.Error())
+	}
+	defer httpResp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxEnrollResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf(enrollRequestFailedMessage, err.Error())
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(enrollRequestFailedMessage,
+			fmt.Sprintf("%s: %s", httpResp.Status, strings.TrimSpace(string(respBytes))))
+	}
+
+	var resp EnrollResponse
+	if err = json.Unmarshal(respBytes, &resp); err != nil {
+		return nil, fmt.Errorf("json unmarshal response failed, %s", err.Error())
+	}
+	return &resp, nil
+}
+
+// parseResponse returns the issued cert, which must certify the key, and the PEM CA cert
+func (c *EnrollClient) parseResponse(resp *EnrollResponse, privKey crypto.PrivateKey) (
+	*x509.Certificate, []byte, error) {
+
+	block, _ := pem.Decode([]byte(resp.Cert))
+	if block == nil {
+		return nil, nil, errors.New("no cert in response")
+	}
+	cert, err := parseCertificateDER(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pubKey, err := bcx509.MarshalPKIXPublicKey(privKey.PublicKey().ToStandardKey())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(pubKey, cert.RawSubjectPublicKeyInfo) {
+		return nil, nil, errors.New("issued cert does not match the key")
+	}
+
+	caCertPEM := []byte(resp.CACert)
+	if block, _ = pem.Decode(caCertPEM); block == nil {
+		return nil, nil, errors.New("no CA cert in response")
+	}
+	return cert, caCertPEM, nil
+}
+
+// renewAt returns when the cert is due for renewal
+func (c *EnrollClient) renewAt() time.Time {
+	cert := c.Certificate()
+	if cert == nil {
+		return time.Now()
+	}
+	renewBefore := c.cfg.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = cert.NotAfter.Sub(cert.NotBefore) / 3
+	}
+	return cert.NotAfter.Add(-renewBefore)
+}
+
+// AutoRenew renews the cert when it is due until Stop is called, a failed
+// renewal being retried every RetryInterval. onRenew, if not nil, is called
+// with the result of each renewal, so that the failures can be reported.
+func (c *EnrollClient) AutoRenew(onRenew func(cert *x509.Certificate, err error)) {
+	go func() {
+		wait := time.Until(c.renewAt())
+		for {
+			timer := time.NewTimer(wait)
+			select {
+			case <-c.stopC:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			cert, err := c.Renew()
+			if onRenew != nil {
+				onRenew(cert, err)
+			}
+			wait = time.Until(c.renewAt())
+			if wait < c.cfg.RetryInterval {
+				wait = c.cfg.RetryInterval
+			}
+		}
+	}()
+}
+
+// Stop stops renewing the cert
+func (c *EnrollClient) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopC)
+	})
+}
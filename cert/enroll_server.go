@@ -0,0 +1,193 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	bcx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+)
+
+const (
+	enrollPath = "/enroll"
+	renewPath  = "/renew"
+
+	maxEnrollRequestSize = 1 << 20
+)
+
+// ErrEnrollUnauthorized results when an enrollment token, or the certificate
+// and signature of a renewal, are rejected
+var ErrEnrollUnauthorized = errors.New("enrollment unauthorized")
+
+// EnrollRequest the request of a first enrollment, or of a renewal
+type EnrollRequest struct {
+	// CSR the PEM CSR of the key to certify, whose signature proves its possession
+	CSR     string   `json:"csr"`
+	Profile Profile  `json:"profile,omitempty"`
+	Sans    []string `json:"sans,omitempty"`
+	// Token authorizes a first enrollment
+	Token string `json:"token,omitempty"`
+	// Cert the PEM certificate being renewed, and Signature the signature of
+	// the DER CSR by its key, which authorize a renewal
+	Cert      string `json:"cert,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// EnrollResponse the issued certificate and the one of its CA
+type EnrollResponse struct {
+	Cert   string `json:"cert"`
+	CACert string `json:"ca_cert"`
+}
+
+// EnrollServer serves the enrollments and renewals of the certificates of an
+// Authority over HTTP, POST /enroll and POST /renew
+type EnrollServer struct {
+	authority  *Authority
+	checkToken func(req *EnrollRequest, csr *bcx509.CertificateRequest) error
+	mux        *http.ServeMux
+}
+
+// NewEnrollServer returns the server of the authority. checkToken authorizes
+// the first enrollments, from the token, profile and sans of the request and
+// the subject and key of its parsed CSR. The renewals are authorized by the
+// certificates being renewed, keeping their subject, profile and sans.
+func NewEnrollServer(authority *Authority,
+	checkToken func(req *EnrollRequest, csr *bcx509.CertificateRequest) error) *EnrollServer {
+	s := &EnrollServer{
+		authority:  authority,
+		checkToken: checkToken,
+		mux:        http.NewServeMux(),
+	}
+	s.mux.HandleFunc(enrollPath, s.handle(s.enroll))
+	s.mux.HandleFunc(renewPath, s.handle(s.renew))
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *EnrollServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *EnrollServer) handle(issue func(req *EnrollRequest) (*x509.Certificate, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req EnrollRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxEnrollRequestSize)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("json unmarshal request failed, %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		cert, err := issue(&req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrEnrollUnauthorized) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&EnrollResponse{
+			Cert:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+			CACert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.authority.CACert().Raw})),
+		})
+	}
+}
+
+func (s *EnrollServer) enroll(req *EnrollRequest) (*x509.Certificate, error) {
+	if s.checkToken == nil {
+		return nil, fmt.Errorf("%w, no token accepted", ErrEnrollUnauthorized)
+	}
+	csr, err := parseCSR([]byte(req.CSR))
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkToken(req, csr); err != nil {
+		return nil, fmt.Errorf("%w, %s", ErrEnrollUnauthorized, err.Error())
+	}
+
+	return s.authority.Issue(&IssueConfig{
+		CSR:     []byte(req.CSR),
+		Profile: req.Profile,
+		Sans:    req.Sans,
+	})
+}
+
+func (s *EnrollServer) renew(req *EnrollRequest) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(req.Cert))
+	if block == nil {
+		return nil, fmt.Errorf("%w, no cert to renew", ErrEnrollUnauthorized)
+	}
+	cert, err := bcx509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w, ParseCertificate cert failed, %s", ErrEnrollUnauthorized, err)
+	}
+
+	// the certificate is one of the authority, still valid
+	record, err := s.authority.Certificate(cert.SerialNumber)
+	if err != nil || !bytes.Equal(record.Raw, cert.Raw) {
+		return nil, fmt.Errorf("%w, cert [%s] not issued by the CA", ErrEnrollUnauthorized, cert.SerialNumber)
+	}
+	if record.Revoked {
+		return nil, fmt.Errorf("%w, cert [%s] revoked", ErrEnrollUnauthorized, cert.SerialNumber)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return nil, fmt.Errorf("%w, cert [%s] expired", ErrEnrollUnauthorized, cert.SerialNumber)
+	}
+
+	// the renewal is signed by its key, for the same subject
+	csr, err := parseCSR([]byte(req.CSR))
+	if err != nil {
+		return nil, err
+	}
+	ok, err := cert.PublicKey.VerifyWithOpts(csr.Raw, req.Signature, enrollSignOpts(cert.PublicKey.Type()))
+	if err != nil || !ok {
+		return nil, fmt.Errorf("%w, invalid renewal signature of cert [%s]", ErrEnrollUnauthorized, cert.SerialNumber)
+	}
+	policy, ok := s.authority.policies[record.Profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile [%s]", record.Profile)
+	}
+	if subject := issueSubject(csr, policy); subject.String() != cert.Subject.String() {
+		return nil, fmt.Errorf("%w, csr subject [%s] differs from the one of cert [%s]",
+			ErrEnrollUnauthorized, subject, cert.SerialNumber)
+	}
+
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return s.authority.Issue(&IssueConfig{
+		CSR:     []byte(req.CSR),
+		Profile: record.Profile,
+		Sans:    sans,
+	})
+}
+
+// enrollSignOpts the options of the signatures of the renewals, by the keys of the certificates being renewed
+func enrollSignOpts(keyType crypto.KeyType) *crypto.SignOpts {
+	if keyType == crypto.SM2 {
+		return &crypto.SignOpts{Hash: crypto.HASH_TYPE_SM3, UID: crypto.CRYPTO_DEFAULT_UID}
+	}
+	return &crypto.SignOpts{Hash: crypto.HASH_TYPE_SHA256}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cert
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	tlsconfig "chainmaker.org/chainmaker/common/v2/crypto/tls/config"
+	bcx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+	"github.com/stretchr/testify/require"
+)
+
+const testEnrollToken = "enroll-token"
+
+func newTestEnrollServer(t *testing.T, keyType crypto.KeyType, hashType crypto.HashType) (*Authority, string) {
+	authority := newTestAuthority(t, t.TempDir(), keyType, hashType)
+	checkToken := func(req *EnrollRequest, csr *bcx509.CertificateRequest) error {
+		if req.Token != testEnrollToken || (req.Profile != ProfileTLS && req.Profile != ProfileClient) {
+			return errors.New("invalid token")
+		}
+		// the token is restricted to the names of the domain
+		if !strings.HasSuffix(csr.Subject.CommonName, ".chainmaker.org") {
+			return errors.New("common name not allowed")
+		}
+		return nil
+	}
+	server := httptest.NewServer(NewEnrollServer(authority, checkToken))
+	t.Cleanup(server.Close)
+	return authority, server.URL
+}
+
+func TestEnrollClient(t *testing.T) {
+	for _, keyType := range []crypto.KeyType{crypto.SM2, crypto.ECC_NISTP256} {
+		hashType := crypto.HASH_TYPE_SHA256
+		if keyType == crypto.SM2 {
+			hashType = crypto.HASH_TYPE_SM3
+		}
+		authority, serverURL := newTestEnrollServer(t, keyType, hashType)
+		dir := t.TempDir()
+		cfg := &EnrollClientConfig{
+			ServerURL:       serverURL,
+			Token:           "invalid",
+			Profile:         ProfileTLS,
+			Sans:            []string{"127.0.0.1", "consensus1.chainmaker.org"},
+			KeyType:         keyType,
+			CertPath:        dir,
+			CertFileName:    "tls.crt",
+			PrivKeyFileName: "tls.key",
+			CACertFileName:  "ca.crt",
+			CommonName:      "consensus1.chainmaker.org",
+		}
+		certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+		// the token authorizes the first enrollment
+		client, err := NewEnrollClient(cfg)
+		require.NoError(t, err)
+		_, err = client.Enroll()
+		require.Contains(t, err.Error(), "403")
+		_, err = client.Renew()
+		require.Error(t, err)
+		cfg.Token = testEnrollToken
+		client, err = NewEnrollClient(cfg)
+		require.NoError(t, err)
+		enrolled, err := client.Enroll()
+		require.NoError(t, err)
+		require.Equal(t, cfg.CommonName, enrolled.Subject.CommonName)
+
+		// the files are those of the TLS reload path
+		provider, err := tlsconfig.NewCertProvider(certFile, keyFile, "", "", filepath.Join(dir, "ca.crt"))
+		require.NoError(t, err)
+		require.Equal(t, enrolled.Raw, provider.Certificates()[0].Certificate[0])
+
+		// a renewal certifies a new key, with the profile and sans of the cert
+		key, err := ioutil.ReadFile(keyFile)
+		require.NoError(t, err)
+		client, err = NewEnrollClient(cfg)
+		require.NoError(t, err)
+		require.Equal(t, enrolled.Raw, client.Certificate().Raw)
+		renewed, err := client.Renew()
+		require.NoError(t, err)
+		require.NotEqual(t, enrolled.SerialNumber, renewed.SerialNumber)
+		require.Equal(t, enrolled.DNSNames, renewed.DNSNames)
+		require.Equal(t, enrolled.ExtKeyUsage, renewed.ExtKeyUsage)
+		renewedKey, err := ioutil.ReadFile(keyFile)
+		require.NoError(t, err)
+		require.NotEqual(t, key, renewedKey)
+		require.NoError(t, provider.Reload())
+		require.Equal(t, renewed.Raw, provider.Certificates()[0].Certificate[0])
+
+		// the cert is renewed when due, not once revoked
+		cfg.RenewBefore = 24 * 365 * 24 * time.Hour
+		cfg.RetryInterval = 10 * time.Millisecond
+		client, err = NewEnrollClient(cfg)
+		require.NoError(t, err)
+		renewedC := make(chan error, 16)
+		client.AutoRenew(func(cert *x509.Certificate, err error) {
+			renewedC <- err
+		})
+		require.NoError(t, waitRenew(t, renewedC))
+		require.NotEqual(t, renewed.SerialNumber, client.Certificate().SerialNumber)
+		require.NoError(t, authority.Revoke(client.Certificate().SerialNumber, 1))
+		require.Contains(t, waitRenew(t, renewedC).Error(), "revoked")
+		client.Stop()
+	}
+}
+
+func TestEnrollClient_PrivKey(t *testing.T) {
+	_, serverURL := newTestEnrollServer(t, crypto.ECC_NISTP256, crypto.HASH_TYPE_SHA256)
+	dir := t.TempDir()
+	privKey, err := CreatePrivKey(crypto.ECC_NISTP256, dir, "tls.key", true)
+	require.NoError(t, err)
+	client, err := NewEnrollClient(&EnrollClientConfig{
+		ServerURL:    serverURL,
+		Token:        testEnrollToken,
+		Profile:      ProfileTLS,
+		PrivKey:      privKey,
+		CertPath:     dir,
+		CertFileName: "tls.crt",
+		CommonName:   "client1.chainmaker.org",
+	})
+	require.NoError(t, err)
+
+	// the configured key is certified by each renewal
+	enrolled, err := client.Enroll()
+	require.NoError(t, err)
+	renewed, err := client.Renew()
+	require.NoError(t, err)
+	require.Equal(t, enrolled.RawSubjectPublicKeyInfo, renewed.RawSubjectPublicKeyInfo)
+	_, err = tlsconfig.NewCertProvider(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "", "")
+	require.NoError(t, err)
+}
+
+func TestEnrollServer_Subject(t *testing.T) {
+	_, serverURL := newTestEnrollServer(t, crypto.ECC_NISTP256, crypto.HASH_TYPE_SHA256)
+	cfg := &EnrollClientConfig{
+		ServerURL:       serverURL,
+		Token:           testEnrollToken,
+		Profile:         ProfileClient,
+		KeyType:         crypto.ECC_NISTP256,
+		CertPath:        t.TempDir(),
+		CertFileName:    "tls.crt",
+		PrivKeyFileName: "tls.key",
+		Organization:    "org1",
+		CommonName:      "node.example.org",
+	}
+
+	// the token checker sees the subject of the csr
+	client, err := NewEnrollClient(cfg)
+	require.NoError(t, err)
+	_, err = client.Enroll()
+	require.Contains(t, err.Error(), "common name not allowed")
+
+	// the OU is the one of the profile, whatever the csr
+	cfg.CommonName = "node1.chainmaker.org"
+	cfg.OrganizationalUnit = "admin"
+	client, err = NewEnrollClient(cfg)
+	require.NoError(t, err)
+	enrolled, err := client.Enroll()
+	require.NoError(t, err)
+	cfg.OrganizationalUnit = "consensus"
+	client, err = NewEnrollClient(cfg)
+	require.NoError(t, err)
+	renewed, err := client.Renew()
+	require.NoError(t, err)
+	require.Equal(t, enrolled.Subject.String(), renewed.Subject.String())
+
+	// a renewal keeps the rest of the subject
+	cfg.Organization = "org2"
+	client, err = NewEnrollClient(cfg)
+	require.NoError(t, err)
+	_, err = client.Renew()
+	require.Contains(t, err.Error(), "403")
+}
+
+// waitRenew returns the result of the next renewal
+func waitRenew(t *testing.T, renewed <-chan error) error {
+	select {
+	case err := <-renewed:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cert was not renewed")
+		return nil
+	}
+}
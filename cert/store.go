@@ -0,0 +1,212 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	serialFileName = "serial"
+	indexFileName  = "index.json"
+)
+
+// ErrCertNotFound results when the store has no certificate of a serial number
+var ErrCertNotFound = errors.New("certificate not found")
+
+// CertRecord the index entry of an issued certificate
+type CertRecord struct {
+	SerialNumber *big.Int  `json:"serial_number"`
+	Profile      Profile   `json:"profile"`
+	Subject      string    `json:"subject"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	// Raw the DER certificate
+	Raw []byte `json:"raw"`
+
+	Revoked   bool      `json:"revoked"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+	// Reason the CRLReason of RFC 5280, Section 5.3.1
+	Reason int `json:"reason,omitempty"`
+}
+
+// Store keeps the serial numbers and the index of the certificates issued by an Authority
+type Store interface {
+	// NextSerial returns a serial number never returned before
+	NextSerial() (*big.Int, error)
+	// Put adds the record, or replaces the one of the same serial number
+	Put(record *CertRecord) error
+	// Get returns the record of the serial number, or ErrCertNotFound
+	Get(serial *big.Int) (*CertRecord, error)
+	// List returns the records by serial number
+	List() ([]*CertRecord, error)
+}
+
+// FileStore a Store keeping the next serial number and the index in the files
+// of a directory, which are rewritten atomically on each change
+type FileStore struct {
+	dir string
+
+	mu      sync.Mutex
+	serial  *big.Int
+	records map[string]*CertRecord
+}
+
+// NewFileStore opens the store of the directory, which is created if missing
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("mk store dir failed, %s", err.Error())
+	}
+	s := &FileStore{
+		dir:     dir,
+		serial:  big.NewInt(1),
+		records: make(map[string]*CertRecord),
+	}
+
+	serialRaw, err := ioutil.ReadFile(filepath.Join(dir, serialFileName))
+	if err == nil {
+		if _, ok := s.serial.SetString(strings.TrimSpace(string(serialRaw)), 16); !ok {
+			return nil, fmt.Errorf("invalid serial file [%s]", filepath.Join(dir, serialFileName))
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read serial file failed, %s", err.Error())
+	}
+
+	indexRaw, err := ioutil.ReadFile(filepath.Join(dir, indexFileName))
+	if err == nil {
+		var records []*CertRecord
+		if err = json.Unmarshal(indexRaw, &records); err != nil {
+			return nil, fmt.Errorf("json unmarshal index failed, %s", err.Error())
+		}
+		for _, record := range records {
+			s.records[record.SerialNumber.String()] = record
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read index file failed, %s", err.Error())
+	}
+
+	return s, nil
+}
+
+// NextSerial implements Store
+func (s *FileStore) NextSerial() (*big.Int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	serial := new(big.Int).Set(s.serial)
+	next := new(big.Int).Add(serial, big.NewInt(1))
+	if err := writeFileAtomic(filepath.Join(s.dir, serialFileName), []byte(next.Text(16)+"\n")); err != nil {
+		return nil, err
+	}
+	s.serial = next
+	return serial, nil
+}
+
+// Put implements Store
+func (s *FileStore) Put(record *CertRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := record.SerialNumber.String()
+	old := s.records[key]
+	s.records[key] = record
+	if err := s.writeIndex(); err != nil {
+		if old != nil {
+			s.records[key] = old
+		} else {
+			delete(s.records, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Get implements Store
+func (s *FileStore) Get(serial *big.Int) (*CertRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[serial.String()]
+	if !ok {
+		return nil, ErrCertNotFound
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// List implements Store
+func (s *FileStore) List() ([]*CertRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(), nil
+}
+
+func (s *FileStore) list() []*CertRecord {
+	records := make([]*CertRecord, 0, len(s.records))
+	for _, record := range s.records {
+		copied := *record
+		records = append(records, &copied)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].SerialNumber.Cmp(records[j].SerialNumber) < 0
+	})
+	return records
+}
+
+func (s *FileStore) writeIndex() error {
+	indexRaw, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("json marshal index failed, %s", err.Error())
+	}
+	return writeFileAtomic(filepath.Join(s.dir, indexFileName), indexRaw)
+}
+
+// writeFileAtomic replaces the file with a renamed temporary one, so that its
+// readers never see it partially written, and syncs both to survive a crash
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("write file [%s] failed, %s", tmpPath, err.Error())
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write file [%s] failed, %s", tmpPath, err.Error())
+	}
+	return renameFileSync(tmpPath, path)
+}
+
+// renameFileSync renames the file, and syncs its directory so that the rename is durable
+func renameFileSync(oldPath, path string) error {
+	if err := os.Rename(oldPath, path); err != nil {
+		return fmt.Errorf("rename file [%s] failed, %s", path, err.Error())
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("sync dir of file [%s] failed, %s", path, err.Error())
+	}
+	defer dir.Close()
+	if err = dir.Sync(); err != nil {
+		return fmt.Errorf("sync dir of file [%s] failed, %s", path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// certlint checks that the certificates of the members of a chain follow its
+// rules: key type, role OU, key identifiers, validity period and SANs. It
+// exits with status 1 when a certificate has an error finding.
+//
+//	certlint [-key-types SM2,ECC_P256] [-ous consensus,common,client,light,admin]
+//	         [-max-validity 87600h] [-max-ca-validity 175200h] [-json] <cert.pem>...
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"chainmaker.org/chainmaker/common/v2/crypto/x509"
+)
+
+// fileReport the reports of the certificates of a file
+type fileReport struct {
+	File    string             `json:"file"`
+	Reports []*x509.LintReport `json:"reports"`
+}
+
+func main() {
+	fs := flag.NewFlagSet("certlint", flag.ExitOnError)
+	keyTypes := fs.String("key-types", "", "comma separated key types allowed by the chain, e.g. SM2,ECC_P256")
+	ous := fs.String("ous", strings.Join(x509.DefaultLintOUs, ","),
+		"comma separated OUs allowed for the end-entity certificates")
+	maxValidity := fs.Duration("max-validity", 0, "longest validity of the end-entity certificates, 10 years if 0")
+	maxCAValidity := fs.Duration("max-ca-validity", 0, "longest validity of the CA certificates, 20 years if 0")
+	jsonOutput := fs.Bool("json", false, "print the reports as JSON")
+	fs.Usage = usage
+	_ = fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	opts := &x509.LintOptions{
+		OrganizationalUnits: splitList(*ous),
+		MaxValidity:         *maxValidity,
+		MaxCAValidity:       *maxCAValidity,
+	}
+	var err error
+	if opts.KeyTypes, err = parseKeyTypes(*keyTypes); err != nil {
+		fmt.Fprintln(os.Stderr, "certlint:", err)
+		os.Exit(2)
+	}
+
+	failed, err := lint(fs.Args(), opts, *jsonOutput)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "certlint:", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  certlint [-key-types SM2,ECC_P256] [-ous consensus,common,client,light,admin]")
+	fmt.Fprintln(os.Stderr, "           [-max-validity 87600h] [-max-ca-validity 175200h] [-json] <cert.pem>...")
+}
+
+// lint prints the reports of the files, and returns whether one has an error finding
+func lint(files []string, opts *x509.LintOptions, jsonOutput bool) (bool, error) {
+	linter := x509.NewLinter()
+	failed := false
+	fileReports := make([]*fileReport, 0, len(files))
+	for _, file := range files {
+		certPEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		reports, err := linter.LintPEM(certPEM, opts)
+		if err != nil {
+			return false, fmt.Errorf("%s: %s", file, err.Error())
+		}
+		for _, report := range reports {
+			failed = failed || report.Errors > 0
+		}
+		fileReports = append(fileReports, &fileReport{File: file, Reports: reports})
+	}
+
+	if jsonOutput {
+		out, err := json.MarshalIndent(fileReports, "", "  ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Println(string(out))
+		return failed, nil
+	}
+	for _, fr := range fileReports {
+		for _, report := range fr.Reports {
+			fmt.Printf("%s: %s\n", fr.File, report)
+		}
+	}
+	return failed, nil
+}
+
+// parseKeyTypes parses the key types of the chain config, e.g. ECC_P256, or of the crypto package, e.g. ECC_NISTP256
+func parseKeyTypes(list string) ([]crypto.KeyType, error) {
+	var keyTypes []crypto.KeyType
+	for _, name := range splitList(list) {
+		keyType, ok := lookupKeyType(crypto.AsymAlgoMap, name)
+		if !ok {
+			keyType, ok = lookupKeyType(crypto.Name2KeyTypeMap, name)
+		}
+		if !ok {
+			return nil, errors.New("unknown key type " + name)
+		}
+		keyTypes = append(keyTypes, keyType)
+	}
+	return keyTypes, nil
+}
+
+func lookupKeyType(keyTypes map[string]crypto.KeyType, name string) (crypto.KeyType, bool) {
+	for algo, keyType := range keyTypes {
+		if strings.EqualFold(algo, name) {
+			return keyType, true
+		}
+	}
+	return 0, false
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// walctl verifies and repairs write ahead logs offline, for example the
+// tx_filter or consensus WAL directories of a node after a disk-full or
+// power-loss incident. The node must be stopped while walctl runs.
+//
+//	walctl verify -path <dir> [-format binary|json]
+//	walctl repair -path <dir> -backup <dir> [-format binary|json]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"chainmaker.org/chainmaker/common/v2/wal"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	corrupt := false
+	switch os.Args[1] {
+	case "verify":
+		corrupt, err = verify(os.Args[2:])
+	case "repair":
+		err = repair(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "walctl:", err)
+		os.Exit(1)
+	}
+	if corrupt {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  walctl verify -path <dir> [-format binary|json]")
+	fmt.Fprintln(os.Stderr, "  walctl repair -path <dir> -backup <dir> [-format binary|json]")
+}
+
+func verify(args []string) (bool, error) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	path := fs.String("path", "", "directory of the log")
+	format := fs.String("format", "binary", "format of segments without a header, binary or json")
+	_ = fs.Parse(args)
+	opts, err := options(*path, *format)
+	if err != nil {
+		return false, err
+	}
+	report, err := wal.Verify(*path, opts)
+	if err != nil {
+		return false, err
+	}
+	fmt.Println(report)
+	return report.Corrupt, nil
+}
+
+func repair(args []string) error {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	path := fs.String("path", "", "directory of the log")
+	backup := fs.String("backup", "", "directory receiving the original files of truncated segments")
+	format := fs.String("format", "binary", "format of segments without a header, binary or json")
+	_ = fs.Parse(args)
+	opts, err := options(*path, *format)
+	if err != nil {
+		return err
+	}
+	if *backup == "" {
+		return errors.New("backup directory is required")
+	}
+	report, err := wal.Repair(*path, *backup, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+	if report.Corrupt {
+		fmt.Printf("truncated after index %d, original segments copied to %s\n", report.LastIndex, *backup)
+	}
+	return nil
+}
+
+func options(path, format string) (*wal.Options, error) {
+	if path == "" {
+		return nil, errors.New("path is required")
+	}
+	opts := *wal.DefaultOptions
+	switch format {
+	case "binary":
+		opts.LogFormat = wal.Binary
+	case "json":
+		opts.LogFormat = wal.JSON
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+	return &opts, nil
+}
@@ -11,6 +11,9 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"hash"
+	"io"
+	"runtime"
+	"sync"
 
 	"chainmaker.org/chainmaker/common/v2/crypto"
 	"github.com/tjfoc/gmsm/sm3"
@@ -22,21 +25,11 @@ type Hash struct {
 }
 
 func (h *Hash) Get(data []byte) ([]byte, error) {
-	var hf func() hash.Hash
-
-	switch h.hashType {
-	case crypto.HASH_TYPE_SM3:
-		hf = sm3.New
-	case crypto.HASH_TYPE_SHA256:
-		hf = sha256.New
-	case crypto.HASH_TYPE_SHA3_256:
-		hf = sha3.New256
-	default:
-		return nil, fmt.Errorf("unknown hash algorithm")
+	f, err := NewHasher(h.hashType)
+	if err != nil {
+		return nil, err
 	}
 
-	f := hf()
-
 	f.Write(data)
 	return f.Sum(nil), nil
 }
@@ -56,6 +49,12 @@ func GetByStrType(hashType string, data []byte) ([]byte, error) {
 }
 
 func GetHashAlgorithm(hashType crypto.HashType) (hash.Hash, error) {
+	return NewHasher(hashType)
+}
+
+// NewHasher returns a streaming hasher of hashType: write the data in pieces (e.g. with io.Copy)
+// and get the digest with Sum(nil), so large inputs need not be loaded in memory
+func NewHasher(hashType crypto.HashType) (hash.Hash, error) {
 	switch hashType {
 	case crypto.HASH_TYPE_SM3:
 		return sm3.New(), nil
@@ -67,3 +66,57 @@ func GetHashAlgorithm(hashType crypto.HashType) (hash.Hash, error) {
 		return nil, fmt.Errorf("unknown hash algorithm")
 	}
 }
+
+// GetFromReader hashes the data read from r until EOF
+func GetFromReader(hashType crypto.HashType, r io.Reader) ([]byte, error) {
+	f, err := NewHasher(hashType)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		return nil, err
+	}
+	return f.Sum(nil), nil
+}
+
+// HashBatch hashes each data with parallelism goroutines, runtime.NumCPU() if parallelism <= 0.
+// The digests are in the order of data
+func HashBatch(hashType crypto.HashType, data [][]byte, parallelism int) ([][]byte, error) {
+	if _, err := NewHasher(hashType); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return [][]byte{}, nil
+	}
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	if parallelism > len(data) {
+		parallelism = len(data)
+	}
+	var (
+		digests = make([][]byte, len(data))
+		// each goroutine hashes a contiguous chunk of data
+		chunk = (len(data) + parallelism - 1) / parallelism
+		wg    sync.WaitGroup
+	)
+	for start := 0; start < len(data); start += chunk {
+		end := start + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			// the hash type is checked above
+			f, _ := NewHasher(hashType)
+			for i := start; i < end; i++ {
+				f.Reset()
+				f.Write(data[i])
+				digests[i] = f.Sum(nil)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return digests, nil
+}
@@ -8,8 +8,11 @@ SPDX-License-Identifier: Apache-2.0
 package hash
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"strconv"
 	"testing"
 	"time"
 
@@ -66,3 +69,46 @@ func TestGetHashSpeed(t *testing.T) {
 	}
 	t.Logf("wrapped hash. hash times: %d, time elapses: %s", hashTimes, time.Since(now))
 }
+
+func TestNewHasher(t *testing.T) {
+	data := bytes.Repeat([]byte("chainmaker"), 100000)
+	for _, hashType := range []crypto.HashType{crypto.HASH_TYPE_SM3, crypto.HASH_TYPE_SHA256,
+		crypto.HASH_TYPE_SHA3_256} {
+		expect, err := Get(hashType, data)
+		require.Nil(t, err)
+
+		hasher, err := NewHasher(hashType)
+		require.Nil(t, err)
+		_, err = io.CopyBuffer(hasher, bytes.NewReader(data), make([]byte, 4096))
+		require.Nil(t, err)
+		require.Equal(t, expect, hasher.Sum(nil))
+
+		digest, err := GetFromReader(hashType, bytes.NewReader(data))
+		require.Nil(t, err)
+		require.Equal(t, expect, digest)
+	}
+	_, err := NewHasher(crypto.HashType(0))
+	require.NotNil(t, err)
+}
+
+func TestHashBatch(t *testing.T) {
+	data := make([][]byte, 1000)
+	for i := range data {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	for _, parallelism := range []int{0, 1, 3, 2000} {
+		digests, err := HashBatch(crypto.HASH_TYPE_SM3, data, parallelism)
+		require.Nil(t, err)
+		require.Equal(t, len(data), len(digests))
+		for i := range data {
+			expect, err := Get(crypto.HASH_TYPE_SM3, data[i])
+			require.Nil(t, err)
+			require.Equal(t, expect, digests[i])
+		}
+	}
+	digests, err := HashBatch(crypto.HASH_TYPE_SHA256, nil, 0)
+	require.Nil(t, err)
+	require.Empty(t, digests)
+	_, err = HashBatch(crypto.HashType(0), data, 0)
+	require.NotNil(t, err)
+}
@@ -14,6 +14,9 @@ import (
 	"chainmaker.org/chainmaker/common/v2/crypto"
 )
 
+// merkleBatchThreshold leaf count from which GetMerkleRoot hashes each level with HashBatch
+const merkleBatchThreshold = 1024
+
 // nolint: deadcode,unused
 var h = sha256.New()
 
@@ -21,6 +24,9 @@ func GetMerkleRoot(hashType string, hashes [][]byte) ([]byte, error) {
 	if len(hashes) == 0 {
 		return nil, nil
 	}
+	if len(hashes) >= merkleBatchThreshold {
+		return getMerkleRootByBatch(crypto.HashAlgoMap[hashType], hashes)
+	}
 
 	merkleTree, err := BuildMerkleTree(hashType, hashes)
 	if err != nil {
@@ -29,6 +35,32 @@ func GetMerkleRoot(hashType string, hashes [][]byte) ([]byte, error) {
 	return merkleTree[len(merkleTree)-1], nil
 }
 
+// getMerkleRootByBatch computes the root of BuildMerkleTree level by level, the nodes of a
+// level are hashed in parallel
+func getMerkleRootByBatch(hashType crypto.HashType, hashes [][]byte) ([]byte, error) {
+	var err error
+	level := hashes
+	for width := getNextPowerOfTwo(len(hashes)); width > 1; width /= 2 {
+		branches := make([][]byte, (len(level)+1)/2)
+		for i := range branches {
+			left, right := level[2*i], level[2*i]
+			if 2*i+1 < len(level) {
+				right = level[2*i+1]
+			}
+			// hash(left, left) if right is nil
+			branch := make([]byte, len(left)+len(right))
+			copy(branch, left)
+			copy(branch[len(left):], right)
+			branches[i] = branch
+		}
+		level, err = HashBatch(hashType, branches, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return level[0], nil
+}
+
 // take leaf node hash array and build merkle tree
 func BuildMerkleTree(hashType string, hashes [][]byte) ([][]byte, error) {
 	var hasher = Hash{
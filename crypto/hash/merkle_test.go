@@ -83,3 +83,17 @@ func TestGetMerklePath(t *testing.T) {
 func CurrentTimeMillisSeconds() int64 {
 	return time.Now().UnixNano() / 1e6
 }
+
+func TestGetMerkleRootByBatch(t *testing.T) {
+	for _, count := range []int{merkleBatchThreshold, merkleBatchThreshold + 1, 3000} {
+		hashes := make([][]byte, count)
+		for i := 0; i < count; i++ {
+			hashes[i] = []byte(uuid.GetUUID())
+		}
+		merkleTree, err := BuildMerkleTree(SHA256, hashes)
+		require.Nil(t, err)
+		root, err := GetMerkleRoot(SHA256, hashes)
+		require.Nil(t, err)
+		require.Equal(t, merkleTree[len(merkleTree)-1], root, "count %v", count)
+	}
+}
@@ -0,0 +1,356 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package hash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sync"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+)
+
+// RFC 6962 domain separation prefixes of the leaf and node hashes
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+var (
+	ErrMerkleIndexOutOfRange = errors.New("merkle leaf index out of range")
+	ErrMerkleSizeOutOfRange  = errors.New("merkle tree size out of range")
+	ErrInvalidMerkleProof    = errors.New("invalid merkle proof")
+)
+
+// MerkleTree is an append-only Merkle tree in the RFC 6962 style. Unlike BuildMerkleTree,
+// the leaves are not padded to a power of two, leaves and nodes are hashed with distinct
+// prefixes, and the proofs address leaves by index, so duplicate leaves are told apart.
+// The proofs are checked by VerifyInclusion and VerifyConsistency without the tree.
+type MerkleTree struct {
+	mu     sync.RWMutex
+	hasher Hash
+	// levels[l][i] is the hash of the complete subtree of 2^l leaves starting at leaf i<<l,
+	// levels[0] holds the leaf hashes
+	levels [][][]byte
+}
+
+// NewMerkleTree creates an empty tree hashing with hashType
+func NewMerkleTree(hashType crypto.HashType) (*MerkleTree, error) {
+	if _, err := GetHashAlgorithm(hashType); err != nil {
+		return nil, err
+	}
+	return &MerkleTree{
+		hasher: Hash{hashType: hashType},
+		levels: [][][]byte{nil},
+	}, nil
+}
+
+// Append adds a leaf and returns its index
+func (t *MerkleTree) Append(leaf []byte) (int, error) {
+	leafHash, err := hashMerkleLeaf(t.hasher, leaf)
+	if err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	index := len(t.levels[0])
+	t.levels[0] = append(t.levels[0], leafHash)
+	// complete the subtrees ending at the new leaf
+	for l, i := 0, index; i&1 == 1; l, i = l+1, i>>1 {
+		node, err := hashMerkleNode(t.hasher, t.levels[l][i-1], t.levels[l][i])
+		if err != nil {
+			return 0, err
+		}
+		if len(t.levels) == l+1 {
+			t.levels = append(t.levels, nil)
+		}
+		t.levels[l+1] = append(t.levels[l+1], node)
+	}
+	return index, nil
+}
+
+// Size returns the number of leaves
+func (t *MerkleTree) Size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.levels[0])
+}
+
+// Root returns the root of the tree, the hash of the empty string if the tree is empty
+func (t *MerkleTree) Root() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.subtreeHash(0, len(t.levels[0]))
+}
+
+// RootAt returns the root the tree had when it held size leaves
+func (t *MerkleTree) RootAt(size int) ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if size < 0 || size > len(t.levels[0]) {
+		return nil, ErrMerkleSizeOutOfRange
+	}
+	return t.subtreeHash(0, size)
+}
+
+// LeafHash returns the hash of the leaf at index
+func (t *MerkleTree) LeafHash(index int) ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if index < 0 || index >= len(t.levels[0]) {
+		return nil, ErrMerkleIndexOutOfRange
+	}
+	return t.levels[0][index], nil
+}
+
+// InclusionProof returns the audit path of the leaf at index in the current tree,
+// see VerifyInclusion
+func (t *MerkleTree) InclusionProof(index int) ([][]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.inclusionProof(index, len(t.levels[0]))
+}
+
+// InclusionProofAt returns the audit path of the leaf at index in the tree of size leaves
+func (t *MerkleTree) InclusionProofAt(index, size int) ([][]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if size < 0 || size > len(t.levels[0]) {
+		return nil, ErrMerkleSizeOutOfRange
+	}
+	return t.inclusionProof(index, size)
+}
+
+// ConsistencyProof returns the proof that the tree of newSize leaves extends the tree of
+// oldSize leaves, 0 < oldSize <= newSize <= Size(), see VerifyConsistency
+func (t *MerkleTree) ConsistencyProof(oldSize, newSize int) ([][]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if oldSize <= 0 || oldSize > newSize || newSize > len(t.levels[0]) {
+		return nil, ErrMerkleSizeOutOfRange
+	}
+	proof := make([][]byte, 0, 2*bits.Len(uint(newSize)))
+	return t.subproof(proof, oldSize, 0, newSize, true)
+}
+
+func (t *MerkleTree) inclusionProof(index, size int) ([][]byte, error) {
+	if index < 0 || index >= size {
+		return nil, ErrMerkleIndexOutOfRange
+	}
+	proof := make([][]byte, 0, bits.Len(uint(size)))
+	return t.path(proof, index, 0, size)
+}
+
+// path is PATH(m, D[start:end]) of RFC 6962, m relative to start
+func (t *MerkleTree) path(proof [][]byte, m, start, end int) ([][]byte, error) {
+	if end-start <= 1 {
+		return proof, nil
+	}
+	k := splitPoint(end - start)
+	var (
+		sibling []byte
+		err     error
+	)
+	if m < k {
+		proof, err = t.path(proof, m, start, start+k)
+		if err != nil {
+			return nil, err
+		}
+		sibling, err = t.subtreeHash(start+k, end)
+	} else {
+		proof, err = t.path(proof, m-k, start+k, end)
+		if err != nil {
+			return nil, err
+		}
+		sibling, err = t.subtreeHash(start, start+k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+// subproof is SUBPROOF(m, D[start:end], b) of RFC 6962, m relative to start
+func (t *MerkleTree) subproof(proof [][]byte, m, start, end int, complete bool) ([][]byte, error) {
+	n := end - start
+	if m == n {
+		if complete {
+			return proof, nil
+		}
+		root, err := t.subtreeHash(start, end)
+		if err != nil {
+			return nil, err
+		}
+		return append(proof, root), nil
+	}
+	k := splitPoint(n)
+	var (
+		sibling []byte
+		err     error
+	)
+	if m <= k {
+		proof, err = t.subproof(proof, m, start, start+k, complete)
+		if err != nil {
+			return nil, err
+		}
+		sibling, err = t.subtreeHash(start+k, end)
+	} else {
+		proof, err = t.subproof(proof, m-k, start+k, end, false)
+		if err != nil {
+			return nil, err
+		}
+		sibling, err = t.subtreeHash(start, start+k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(proof, sibling), nil
+}
+
+// subtreeHash is MTH(D[start:end]) of RFC 6962. The left subtrees of the recursion are
+// complete and read from the levels, so only the right edge is hashed again.
+func (t *MerkleTree) subtreeHash(start, end int) ([]byte, error) {
+	n := end - start
+	if n == 0 {
+		return t.hasher.Get(nil)
+	}
+	if n&(n-1) == 0 && start%n == 0 {
+		l := bits.TrailingZeros(uint(n))
+		return t.levels[l][start>>l], nil
+	}
+	k := splitPoint(n)
+	left, err := t.subtreeHash(start, start+k)
+	if err != nil {
+		return nil, err
+	}
+	right, err := t.subtreeHash(start+k, end)
+	if err != nil {
+		return nil, err
+	}
+	return hashMerkleNode(t.hasher, left, right)
+}
+
+// HashMerkleLeaf returns the RFC 6962 leaf hash of leaf, as proved by VerifyInclusion
+func HashMerkleLeaf(hashType crypto.HashType, leaf []byte) ([]byte, error) {
+	return hashMerkleLeaf(Hash{hashType: hashType}, leaf)
+}
+
+// VerifyInclusion checks that leafHash is the leaf at index of the tree of size leaves with
+// the given root, proof being the audit path returned by MerkleTree.InclusionProof
+func VerifyInclusion(hashType crypto.HashType, index, size int, leafHash []byte, proof [][]byte,
+	root []byte) error {
+	if index < 0 || index >= size {
+		return ErrMerkleIndexOutOfRange
+	}
+	hasher := Hash{hashType: hashType}
+	fn, sn := index, size-1
+	r := leafHash
+	var err error
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidMerkleProof
+		}
+		if fn&1 == 1 || fn == sn {
+			if r, err = hashMerkleNode(hasher, p, r); err != nil {
+				return err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else if r, err = hashMerkleNode(hasher, r, p); err != nil {
+			return err
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrInvalidMerkleProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree of newSize leaves with newRoot extends the tree of
+// oldSize leaves with oldRoot, proof being returned by MerkleTree.ConsistencyProof
+func VerifyConsistency(hashType crypto.HashType, oldSize, newSize int, oldRoot, newRoot []byte,
+	proof [][]byte) error {
+	if oldSize <= 0 || oldSize > newSize {
+		return ErrMerkleSizeOutOfRange
+	}
+	if oldSize == newSize {
+		if len(proof) != 0 || !bytes.Equal(oldRoot, newRoot) {
+			return ErrInvalidMerkleProof
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return ErrInvalidMerkleProof
+	}
+	if oldSize&(oldSize-1) == 0 {
+		// the old tree is a complete subtree of the new one, its root starts the path
+		proof = append([][]byte{oldRoot}, proof...)
+	}
+	hasher := Hash{hashType: hashType}
+	fn, sn := oldSize-1, newSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	var err error
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidMerkleProof
+		}
+		if fn&1 == 1 || fn == sn {
+			if fr, err = hashMerkleNode(hasher, c, fr); err != nil {
+				return err
+			}
+			if sr, err = hashMerkleNode(hasher, c, sr); err != nil {
+				return err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else if sr, err = hashMerkleNode(hasher, sr, c); err != nil {
+			return err
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(fr, oldRoot) || !bytes.Equal(sr, newRoot) {
+		return ErrInvalidMerkleProof
+	}
+	return nil
+}
+
+// splitPoint returns the largest power of two smaller than n, n > 1
+func splitPoint(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+func hashMerkleLeaf(hasher Hash, leaf []byte) ([]byte, error) {
+	data := make([]byte, 1+len(leaf))
+	data[0] = merkleLeafPrefix
+	copy(data[1:], leaf)
+	return hasher.Get(data)
+}
+
+func hashMerkleNode(hasher Hash, left, right []byte) ([]byte, error) {
+	if len(left) == 0 || len(right) == 0 {
+		return nil, fmt.Errorf("%w: empty node hash", ErrInvalidMerkleProof)
+	}
+	data := make([]byte, 1+len(left)+len(right))
+	data[0] = merkleNodePrefix
+	copy(data[1:], left)
+	copy(data[1+len(left):], right)
+	return hasher.Get(data)
+}
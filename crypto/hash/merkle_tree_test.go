@@ -0,0 +1,141 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package hash
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// referenceRoot is MTH(D[n]) of RFC 6962 computed recursively
+func referenceRoot(t *testing.T, leaves [][]byte) []byte {
+	hasher := Hash{hashType: crypto.HASH_TYPE_SHA256}
+	if len(leaves) == 0 {
+		root, err := hasher.Get(nil)
+		require.Nil(t, err)
+		return root
+	}
+	if len(leaves) == 1 {
+		root, err := hashMerkleLeaf(hasher, leaves[0])
+		require.Nil(t, err)
+		return root
+	}
+	k := splitPoint(len(leaves))
+	root, err := hashMerkleNode(hasher, referenceRoot(t, leaves[:k]), referenceRoot(t, leaves[k:]))
+	require.Nil(t, err)
+	return root
+}
+
+func TestMerkleTree_Root(t *testing.T) {
+	tree, err := NewMerkleTree(crypto.HASH_TYPE_SHA256)
+	require.Nil(t, err)
+	root, err := tree.Root()
+	require.Nil(t, err)
+	require.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hex.EncodeToString(root))
+
+	_, err = tree.Append(nil)
+	require.Nil(t, err)
+	root, err = tree.Root()
+	require.Nil(t, err)
+	require.Equal(t, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d", hex.EncodeToString(root))
+
+	leaves := [][]byte{nil}
+	for i := 1; i < 70; i++ {
+		leaf := []byte(strconv.Itoa(i))
+		index, err := tree.Append(leaf)
+		require.Nil(t, err)
+		require.Equal(t, i, index)
+		leaves = append(leaves, leaf)
+		root, err = tree.Root()
+		require.Nil(t, err)
+		require.Equal(t, referenceRoot(t, leaves), root, "size %v", len(leaves))
+	}
+	for size := 0; size <= tree.Size(); size++ {
+		root, err = tree.RootAt(size)
+		require.Nil(t, err)
+		require.Equal(t, referenceRoot(t, leaves[:size]), root, "size %v", size)
+	}
+	_, err = tree.RootAt(tree.Size() + 1)
+	require.Equal(t, ErrMerkleSizeOutOfRange, err)
+
+	_, err = NewMerkleTree(crypto.HashType(0))
+	require.NotNil(t, err)
+}
+
+func TestMerkleTree_InclusionProof(t *testing.T) {
+	tree, err := NewMerkleTree(crypto.HASH_TYPE_SHA256)
+	require.Nil(t, err)
+	for i := 0; i < 33; i++ {
+		// duplicate leaves are told apart by their index
+		_, err = tree.Append([]byte(strconv.Itoa(i % 5)))
+		require.Nil(t, err)
+	}
+	for size := 1; size <= tree.Size(); size++ {
+		root, err := tree.RootAt(size)
+		require.Nil(t, err)
+		for index := 0; index < size; index++ {
+			proof, err := tree.InclusionProofAt(index, size)
+			require.Nil(t, err)
+			leafHash, err := tree.LeafHash(index)
+			require.Nil(t, err)
+			require.Nil(t, VerifyInclusion(crypto.HASH_TYPE_SHA256, index, size, leafHash, proof, root),
+				"index %v size %v", index, size)
+			if size > 1 {
+				// the same leaf at another index does not verify
+				other := (index + 1) % size
+				require.NotNil(t, VerifyInclusion(crypto.HASH_TYPE_SHA256, other, size, leafHash, proof, root))
+				require.NotNil(t, VerifyInclusion(crypto.HASH_TYPE_SHA256, index, size, leafHash, proof[1:], root))
+			}
+		}
+	}
+
+	leafHash, err := HashMerkleLeaf(crypto.HASH_TYPE_SHA256, []byte("3"))
+	require.Nil(t, err)
+	proof, err := tree.InclusionProof(8)
+	require.Nil(t, err)
+	root, err := tree.Root()
+	require.Nil(t, err)
+	require.Nil(t, VerifyInclusion(crypto.HASH_TYPE_SHA256, 8, tree.Size(), leafHash, proof, root))
+	_, err = tree.InclusionProof(tree.Size())
+	require.Equal(t, ErrMerkleIndexOutOfRange, err)
+}
+
+func TestMerkleTree_ConsistencyProof(t *testing.T) {
+	tree, err := NewMerkleTree(crypto.HASH_TYPE_SM3)
+	require.Nil(t, err)
+	for i := 0; i < 33; i++ {
+		_, err = tree.Append([]byte(strconv.Itoa(i)))
+		require.Nil(t, err)
+	}
+	for newSize := 1; newSize <= tree.Size(); newSize++ {
+		newRoot, err := tree.RootAt(newSize)
+		require.Nil(t, err)
+		for oldSize := 1; oldSize <= newSize; oldSize++ {
+			oldRoot, err := tree.RootAt(oldSize)
+			require.Nil(t, err)
+			proof, err := tree.ConsistencyProof(oldSize, newSize)
+			require.Nil(t, err)
+			require.Nil(t, VerifyConsistency(crypto.HASH_TYPE_SM3, oldSize, newSize, oldRoot, newRoot, proof),
+				"old size %v new size %v", oldSize, newSize)
+			if oldSize < newSize {
+				require.NotNil(t, VerifyConsistency(crypto.HASH_TYPE_SM3, oldSize, newSize, newRoot, newRoot,
+					proof))
+				require.NotNil(t, VerifyConsistency(crypto.HASH_TYPE_SM3, oldSize, newSize, oldRoot, newRoot,
+					proof[:len(proof)-1]))
+			}
+		}
+	}
+	_, err = tree.ConsistencyProof(0, 1)
+	require.Equal(t, ErrMerkleSizeOutOfRange, err)
+	_, err = tree.ConsistencyProof(2, tree.Size()+1)
+	require.Equal(t, ErrMerkleSizeOutOfRange, err)
+}
@@ -0,0 +1,494 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package hash
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+)
+
+// sparse Merkle tree node prefixes, also the first byte of the encoded nodes
+const (
+	smtLeafPrefix = 0x00
+	smtNodePrefix = 0x01
+)
+
+var (
+	ErrNodeNotFound       = errors.New("sparse merkle tree node not found")
+	ErrInvalidKeySize     = errors.New("sparse merkle tree key size must be the hash size")
+	ErrInvalidNode        = errors.New("invalid sparse merkle tree node")
+	ErrInvalidSparseProof = errors.New("invalid sparse merkle proof")
+)
+
+// NodeStore stores the nodes and the values of a SparseMerkleTree by their hash. The store is
+// content addressed and never deleted from, so the roots of previous versions stay readable.
+// A KV backend (e.g. leveldb) implements it to persist the state.
+type NodeStore interface {
+	// Get returns the data stored under hash, ErrNodeNotFound if there is none
+	Get(hash []byte) ([]byte, error)
+	// Put stores data under hash
+	Put(hash, data []byte) error
+}
+
+// MemoryNodeStore is an in-memory NodeStore
+type MemoryNodeStore struct {
+	mu    sync.RWMutex
+	nodes map[string][]byte
+}
+
+// NewMemoryNodeStore creates an empty in-memory NodeStore
+func NewMemoryNodeStore() *MemoryNodeStore {
+	return &MemoryNodeStore{nodes: make(map[string][]byte)}
+}
+
+func (s *MemoryNodeStore) Get(hash []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.nodes[string(hash)]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	return data, nil
+}
+
+func (s *MemoryNodeStore) Put(hash, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[string(hash)] = data
+	return nil
+}
+
+// SparseMerkleTree is a sparse Merkle tree over keys of the hash size (256 bits for the
+// supported hash types). A leaf is stored at the shortest prefix of its key that no other key
+// shares, and empty subtrees hash to a placeholder of zeros, so a tree of n keys holds about
+// 2n nodes. The leaves commit to the hash of their value.
+type SparseMerkleTree struct {
+	mu     sync.RWMutex
+	hasher Hash
+	store  NodeStore
+	// root hash of the root node, the placeholder if the tree is empty
+	root []byte
+	// placeholder hash of an empty subtree
+	placeholder []byte
+}
+
+// SparseMerkleProof proves the value of a key, or its absence, in the tree of a root
+type SparseMerkleProof struct {
+	// Siblings the sibling hashes on the path of the key, from the root down
+	Siblings [][]byte
+	// NonMembershipLeaf the encoded leaf of another key found on the path of an absent key,
+	// nil if the path ends on an empty subtree or the key is present
+	NonMembershipLeaf []byte
+}
+
+// NewSparseMerkleTree opens the tree of root in store, an empty tree if root is nil
+func NewSparseMerkleTree(hashType crypto.HashType, store NodeStore, root []byte) (*SparseMerkleTree, error) {
+	f, err := NewHasher(hashType)
+	if err != nil {
+		return nil, err
+	}
+	t := &SparseMerkleTree{
+		hasher:      Hash{hashType: hashType},
+		store:       store,
+		placeholder: make([]byte, f.Size()),
+	}
+	if root == nil {
+		root = t.placeholder
+	}
+	if len(root) != f.Size() {
+		return nil, ErrInvalidNode
+	}
+	if !t.isPlaceholder(root) {
+		if _, err = store.Get(root); err != nil {
+			return nil, err
+		}
+	}
+	t.root = root
+	return t, nil
+}
+
+// Root returns the root hash, a hash of zeros if the tree is empty
+func (t *SparseMerkleTree) Root() []byte {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.root
+}
+
+// Get returns the value of key, nil if the key is absent
+func (t *SparseMerkleTree) Get(key []byte) ([]byte, error) {
+	if err := t.checkKey(key); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.root
+	for depth := 0; ; depth++ {
+		if t.isPlaceholder(node) {
+			return nil, nil
+		}
+		data, err := t.load(node)
+		if err != nil {
+			return nil, err
+		}
+		if data[0] == smtLeafPrefix {
+			leafKey, valueHash, err := t.decodeLeaf(data)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(leafKey, key) {
+				return nil, nil
+			}
+			return t.store.Get(valueHash)
+		}
+		left, right, err := t.decodeNode(data)
+		if err != nil {
+			return nil, err
+		}
+		if smtBit(key, depth) == 0 {
+			node = left
+		} else {
+			node = right
+		}
+	}
+}
+
+// Update sets the value of key, value must not be nil, see Delete
+func (t *SparseMerkleTree) Update(key, value []byte) error {
+	if err := t.checkKey(key); err != nil {
+		return err
+	}
+	if value == nil {
+		return ErrInvalidNode
+	}
+	valueHash, err := t.hasher.Get(value)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err = t.store.Put(valueHash, value); err != nil {
+		return err
+	}
+	root, err := t.update(t.root, 0, key, valueHash)
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// Delete removes key, deleting an absent key does nothing
+func (t *SparseMerkleTree) Delete(key []byte) error {
+	if err := t.checkKey(key); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	root, _, err := t.delete(t.root, 0, key)
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// Prove returns the proof of the value of key, or of its absence, in the current tree
+func (t *SparseMerkleTree) Prove(key []byte) (*SparseMerkleProof, error) {
+	if err := t.checkKey(key); err != nil {
+		return nil, err
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	proof := &SparseMerkleProof{}
+	node := t.root
+	for depth := 0; !t.isPlaceholder(node); depth++ {
+		data, err := t.load(node)
+		if err != nil {
+			return nil, err
+		}
+		if data[0] == smtLeafPrefix {
+			leafKey, _, err := t.decodeLeaf(data)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(leafKey, key) {
+				proof.NonMembershipLeaf = data
+			}
+			break
+		}
+		left, right, err := t.decodeNode(data)
+		if err != nil {
+			return nil, err
+		}
+		if smtBit(key, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, right)
+			node = left
+		} else {
+			proof.Siblings = append(proof.Siblings, left)
+			node = right
+		}
+	}
+	return proof, nil
+}
+
+// VerifySparseMerkleProof checks that key has value in the tree of root, or that key is absent
+// if value is nil
+func VerifySparseMerkleProof(hashType crypto.HashType, root, key, value []byte, proof *SparseMerkleProof) error {
+	f, err := NewHasher(hashType)
+	if err != nil {
+		return err
+	}
+	if len(key) != f.Size() {
+		return ErrInvalidKeySize
+	}
+	if proof == nil || len(proof.Siblings) > 8*len(key) {
+		return ErrInvalidSparseProof
+	}
+	hasher := Hash{hashType: hashType}
+	node := make([]byte, f.Size())
+	switch {
+	case value != nil:
+		if proof.NonMembershipLeaf != nil {
+			return ErrInvalidSparseProof
+		}
+		valueHash, err := hasher.Get(value)
+		if err != nil {
+			return err
+		}
+		if node, err = hasher.Get(encodeSmtLeaf(key, valueHash)); err != nil {
+			return err
+		}
+	case proof.NonMembershipLeaf != nil:
+		leaf := proof.NonMembershipLeaf
+		if len(leaf) != 1+2*len(key) || leaf[0] != smtLeafPrefix || bytes.Equal(leaf[1:1+len(key)], key) {
+			return ErrInvalidSparseProof
+		}
+		if node, err = hasher.Get(leaf); err != nil {
+			return err
+		}
+	}
+	for depth := len(proof.Siblings) - 1; depth >= 0; depth-- {
+		sibling := proof.Siblings[depth]
+		if len(sibling) != f.Size() {
+			return ErrInvalidSparseProof
+		}
+		if smtBit(key, depth) == 0 {
+			node, err = hasher.Get(encodeSmtNode(node, sibling))
+		} else {
+			node, err = hasher.Get(encodeSmtNode(sibling, node))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(node, root) {
+		return ErrInvalidSparseProof
+	}
+	return nil
+}
+
+// update sets valueHash for key in the subtree of node at depth and returns the new subtree hash
+func (t *SparseMerkleTree) update(node []byte, depth int, key, valueHash []byte) ([]byte, error) {
+	if t.isPlaceholder(node) {
+		return t.putLeaf(key, valueHash)
+	}
+	data, err := t.load(node)
+	if err != nil {
+		return nil, err
+	}
+	if data[0] == smtLeafPrefix {
+		leafKey, _, err := t.decodeLeaf(data)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := t.putLeaf(key, valueHash)
+		if err != nil || bytes.Equal(leafKey, key) {
+			return leaf, err
+		}
+		// both leaves go down to the first bit their keys differ
+		return t.split(depth, node, leafKey, leaf, key)
+	}
+	left, right, err := t.decodeNode(data)
+	if err != nil {
+		return nil, err
+	}
+	if smtBit(key, depth) == 0 {
+		left, err = t.update(left, depth+1, key, valueHash)
+	} else {
+		right, err = t.update(right, depth+1, key, valueHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.putNode(left, right)
+}
+
+// split returns the subtree at depth holding the leaves a and b of distinct keys
+func (t *SparseMerkleTree) split(depth int, a, aKey, b, bKey []byte) ([]byte, error) {
+	aBit, bBit := smtBit(aKey, depth), smtBit(bKey, depth)
+	if aBit != bBit {
+		if aBit == 0 {
+			return t.putNode(a, b)
+		}
+		return t.putNode(b, a)
+	}
+	child, err := t.split(depth+1, a, aKey, b, bKey)
+	if err != nil {
+		return nil, err
+	}
+	if aBit == 0 {
+		return t.putNode(child, t.placeholder)
+	}
+	return t.putNode(t.placeholder, child)
+}
+
+// delete removes key from the subtree of node at depth and returns the new subtree hash, a
+// leaf left alone in a subtree moves up to the shortest prefix again
+func (t *SparseMerkleTree) delete(node []byte, depth int, key []byte) ([]byte, bool, error) {
+	if t.isPlaceholder(node) {
+		return node, false, nil
+	}
+	data, err := t.load(node)
+	if err != nil {
+		return nil, false, err
+	}
+	if data[0] == smtLeafPrefix {
+		leafKey, _, err := t.decodeLeaf(data)
+		if err != nil {
+			return nil, false, err
+		}
+		if !bytes.Equal(leafKey, key) {
+			return node, false, nil
+		}
+		return t.placeholder, true, nil
+	}
+	left, right, err := t.decodeNode(data)
+	if err != nil {
+		return nil, false, err
+	}
+	child, sibling := left, right
+	if smtBit(key, depth) == 1 {
+		child, sibling = right, left
+	}
+	child, found, err := t.delete(child, depth+1, key)
+	if err != nil || !found {
+		return node, found, err
+	}
+	// collapse a subtree holding a single leaf
+	if t.isPlaceholder(child) {
+		if leaf, err := t.isLeaf(sibling); err != nil || leaf {
+			return sibling, true, err
+		}
+	} else if t.isPlaceholder(sibling) {
+		if leaf, err := t.isLeaf(child); err != nil || leaf {
+			return child, true, err
+		}
+	}
+	if smtBit(key, depth) == 0 {
+		node, err = t.putNode(child, sibling)
+	} else {
+		node, err = t.putNode(sibling, child)
+	}
+	return node, true, err
+}
+
+func (t *SparseMerkleTree) isLeaf(node []byte) (bool, error) {
+	if t.isPlaceholder(node) {
+		return false, nil
+	}
+	data, err := t.load(node)
+	if err != nil {
+		return false, err
+	}
+	return data[0] == smtLeafPrefix, nil
+}
+
+// load returns the encoded node of hash
+func (t *SparseMerkleTree) load(hash []byte) ([]byte, error) {
+	data, err := t.store.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 1+2*len(t.placeholder) {
+		return nil, ErrInvalidNode
+	}
+	return data, nil
+}
+
+func (t *SparseMerkleTree) putLeaf(key, valueHash []byte) ([]byte, error) {
+	return t.put(encodeSmtLeaf(key, valueHash))
+}
+
+func (t *SparseMerkleTree) putNode(left, right []byte) ([]byte, error) {
+	if t.isPlaceholder(left) && t.isPlaceholder(right) {
+		return t.placeholder, nil
+	}
+	return t.put(encodeSmtNode(left, right))
+}
+
+func (t *SparseMerkleTree) put(data []byte) ([]byte, error) {
+	hash, err := t.hasher.Get(data)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.store.Put(hash, data); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+func (t *SparseMerkleTree) decodeLeaf(data []byte) (key, valueHash []byte, err error) {
+	size := len(t.placeholder)
+	if len(data) != 1+2*size || data[0] != smtLeafPrefix {
+		return nil, nil, ErrInvalidNode
+	}
+	return data[1 : 1+size], data[1+size:], nil
+}
+
+func (t *SparseMerkleTree) decodeNode(data []byte) (left, right []byte, err error) {
+	size := len(t.placeholder)
+	if len(data) != 1+2*size || data[0] != smtNodePrefix {
+		return nil, nil, ErrInvalidNode
+	}
+	return data[1 : 1+size], data[1+size:], nil
+}
+
+func (t *SparseMerkleTree) isPlaceholder(node []byte) bool {
+	return bytes.Equal(node, t.placeholder)
+}
+
+func (t *SparseMerkleTree) checkKey(key []byte) error {
+	if len(key) != len(t.placeholder) {
+		return ErrInvalidKeySize
+	}
+	return nil
+}
+
+// smtBit returns the bit of key at depth, the most significant bit first
+func smtBit(key []byte, depth int) byte {
+	return (key[depth/8] >> (7 - uint(depth%8))) & 1
+}
+
+func encodeSmtLeaf(key, valueHash []byte) []byte {
+	data := make([]byte, 1+len(key)+len(valueHash))
+	data[0] = smtLeafPrefix
+	copy(data[1:], key)
+	copy(data[1+len(key):], valueHash)
+	return data
+}
+
+func encodeSmtNode(left, right []byte) []byte {
+	data := make([]byte, 1+len(left)+len(right))
+	data[0] = smtNodePrefix
+	copy(data[1:], left)
+	copy(data[1+len(left):], right)
+	return data
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package hash
+
+import (
+	"strconv"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func smtKey(t *testing.T, hashType crypto.HashType, i int) []byte {
+	key, err := Get(hashType, []byte("key"+strconv.Itoa(i)))
+	require.Nil(t, err)
+	return key
+}
+
+func TestSparseMerkleTree(t *testing.T) {
+	for _, hashType := range []crypto.HashType{crypto.HASH_TYPE_SM3, crypto.HASH_TYPE_SHA256,
+		crypto.HASH_TYPE_SHA3_256} {
+		store := NewMemoryNodeStore()
+		tree, err := NewSparseMerkleTree(hashType, store, nil)
+		require.Nil(t, err)
+		emptyRoot := tree.Root()
+
+		for i := 0; i < 100; i++ {
+			require.Nil(t, tree.Update(smtKey(t, hashType, i), []byte("value"+strconv.Itoa(i))))
+		}
+		require.Nil(t, tree.Update(smtKey(t, hashType, 7), []byte("updated")))
+		for i := 0; i < 100; i++ {
+			value, err := tree.Get(smtKey(t, hashType, i))
+			require.Nil(t, err)
+			if i == 7 {
+				require.Equal(t, []byte("updated"), value)
+			} else {
+				require.Equal(t, []byte("value"+strconv.Itoa(i)), value)
+			}
+		}
+		value, err := tree.Get(smtKey(t, hashType, 100))
+		require.Nil(t, err)
+		require.Nil(t, value)
+		root := tree.Root()
+
+		// the root only depends on the content, not on the order of the updates
+		other, err := NewSparseMerkleTree(hashType, NewMemoryNodeStore(), nil)
+		require.Nil(t, err)
+		for i := 99; i >= 0; i-- {
+			value := []byte("value" + strconv.Itoa(i))
+			if i == 7 {
+				value = []byte("updated")
+			}
+			require.Nil(t, other.Update(smtKey(t, hashType, i), value))
+		}
+		require.Nil(t, other.Update(smtKey(t, hashType, 100), []byte("deleted")))
+		require.Nil(t, other.Delete(smtKey(t, hashType, 100)))
+		require.Equal(t, root, other.Root())
+
+		// the previous roots stay readable in the store
+		reopened, err := NewSparseMerkleTree(hashType, store, root)
+		require.Nil(t, err)
+		for i := 0; i < 100; i++ {
+			require.Nil(t, tree.Delete(smtKey(t, hashType, i)))
+		}
+		require.Equal(t, emptyRoot, tree.Root())
+		value, err = reopened.Get(smtKey(t, hashType, 42))
+		require.Nil(t, err)
+		require.Equal(t, []byte("value42"), value)
+
+		_, err = NewSparseMerkleTree(hashType, NewMemoryNodeStore(), root)
+		require.Equal(t, ErrNodeNotFound, err)
+		require.Equal(t, ErrInvalidKeySize, tree.Update([]byte("short"), []byte("value")))
+	}
+}
+
+func TestSparseMerkleTree_Prove(t *testing.T) {
+	hashType := crypto.HASH_TYPE_SHA256
+	tree, err := NewSparseMerkleTree(hashType, NewMemoryNodeStore(), nil)
+	require.Nil(t, err)
+
+	// non-membership in the empty tree
+	proof, err := tree.Prove(smtKey(t, hashType, 0))
+	require.Nil(t, err)
+	require.Nil(t, VerifySparseMerkleProof(hashType, tree.Root(), smtKey(t, hashType, 0), nil, proof))
+
+	for i := 0; i < 50; i++ {
+		require.Nil(t, tree.Update(smtKey(t, hashType, i), []byte("value"+strconv.Itoa(i))))
+	}
+	root := tree.Root()
+	for i := 0; i < 100; i++ {
+		key := smtKey(t, hashType, i)
+		proof, err := tree.Prove(key)
+		require.Nil(t, err)
+		if i < 50 {
+			value := []byte("value" + strconv.Itoa(i))
+			require.Nil(t, VerifySparseMerkleProof(hashType, root, key, value, proof), "key %v", i)
+			require.NotNil(t, VerifySparseMerkleProof(hashType, root, key, []byte("forged"), proof))
+			require.NotNil(t, VerifySparseMerkleProof(hashType, root, key, nil, proof))
+		} else {
+			require.Nil(t, VerifySparseMerkleProof(hashType, root, key, nil, proof), "key %v", i)
+			require.NotNil(t, VerifySparseMerkleProof(hashType, root, key, []byte("forged"), proof))
+		}
+	}
+
+	// a proof of a key does not prove another one
+	proof, err = tree.Prove(smtKey(t, hashType, 1))
+	require.Nil(t, err)
+	require.NotNil(t, VerifySparseMerkleProof(hashType, root, smtKey(t, hashType, 2), []byte("value1"), proof))
+	require.NotNil(t, VerifySparseMerkleProof(hashType, root, smtKey(t, hashType, 1), []byte("value1"), nil))
+}
@@ -29,6 +29,12 @@ func (c *Conn) serverHandshakeAutoSwitch() error {
 		return unexpectedMessageError("Client Hello Msg", msg)
 	}
 
+	// TLS 1.3 客户端 Hello 消息的版本为 TLS 1.2，
+	// 在 supported_versions 扩展中协商 TLS 1.3
+	if vers, ok := c.config.mutualVersion(clientHello.supportedVersions); ok && vers == VersionTLS13 {
+		return c.serverHandshakeTLS13(clientHello)
+	}
+
 	//
 	// 根据客户端Hello消息的版本选择使用的
 	// GMSSL协议 或 TLS 协议
@@ -67,6 +73,32 @@ func (c *Conn) serverHandshakeAutoSwitch() error {
 	}
 }
 
+// 运行 TLS 1.3 握手流程，国密套件 (RFC 8998) 与标准套件均可协商
+//
+// c: 连接对象
+// clientHello: 客户端Hello消息
+func (c *Conn) serverHandshakeTLS13(clientHello *clientHelloMsg) error {
+	if c.config.GetConfigForClient != nil {
+		if newConfig, err := c.config.GetConfigForClient(clientHelloInfo(c, clientHello)); err != nil {
+			_ = c.sendAlert(alertInternalError)
+			return err
+		} else if newConfig != nil {
+			newConfig.serverInitOnce.Do(func() { newConfig.serverInit(c.config) })
+			c.config = newConfig
+		}
+	}
+	c.vers = VersionTLS13
+	c.haveVers = true
+	c.in.version = c.vers
+	c.out.version = c.vers
+
+	hs := serverHandshakeStateTLS13{
+		c:           c,
+		clientHello: clientHello,
+	}
+	return hs.handshake()
+}
+
 // 处理 GMSSL 客户端 Hello消息
 // Code segment copy from: gmtls/gm_handshake_server_double.go:114
 //
@@ -147,7 +179,7 @@ func processClientHelloGM(c *Conn, hs *serverHandshakeStateGM) (isResume bool, e
 		_ = c.sendAlert(alertInternalError)
 		return false, err
 	}
-	encCert, err := c.config.GetKECertificate(hs.clientHelloInfo())
+	encCert, err := c.config.getEKCertificate(hs.clientHelloInfo())
 	if err != nil {
 		_ = c.sendAlert(alertInternalError)
 		return false, err
@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"hash"
 
+	cmcrypto "chainmaker.org/chainmaker/common/v2/crypto"
 	cmx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
 
 	"golang.org/x/crypto/chacha20poly1305"
@@ -59,6 +60,8 @@ func CipherSuites() []*CipherSuite {
 		{TLS_AES_128_GCM_SHA256, "TLS_AES_128_GCM_SHA256", supportedOnlyTLS13, false},
 		{TLS_AES_256_GCM_SHA384, "TLS_AES_256_GCM_SHA384", supportedOnlyTLS13, false},
 		{TLS_CHACHA20_POLY1305_SHA256, "TLS_CHACHA20_POLY1305_SHA256", supportedOnlyTLS13, false},
+		{TLS_SM4_GCM_SM3, "TLS_SM4_GCM_SM3", supportedOnlyTLS13, false},
+		{TLS_SM4_CCM_SM3, "TLS_SM4_CCM_SM3", supportedOnlyTLS13, false},
 
 		{TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA", supportedUpToTLS12, false},
 		{TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA", supportedUpToTLS12, false},
@@ -219,13 +222,15 @@ type cipherSuiteTLS13 struct {
 	id     uint16
 	keyLen int
 	aead   func(key, fixedNonce []byte) cipher.AEAD
-	hash   crypto.Hash
+	hash   tls13Hash
 }
 
 var cipherSuitesTLS13 = []*cipherSuiteTLS13{
-	{TLS_AES_128_GCM_SHA256, 16, aeadAESGCMTLS13, crypto.SHA256},
-	{TLS_CHACHA20_POLY1305_SHA256, 32, aeadChaCha20Poly1305, crypto.SHA256},
-	{TLS_AES_256_GCM_SHA384, 32, aeadAESGCMTLS13, crypto.SHA384},
+	{TLS_AES_128_GCM_SHA256, 16, aeadAESGCMTLS13, tls13Hash(crypto.SHA256)},
+	{TLS_CHACHA20_POLY1305_SHA256, 32, aeadChaCha20Poly1305, tls13Hash(crypto.SHA256)},
+	{TLS_AES_256_GCM_SHA384, 32, aeadAESGCMTLS13, tls13Hash(crypto.SHA384)},
+	{TLS_SM4_GCM_SM3, 16, aeadSM4GCMTLS13, tls13Hash(cmcrypto.SM3)},
+	{TLS_SM4_CCM_SM3, 16, aeadSM4CCMTLS13, tls13Hash(cmcrypto.SM3)},
 }
 
 func cipherRC4(key, iv []byte, isRead bool) interface{} {
@@ -528,6 +533,10 @@ const (
 	TLS_AES_256_GCM_SHA384       uint16 = 0x1302
 	TLS_CHACHA20_POLY1305_SHA256 uint16 = 0x1303
 
+	// TLS 1.3 SM cipher suites. See RFC 8998.
+	TLS_SM4_GCM_SM3 uint16 = 0x00c6
+	TLS_SM4_CCM_SM3 uint16 = 0x00c7
+
 	// TLS_FALLBACK_SCSV isn't a standard cipher suite but an indicator
 	// that the client is doing version fallback. See RFC 7507.
 	TLS_FALLBACK_SCSV uint16 = 0x5600
@@ -127,6 +127,9 @@ const (
 	CurveP521 CurveID = 25
 	X25519    CurveID = 29
 	SM2P256V1 CurveID = 41
+
+	// CurveSM2 is the curveSM2 group of RFC 8998, the SM2 curve
+	CurveSM2 = SM2P256V1
 )
 
 // TLS 1.3 Key Share. See RFC 8446, Section 4.2.8.
@@ -527,6 +530,14 @@ type Config struct {
 	// material from the returned config will be used for session tickets.
 	GetConfigForClient func(*ClientHelloInfo) (*Config, error)
 
+	// GetConfigForServer, if not nil, is called with the Config of a client
+	// connection before its first handshake. It may return a non-nil Config
+	// in order to change the Config that will be used for this connection,
+	// e.g. with rotated Certificates and RootCAs. If the returned Config is
+	// nil, the original Config will be used. The Config passed to the
+	// callback must not be modified.
+	GetConfigForServer func(*Config) (*Config, error)
+
 	// VerifyPeerCertificate, if not nil, is called after normal
 	// certificate verification by either a TLS client or server. It
 	// receives the raw ASN.1 certificates provided by the peer and also
@@ -540,6 +551,12 @@ type Config struct {
 	// be considered but the verifiedChains argument will always be nil.
 	VerifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*cmx509.Certificate) error
 
+	// RevocationChecker, if not nil, is used by the normal certificate
+	// verification of either a TLS client or server to reject the chains
+	// with a revoked certificate. A TLS 1.3 client checks the certificate of
+	// the server with its stapled OCSP response first.
+	RevocationChecker cmx509.RevocationChecker
+
 	// RootCAs defines the set of root certificate authorities
 	// that clients use when verifying server certificates.
 	// If RootCAs is nil, TLS uses the host's root CA set.
@@ -698,7 +715,9 @@ func (c *Config) Clone() *Config {
 		GetKECertificate:            c.GetKECertificate,
 		GetClientCertificate:        c.GetClientCertificate,
 		GetConfigForClient:          c.GetConfigForClient,
+		GetConfigForServer:          c.GetConfigForServer,
 		VerifyPeerCertificate:       c.VerifyPeerCertificate,
+		RevocationChecker:           c.RevocationChecker,
 		RootCAs:                     c.RootCAs,
 		NextProtos:                  c.NextProtos,
 		ServerName:                  c.ServerName,
@@ -869,6 +888,9 @@ var defaultCurvePreferences = []CurveID{X25519, CurveP256, CurveP384, CurveP521,
 
 func (c *Config) curvePreferences() []CurveID {
 	if c == nil || len(c.CurvePreferences) == 0 {
+		if c != nil && c.GMSupport != nil {
+			return gmCurvePreferences
+		}
 		return defaultCurvePreferences
 	}
 	return c.CurvePreferences
@@ -0,0 +1,292 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+	cmtls "chainmaker.org/chainmaker/common/v2/crypto/tls"
+	cmx509 "chainmaker.org/chainmaker/common/v2/crypto/x509"
+)
+
+// CertProvider loads the sign certificate, the optional enc certificate of
+// GMSSL, their keys and the CA certificates of a node, and reloads them when
+// the files change, so that they can be rotated without a restart. The
+// handshakes of the configs it is applied to use the material loaded last,
+// a reload failure keeps the previous material.
+type CertProvider struct {
+	certFile    string
+	keyFile     string
+	encCertFile string
+	encKeyFile  string
+	// caPaths CA certificate files, or directories of *.crt files
+	caPaths []string
+
+	material atomic.Value // *certMaterial
+
+	// mu serializes the reloads
+	mu     sync.Mutex
+	stamps string
+
+	stopC    chan struct{}
+	stopOnce sync.Once
+}
+
+// certMaterial the certificates and the CA certificates loaded together
+type certMaterial struct {
+	certificates []cmtls.Certificate
+	certPool     *cmx509.CertPool
+	// sm2 whether the key of the sign certificate is a SM2 key
+	sm2 bool
+}
+
+// NewCertProvider loads the certificates and returns their provider. The enc
+// certificate and key may be empty for a single certificate node, each CA
+// path is a certificate file or a directory of *.crt files.
+func NewCertProvider(certFile, keyFile, encCertFile, encKeyFile string, caPaths ...string) (*CertProvider, error) {
+	p := &CertProvider{
+		certFile:    certFile,
+		keyFile:     keyFile,
+		encCertFile: encCertFile,
+		encKeyFile:  encKeyFile,
+		caPaths:     caPaths,
+		stopC:       make(chan struct{}),
+	}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Certificates returns the certificates loaded last, the enc certificate second if any
+func (p *CertProvider) Certificates() []cmtls.Certificate {
+	return p.load().certificates
+}
+
+// CertPool returns the CA certificates loaded last
+func (p *CertProvider) CertPool() *cmx509.CertPool {
+	return p.load().certPool
+}
+
+func (p *CertProvider) load() *certMaterial {
+	return p.material.Load().(*certMaterial)
+}
+
+// Reload loads the files again and swaps the material if they are all valid,
+// otherwise the previous material is kept and the error returned
+func (p *CertProvider) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stamps, err := p.fileStamps()
+	if err != nil {
+		return err
+	}
+	if err = p.reload(); err != nil {
+		return err
+	}
+	p.stamps = stamps
+	return nil
+}
+
+func (p *CertProvider) reload() error {
+	sigCert, err := cmtls.LoadX509KeyPair(p.certFile, p.keyFile)
+	if err != nil {
+		return fmt.Errorf("load sign cert failed, %s", err.Error())
+	}
+	leaf, err := cmx509.ParseCertificate(sigCert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parse sign cert failed, %s", err.Error())
+	}
+	certificates := []cmtls.Certificate{sigCert}
+	if p.encCertFile != "" || p.encKeyFile != "" {
+		encCert, err := cmtls.LoadX509KeyPair(p.encCertFile, p.encKeyFile)
+		if err != nil {
+			return fmt.Errorf("load enc cert failed, %s", err.Error())
+		}
+		certificates = append(certificates, encCert)
+	}
+
+	certPool := cmx509.NewCertPool()
+	caFiles, err := p.caFiles()
+	if err != nil {
+		return err
+	}
+	for _, caFile := range caFiles {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		// a CA file being written may be empty or truncated
+		if !certPool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("no valid CA cert in %s", caFile)
+		}
+	}
+
+	p.material.Store(&certMaterial{
+		certificates: certificates,
+		certPool:     certPool,
+		sm2:          leaf.PublicKey.Type() == crypto.SM2,
+	})
+	return nil
+}
+
+// caFiles lists the CA certificate files, those of the directories sorted by name
+func (p *CertProvider) caFiles() ([]string, error) {
+	var files []string
+	for _, caPath := range p.caPaths {
+		if caPath == "" {
+			continue
+		}
+		fi, err := os.Stat(caPath)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, caPath)
+			continue
+		}
+		dir, err := ioutil.ReadDir(caPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range dir {
+			if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".crt") {
+				files = append(files, filepath.Join(caPath, fi.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// fileStamps returns the names, sizes and modification times of the files,
+// which change when the files are rewritten, added or removed
+func (p *CertProvider) fileStamps() (string, error) {
+	files, err := p.caFiles()
+	if err != nil {
+		return "", err
+	}
+	files = append(files, p.certFile, p.keyFile)
+	if p.encCertFile != "" || p.encKeyFile != "" {
+		files = append(files, p.encCertFile, p.encKeyFile)
+	}
+	sort.Strings(files)
+
+	var stamps strings.Builder
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stamps, "%s:%d:%d;", file, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return stamps.String(), nil
+}
+
+// Watch checks the files every interval until Stop is called, and reloads
+// them when they change. onReload, if not nil, is called with the result of
+// each reload, so that the failures can be reported.
+func (p *CertProvider) Watch(interval time.Duration, onReload func(err error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stopC:
+				return
+			case <-ticker.C:
+				changed, err := p.reloadIfChanged()
+				if (changed || err != nil) && onReload != nil {
+					onReload(err)
+				}
+			}
+		}
+	}()
+}
+
+// reloadIfChanged reloads the files if their stamps changed since the last
+// successful reload, a failed reload is retried at the next check
+func (p *CertProvider) reloadIfChanged() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stamps, err := p.fileStamps()
+	if err != nil {
+		// a file being replaced may be missing for a moment, wait for the next check
+		return false, err
+	}
+	if stamps == p.stamps {
+		return false, nil
+	}
+	if err = p.reload(); err != nil {
+		return true, err
+	}
+	p.stamps = stamps
+	return true, nil
+}
+
+// Stop stops watching the files
+func (p *CertProvider) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopC)
+	})
+}
+
+// Apply makes the handshakes of the config use the material loaded last: the
+// Certificates and ClientCAs of a server, through GetConfigForClient, or the
+// Certificates and RootCAs of a client, through GetConfigForServer. The config
+// is cloned for each handshake, it must not be modified once they start.
+func (p *CertProvider) Apply(config *cmtls.Config, isServer bool) {
+	m := p.load()
+	config.Certificates = m.certificates
+	if isServer {
+		config.ClientCAs = m.certPool
+		config.GetConfigForClient = func(*cmtls.ClientHelloInfo) (*cmtls.Config, error) {
+			cfg := config.Clone()
+			cfg.GetConfigForClient = nil
+			m := p.load()
+			cfg.Certificates = m.certificates
+			cfg.ClientCAs = m.certPool
+			return cfg, nil
+		}
+		return
+	}
+	config.RootCAs = m.certPool
+	config.GetConfigForServer = func(c *cmtls.Config) (*cmtls.Config, error) {
+		cfg := c.Clone()
+		cfg.GetConfigForServer = nil
+		m := p.load()
+		cfg.Certificates = m.certificates
+		cfg.RootCAs = m.certPool
+		return cfg, nil
+	}
+}
+
+// GetConfig returns a config whose handshakes use the material loaded last.
+// The GMSupport is decided by the key of the sign certificate loaded when it
+// is called: a SM2 key uses GMSSL like GetGMTLSConfig if an enc certificate is
+// configured, and the SM suites of TLS 1.3 otherwise; other keys use TLS like
+// GetConfig.
+func (p *CertProvider) GetConfig(isServer bool) *cmtls.Config {
+	config := &cmtls.Config{}
+	if p.load().sm2 {
+		config.GMSupport = cmtls.NewGMSupport()
+		if p.encCertFile == "" && p.encKeyFile == "" {
+			config.GMSupport.EnableTLS13Mode()
+		}
+	}
+	p.Apply(config, isServer)
+	return config
+}
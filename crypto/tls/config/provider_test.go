@@ -0,0 +1,218 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chainmaker.org/chainmaker/common/v2/crypto/tls"
+	"github.com/stretchr/testify/require"
+)
+
+// copyFile copies the test file src to dst
+func copyFile(t *testing.T, src, dst string) {
+	data, err := ioutil.ReadFile(src)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(dst, data, 0600))
+}
+
+// isPeerCert whether the peer certificate of the connection is the one of the file
+func isPeerCert(t *testing.T, state tls.ConnectionState, certFile string) bool {
+	block, _ := pem.Decode(mustReadFile(t, certFile))
+	require.NotNil(t, block)
+	return bytes.Equal(block.Bytes, state.PeerCertificates[0].Raw)
+}
+
+func mustReadFile(t *testing.T, file string) []byte {
+	data, err := ioutil.ReadFile(file)
+	require.Nil(t, err)
+	return data
+}
+
+func TestCertProvider_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	caDir := filepath.Join(dir, "ca")
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "other.crt"), []byte(rsaCertPEM), 0600))
+	copyFile(t, ssCert, certFile)
+	copyFile(t, ssKey, keyFile)
+
+	// the CA directory is loaded with the *.crt files it contains
+	_, err := NewCertProvider(certFile, keyFile, "", "", caDir)
+	require.NotNil(t, err)
+	require.Nil(t, os.Mkdir(caDir, 0700))
+	copyFile(t, caCert, filepath.Join(caDir, "ca.crt"))
+	copyFile(t, caCert, filepath.Join(caDir, "ca.key"))
+	provider, err := NewCertProvider(certFile, keyFile, "", "", filepath.Join(dir, "other.crt"), caDir)
+	require.Nil(t, err)
+	require.Len(t, provider.Certificates(), 1)
+	require.Len(t, provider.CertPool().Subjects(), 2)
+
+	// the previous material is kept when a reload fails
+	certificates := provider.Certificates()
+	require.Nil(t, ioutil.WriteFile(certFile, []byte("rotating"), 0600))
+	require.NotNil(t, provider.Reload())
+	require.Equal(t, certificates, provider.Certificates())
+
+	copyFile(t, seCert, certFile)
+	require.NotNil(t, provider.Reload())
+	copyFile(t, seKey, keyFile)
+	require.Nil(t, provider.Reload())
+	require.NotEqual(t, certificates, provider.Certificates())
+
+	// an enc certificate comes second
+	provider, err = NewCertProvider(ssCert, ssKey, seCert, seKey, caCert)
+	require.Nil(t, err)
+	require.Len(t, provider.Certificates(), 2)
+}
+
+func TestCertProvider_GetConfig(t *testing.T) {
+	// GMSSL with a SM2 enc certificate
+	provider, err := NewCertProvider(ssCert, ssKey, seCert, seKey, caCert)
+	require.Nil(t, err)
+	config := provider.GetConfig(true)
+	require.NotNil(t, config.GMSupport)
+	require.False(t, config.GMSupport.IsTLS13Mode())
+
+	// the SM suites of TLS 1.3 with a single SM2 certificate
+	provider, err = NewCertProvider(ssCert, ssKey, "", "", caCert)
+	require.Nil(t, err)
+	config = provider.GetConfig(false)
+	require.NotNil(t, config.GMSupport)
+	require.True(t, config.GMSupport.IsTLS13Mode())
+
+	// TLS with other keys
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.Nil(t, ioutil.WriteFile(certFile, []byte(rsaCertPEM), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, []byte(rsaKeyPEM), 0600))
+	provider, err = NewCertProvider(certFile, keyFile, "", "", caCert)
+	require.Nil(t, err)
+	require.Nil(t, provider.GetConfig(true).GMSupport)
+}
+
+func TestCertProvider_ReloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	copyFile(t, ssCert, certFile)
+	copyFile(t, ssKey, keyFile)
+	provider, err := NewCertProvider(certFile, keyFile, "", "", caCert)
+	require.Nil(t, err)
+	changed, err := provider.reloadIfChanged()
+	require.False(t, changed)
+	require.Nil(t, err)
+
+	// a failed reload is retried, even if the files are fixed with the same stamps
+	certificates := provider.Certificates()
+	certPEM := mustReadFile(t, ssCert)
+	modTime := time.Now().Add(time.Hour)
+	require.Nil(t, ioutil.WriteFile(certFile, bytes.Repeat([]byte{'x'}, len(certPEM)), 0600))
+	require.Nil(t, os.Chtimes(certFile, modTime, modTime))
+	changed, err = provider.reloadIfChanged()
+	require.True(t, changed)
+	require.NotNil(t, err)
+	require.Equal(t, certificates, provider.Certificates())
+
+	require.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	require.Nil(t, os.Chtimes(certFile, modTime, modTime))
+	changed, err = provider.reloadIfChanged()
+	require.True(t, changed)
+	require.Nil(t, err)
+	changed, err = provider.reloadIfChanged()
+	require.False(t, changed)
+	require.Nil(t, err)
+}
+
+func TestCertProvider_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	copyFile(t, ssCert, certFile)
+	copyFile(t, ssKey, keyFile)
+	copyFile(t, caCert, caFile)
+
+	serverProvider, err := NewCertProvider(certFile, keyFile, "", "", caFile)
+	require.Nil(t, err)
+	serverConfig := tls13GM(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert})
+	serverProvider.Apply(serverConfig, true)
+
+	clientCAFile := filepath.Join(dir, "client-ca.crt")
+	require.Nil(t, ioutil.WriteFile(clientCAFile, []byte(rsaCertPEM), 0600))
+	clientProvider, err := NewCertProvider(csCert, csKey, "", "", clientCAFile)
+	require.Nil(t, err)
+	clientConfig := clientProvider.GetConfig(false)
+	clientConfig.ServerName = "chainmaker.org"
+	clientConfig = tls13GM(clientConfig)
+
+	// the client does not trust the server until its CA certificates are rotated
+	_, err = dial(serverConfig, clientConfig)
+	require.NotNil(t, err)
+	copyFile(t, caCert, clientCAFile)
+	require.Nil(t, clientProvider.Reload())
+	state := handshake(t, serverConfig, clientConfig)
+	require.True(t, isPeerCert(t, state, ssCert))
+
+	// the server presents its new certificate once the files are rewritten
+	reloaded := make(chan error, 16)
+	serverProvider.Watch(10*time.Millisecond, func(err error) {
+		// a failed reload is reported at each check until the files are fixed
+		select {
+		case reloaded <- err:
+		default:
+		}
+	})
+	defer serverProvider.Stop()
+	copyFile(t, seCert, certFile)
+	copyFile(t, seKey, keyFile)
+	require.Nil(t, waitReload(t, reloaded, false))
+	state = handshake(t, serverConfig, clientConfig)
+	require.True(t, isPeerCert(t, state, seCert))
+
+	// a failed reload is reported and the server keeps its certificate
+	require.Nil(t, ioutil.WriteFile(caFile, nil, 0600))
+	require.NotNil(t, waitReload(t, reloaded, true))
+	state = handshake(t, serverConfig, clientConfig)
+	require.True(t, isPeerCert(t, state, seCert))
+}
+
+func TestCertProvider_GMSSL(t *testing.T) {
+	serverProvider, err := NewCertProvider(ssCert, ssKey, seCert, seKey, caCert)
+	require.Nil(t, err)
+	serverConfig := serverProvider.GetConfig(true)
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	clientProvider, err := NewCertProvider(csCert, csKey, ceCert, ceKey, caCert)
+	require.Nil(t, err)
+	clientConfig := clientProvider.GetConfig(false)
+	clientConfig.ServerName = "chainmaker.org"
+
+	state := handshake(t, serverConfig, clientConfig)
+	require.Equal(t, uint16(tls.VersionGMSSL), state.Version)
+	require.Len(t, state.VerifiedChains, 1)
+}
+
+// waitReload returns the result of the first reload which failed or not as
+// wanted, the files being rewritten one after the other
+func waitReload(t *testing.T, reloaded <-chan error, failed bool) error {
+	for {
+		select {
+		case err := <-reloaded:
+			if (err != nil) == failed {
+				return err
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the files were not reloaded")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/crypto/tls"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	caCert = "../testdata/certs/CA.crt"
+	ssCert = "../testdata/certs/SS.crt"
+	ssKey  = "../testdata/certs/SS.key"
+	seCert = "../testdata/certs/SE.crt"
+	seKey  = "../testdata/certs/SE.key"
+	csCert = "../testdata/certs/CS.crt"
+	csKey  = "../testdata/certs/CS.key"
+	ceCert = "../testdata/certs/CE.crt"
+	ceKey  = "../testdata/certs/CE.key"
+)
+
+var msg = []byte("hello world")
+
+// handshake connects the client to the server, which writes msg, and returns the client connection state
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) tls.ConnectionState {
+	state, err := dial(serverConfig, clientConfig)
+	require.Nil(t, err)
+	return state
+}
+
+func dial(serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer ln.Close()
+	errC := make(chan error, 1)
+	go func() {
+		s, err := ln.Accept()
+		if err != nil {
+			errC <- err
+			return
+		}
+		server := tls.Server(s, serverConfig)
+		defer server.Close()
+		if err = server.Handshake(); err != nil {
+			errC <- err
+			return
+		}
+		_, err = server.Write(msg)
+		errC <- err
+	}()
+
+	client, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer client.Close()
+	// the session tickets of TLS 1.3 are read with the data
+	buf := make([]byte, len(msg))
+	if _, err = io.ReadFull(client, buf); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	if !bytes.Equal(msg, buf) {
+		return tls.ConnectionState{}, errors.New("unexpected message")
+	}
+	if err = <-errC; err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return client.ConnectionState(), nil
+}
+
+func singleCertConfigs(t *testing.T) (serverConfig, clientConfig *tls.Config) {
+	serverConfig, err := GetConfig(ssCert, ssKey, caCert, true)
+	require.Nil(t, err)
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	clientConfig, err = GetConfig(csCert, csKey, caCert, false)
+	require.Nil(t, err)
+	clientConfig.ServerName = "chainmaker.org"
+	return serverConfig, clientConfig
+}
+
+func doubleCertConfigs(t *testing.T) (serverConfig, clientConfig *tls.Config) {
+	serverConfig, err := GetGMTLSConfig(ssCert, ssKey, seCert, seKey, caCert, true)
+	require.Nil(t, err)
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	clientConfig, err = GetGMTLSConfig(csCert, csKey, ceCert, ceKey, caCert, false)
+	require.Nil(t, err)
+	clientConfig.ServerName = "chainmaker.org"
+	return serverConfig, clientConfig
+}
+
+func tls13GM(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	config.GMSupport = tls.NewGMSupport()
+	config.GMSupport.EnableTLS13Mode()
+	return config
+}
+
+func TestTLS13GM_SingleCert(t *testing.T) {
+	serverConfig, clientConfig := singleCertConfigs(t)
+
+	// a TLS server does not offer the SM suites
+	state := handshake(t, serverConfig, tls13GM(clientConfig))
+	require.Equal(t, uint16(tls.VersionTLS13), state.Version)
+	require.NotContains(t, []uint16{tls.TLS_SM4_GCM_SM3, tls.TLS_SM4_CCM_SM3}, state.CipherSuite)
+
+	// nor does a TLS client, to a server in the TLS 1.3 mode which prefers them
+	serverConfig = tls13GM(serverConfig)
+	serverConfig.PreferServerCipherSuites = true
+	state = handshake(t, serverConfig, clientConfig)
+	require.Equal(t, uint16(tls.VersionTLS13), state.Version)
+	require.NotContains(t, []uint16{tls.TLS_SM4_GCM_SM3, tls.TLS_SM4_CCM_SM3}, state.CipherSuite)
+	clientConfig = tls13GM(clientConfig)
+	state = handshake(t, serverConfig, clientConfig)
+	require.Equal(t, tls.TLS_SM4_GCM_SM3, state.CipherSuite)
+
+	clientConfig.CipherSuites = []uint16{tls.TLS_SM4_CCM_SM3}
+	state = handshake(t, serverConfig, clientConfig)
+	require.Equal(t, tls.TLS_SM4_CCM_SM3, state.CipherSuite)
+	require.Len(t, state.VerifiedChains, 1)
+}
+
+func TestTLS13GM_DoubleCert(t *testing.T) {
+	serverConfig, clientConfig := doubleCertConfigs(t)
+	serverConfig.GMSupport.EnableMixMode()
+
+	// the GMSSL clients still negotiate GMSSL with an auto switch server
+	state := handshake(t, serverConfig, clientConfig)
+	require.Equal(t, uint16(tls.VersionGMSSL), state.Version)
+
+	// the TLS 1.3 clients negotiate TLS 1.3 with the SM suites
+	state = handshake(t, serverConfig, tls13GM(clientConfig))
+	require.Equal(t, uint16(tls.VersionTLS13), state.Version)
+	require.Equal(t, tls.TLS_SM4_GCM_SM3, state.CipherSuite)
+
+	// the TLS clients too, with the suites they prefer
+	_, tlsClientConfig := singleCertConfigs(t)
+	state = handshake(t, serverConfig, tlsClientConfig)
+	require.Equal(t, uint16(tls.VersionTLS13), state.Version)
+
+	// a double certificate server in the TLS 1.3 mode
+	serverConfig.GMSupport.EnableTLS13Mode()
+	state = handshake(t, serverConfig, tls13GM(clientConfig))
+	require.Equal(t, uint16(tls.VersionTLS13), state.Version)
+	require.Equal(t, tls.TLS_SM4_GCM_SM3, state.CipherSuite)
+}
+
+func TestTLS13GM_Resumption(t *testing.T) {
+	serverConfig, clientConfig := singleCertConfigs(t)
+	serverConfig = tls13GM(serverConfig)
+	clientConfig = tls13GM(clientConfig)
+	clientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	state := handshake(t, serverConfig, clientConfig)
+	require.False(t, state.DidResume)
+	// the PSK binders are computed with SM3
+	state = handshake(t, serverConfig, clientConfig)
+	require.True(t, state.DidResume)
+	require.Equal(t, tls.TLS_SM4_GCM_SM3, state.CipherSuite)
+}
+
+func TestTLS13GM_ExportKeyingMaterial(t *testing.T) {
+	serverConfig, clientConfig := singleCertConfigs(t)
+	state := handshake(t, tls13GM(serverConfig), tls13GM(clientConfig))
+	ekm, err := state.ExportKeyingMaterial("EXPERIMENTAL test", nil, 32)
+	require.Nil(t, err)
+	require.Len(t, ekm, 32)
+}
@@ -1009,7 +1009,7 @@ func (c *Conn) readHandshake() (interface{}, error) {
 			m = new(certificateMsg)
 		}
 	case typeCertificateRequest:
-		if c.config.GMSupport != nil {
+		if c.config.gmssl() {
 			m = &certificateRequestMsgGM{}
 		} else if c.vers == VersionTLS13 {
 			m = new(certificateRequestMsgTLS13)
@@ -1342,8 +1342,8 @@ func (c *Conn) Handshake() error {
 	if c.isClient {
 		c.handshakeErr = c.clientHandshake()
 	} else {
-		if c.config.GMSupport == nil {
-			// TLS Only
+		if c.config.GMSupport == nil || c.config.GMSupport.IsTLS13Mode() {
+			// TLS Only, the SM cipher suites of TLS 1.3 are preferred in the TLS 1.3 mode
 			c.handshakeErr = c.serverHandshake()
 		} else if c.config.GMSupport.IsAutoSwitchMode() {
 			//  GMSSL/TLS Auto switch
@@ -1413,6 +1413,18 @@ func (c *Conn) OCSPResponse() []byte {
 	return c.ocspResponse
 }
 
+// revocationChecker returns the checker of the peer certificates, which
+// consults the OCSP response stapled by the server first
+func (c *Conn) revocationChecker() cmx509.RevocationChecker {
+	if c.config.RevocationChecker == nil || len(c.ocspResponse) == 0 || !c.isClient {
+		return c.config.RevocationChecker
+	}
+	return cmx509.RevocationCheckers{
+		cmx509.NewStapledOCSPChecker(c.ocspResponse),
+		c.config.RevocationChecker,
+	}
+}
+
 // VerifyHostname checks that the peer certificate chain is valid for
 // connecting to host. If so, it returns nil; if not, it returns an error
 // describing the problem.
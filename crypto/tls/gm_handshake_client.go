@@ -254,6 +254,7 @@ func (hs *clientHandshakeStateGM) doFullHandshake() error {
 				CurrentTime:   c.config.time(),
 				DNSName:       c.config.ServerName,
 				Intermediates: x509.NewCertPool(),
+				Revocation:    c.revocationChecker(),
 			}
 			if opts.Roots == nil {
 				opts.Roots = x509.NewCertPool()
@@ -640,6 +640,7 @@ func (hs *serverHandshakeStateGM) processCertsFromClient(certificates [][]byte)
 			CurrentTime:   c.config.time(),
 			Intermediates: cmx509.NewCertPool(),
 			KeyUsages:     []gox509.ExtKeyUsage{gox509.ExtKeyUsageClientAuth},
+			Revocation:    c.revocationChecker(),
 		}
 
 		for _, cert := range certs[1:] {
@@ -219,6 +219,7 @@ func mutualCipherSuiteGM(have []uint16, want uint16) *cipherSuite {
 const (
 	ModeGMSSLOnly  = "GMSSLOnly"  // only support GMSSL
 	ModeAutoSwitch = "AutoSwitch" // support GMSSL/TLS auto switch
+	ModeTLS13      = "TLS13"      // TLS with the SM cipher suites of TLS 1.3 (RFC 8998) preferred
 )
 
 type GMSupport struct {
@@ -247,6 +248,17 @@ func (support *GMSupport) EnableMixMode() {
 	support.WorkMode = ModeAutoSwitch
 }
 
+// EnableTLS13Mode 启用 TLS 1.3 国密套件 (RFC 8998) 的工作模式，
+// 使用 TLS 协议握手，优先协商 TLS_SM4_GCM_SM3/TLS_SM4_CCM_SM3 套件与 curveSM2 密钥交换
+func (support *GMSupport) EnableTLS13Mode() {
+	support.WorkMode = ModeTLS13
+}
+
+// IsTLS13Mode 是否处于 TLS 1.3 国密套件工作模式
+func (support *GMSupport) IsTLS13Mode() bool {
+	return support.WorkMode == ModeTLS13
+}
+
 // IsAutoSwitchMode 是否处于混合工作模式
 // return true - GMSSL/TLS 均支持, false - 不处于混合模式
 func (support *GMSupport) IsAutoSwitchMode() bool {
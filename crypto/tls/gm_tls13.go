@@ -0,0 +1,365 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tls
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	cmcrypto "chainmaker.org/chainmaker/common/v2/crypto"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+// This file contains the SM cipher suites of TLS 1.3, see RFC 8998. They
+// use SM4 in the GCM or CCM mode, SM3 in the key schedule, SM2 signatures
+// (sm2sig_sm3) and the curveSM2 key share (SM2P256V1).
+
+// gmCipherSuitesTLS13 the RFC 8998 cipher suites in preference order
+var gmCipherSuitesTLS13 = []uint16{
+	TLS_SM4_GCM_SM3,
+	TLS_SM4_CCM_SM3,
+}
+
+// gmCurvePreferences the curve preferences with GMSupport, curveSM2 first
+var gmCurvePreferences = []CurveID{CurveSM2, X25519, CurveP256, CurveP384, CurveP521}
+
+// tls13CipherSuites returns the TLS 1.3 cipher suites in preference order.
+// With GMSupport the RFC 8998 suites come first, restricted to and ordered
+// as in CipherSuites if it lists any of them; without it they are not offered.
+func (c *Config) tls13CipherSuites() []uint16 {
+	if c == nil || c.GMSupport == nil {
+		return defaultCipherSuitesTLS13()
+	}
+	suites := make([]uint16, 0, len(defaultCipherSuitesTLS13())+len(gmCipherSuitesTLS13))
+	for _, id := range c.CipherSuites {
+		for _, gmID := range gmCipherSuitesTLS13 {
+			if id == gmID {
+				suites = append(suites, id)
+				break
+			}
+		}
+	}
+	if len(suites) == 0 {
+		suites = append(suites, gmCipherSuitesTLS13...)
+	}
+	return append(suites, defaultCipherSuitesTLS13()...)
+}
+
+// gmssl whether the handshake of a client uses the GMSSL protocol, GMSupport
+// in the TLS 1.3 working mode negotiates TLS with the RFC 8998 suites instead
+func (c *Config) gmssl() bool {
+	return c.GMSupport != nil && !c.GMSupport.IsTLS13Mode()
+}
+
+// tls13SM2UID the distinguishing ID of the sm2sig_sm3 signatures of the
+// CertificateVerify messages, see RFC 8998, Section 3.2.1
+const tls13SM2UID = "TLSv1.3+GM+Cipher+Suite"
+
+// sm2SignerWithOpts is implemented by the SM2 keys which sign with a given
+// distinguishing ID, as the keys of the crypto package do
+type sm2SignerWithOpts interface {
+	SignWithOpts(msg []byte, opts *cmcrypto.SignOpts) ([]byte, error)
+}
+
+// signCertificateVerify signs the message of a TLS 1.3 CertificateVerify.
+// The SM2 signatures use the distinguishing ID of RFC 8998.
+func signCertificateVerify(rand io.Reader, priv crypto.Signer, sigType uint8, signed []byte,
+	signOpts crypto.SignerOpts) ([]byte, error) {
+	if sigType != signatureSM2 {
+		return priv.Sign(rand, signed, signOpts)
+	}
+	switch key := priv.(type) {
+	case *sm2.PrivateKey:
+		r, s, err := sm2.Sm2Sign(key, signed, []byte(tls13SM2UID), rand)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(ecdsaSignature{R: r, S: s})
+	case sm2SignerWithOpts:
+		return key.SignWithOpts(signed, &cmcrypto.SignOpts{Hash: cmcrypto.HASH_TYPE_SM3, UID: tls13SM2UID})
+	}
+	return nil, fmt.Errorf("tls: SM2 key %T does not sign with the TLS 1.3 distinguishing ID", priv)
+}
+
+// verifyCertificateVerify verifies the signature of a TLS 1.3
+// CertificateVerify. The SM2 signatures use the distinguishing ID of RFC 8998.
+func verifyCertificateVerify(sigType uint8, pubkey crypto.PublicKey, hashFunc crypto.Hash, signed, sig []byte) error {
+	if sigType != signatureSM2 {
+		return verifyHandshakeSignature(sigType, pubkey, hashFunc, signed, sig)
+	}
+	if cmPubkey, ok := pubkey.(cmcrypto.PublicKey); ok {
+		pubkey = cmPubkey.ToStandardKey()
+	}
+	pubKey, ok := pubkey.(*sm2.PublicKey)
+	if !ok {
+		return errors.New("tls: SM2 signing requires a SM2 public key")
+	}
+	sm2Sig := new(ecdsaSignature)
+	if rest, err := asn1.Unmarshal(sig, sm2Sig); err != nil || len(rest) != 0 {
+		return errors.New("verify sm2 signature error")
+	}
+	if !sm2.Sm2Verify(pubKey, signed, []byte(tls13SM2UID), sm2Sig.R, sm2Sig.S) {
+		return errors.New("verify sm2 signature error")
+	}
+	return nil
+}
+
+// tls13Hash is the hash of a TLS 1.3 cipher suite. It extends crypto.Hash
+// with SM3, which is not registered in the standard library.
+type tls13Hash crypto.Hash
+
+// New returns a new hash.Hash calculating the given hash function
+func (h tls13Hash) New() hash.Hash {
+	if crypto.Hash(h) == cmcrypto.SM3 {
+		return &sm3Digest{Hash: sm3.New()}
+	}
+	return crypto.Hash(h).New()
+}
+
+// Size returns the length, in bytes, of a digest resulting from the given hash function
+func (h tls13Hash) Size() int {
+	if crypto.Hash(h) == cmcrypto.SM3 {
+		return sm3Size
+	}
+	return crypto.Hash(h).Size()
+}
+
+const sm3Size = 32
+
+// sm3Digest adapts the SM3 of tjfoc to the TLS 1.3 handshake: Sum leaves the
+// state unchanged whatever b is, and the state can be cloned with
+// MarshalBinary and UnmarshalBinary like the hashes of the standard library.
+// The state being the data written, it is only meant for short inputs such as
+// a handshake transcript.
+type sm3Digest struct {
+	hash.Hash
+	data []byte
+}
+
+func (d *sm3Digest) Write(p []byte) (int, error) {
+	d.data = append(d.data, p...)
+	return d.Hash.Write(p)
+}
+
+func (d *sm3Digest) Sum(b []byte) []byte {
+	return append(b, d.Hash.Sum(nil)...)
+}
+
+func (d *sm3Digest) Reset() {
+	d.Hash.Reset()
+	d.data = d.data[:0]
+}
+
+func (d *sm3Digest) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), d.data...), nil
+}
+
+func (d *sm3Digest) UnmarshalBinary(data []byte) error {
+	d.Reset()
+	_, err := d.Write(data)
+	return err
+}
+
+func aeadSM4GCMTLS13(key, nonceMask []byte) cipher.AEAD {
+	if len(nonceMask) != aeadNonceLength {
+		panic("tls: internal error: wrong nonce length")
+	}
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	ret := &xorNonceAEAD{aead: aead}
+	copy(ret.nonceMask[:], nonceMask)
+	return ret
+}
+
+func aeadSM4CCMTLS13(key, nonceMask []byte) cipher.AEAD {
+	if len(nonceMask) != aeadNonceLength {
+		panic("tls: internal error: wrong nonce length")
+	}
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := newCCM(block, aeadNonceLength, ccmTagSize)
+	if err != nil {
+		panic(err)
+	}
+
+	ret := &xorNonceAEAD{aead: aead}
+	copy(ret.nonceMask[:], nonceMask)
+	return ret
+}
+
+// the tag length of the CCM cipher suites of TLS 1.3, see RFC 8998, Section 3.1
+const ccmTagSize = 16
+
+var errOpen = errors.New("tls: message authentication failed")
+
+// ccm is the CCM mode of NIST SP 800-38C over a 128-bit block cipher
+type ccm struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+}
+
+// newCCM returns the CCM mode of block, nonceSize in [7, 13], tagSize even in [4, 16]
+func newCCM(block cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.New("tls: CCM requires a 128-bit block cipher")
+	}
+	if nonceSize < 7 || nonceSize > 13 {
+		return nil, errors.New("tls: invalid CCM nonce size")
+	}
+	if tagSize < 4 || tagSize > 16 || tagSize&1 != 0 {
+		return nil, errors.New("tls: invalid CCM tag size")
+	}
+	return &ccm{block: block, nonceSize: nonceSize, tagSize: tagSize}, nil
+}
+
+func (c *ccm) NonceSize() int { return c.nonceSize }
+func (c *ccm) Overhead() int  { return c.tagSize }
+
+// maxLength the largest plaintext whose length fits in the 15-nonceSize bytes of the counter
+func (c *ccm) maxLength() uint64 {
+	if l := 15 - c.nonceSize; l < 8 {
+		return 1<<(8*uint(l)) - 1
+	}
+	return 1<<64 - 1
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != c.nonceSize {
+		panic("tls: incorrect nonce length given to CCM")
+	}
+	if uint64(len(plaintext)) > c.maxLength() {
+		panic("tls: message too large for CCM")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+c.tagSize)
+	tag := c.mac(nonce, plaintext, additionalData)
+	c.ctr(nonce, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], tag)
+	return ret
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != c.nonceSize {
+		panic("tls: incorrect nonce length given to CCM")
+	}
+	if len(ciphertext) < c.tagSize || uint64(len(ciphertext)-c.tagSize) > c.maxLength() {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-c.tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-c.tagSize]
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	c.ctr(nonce, out, ciphertext)
+	if subtle.ConstantTimeCompare(c.mac(nonce, out, additionalData), tag) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+// mac returns the tag of the message encrypted with the first counter block,
+// see NIST SP 800-38C, Section 6.1
+func (c *ccm) mac(nonce, plaintext, additionalData []byte) []byte {
+	var b0, x [16]byte
+	l := 15 - c.nonceSize
+	b0[0] = byte((c.tagSize-2)/2<<3 | (l - 1))
+	if len(additionalData) > 0 {
+		b0[0] |= 0x40
+	}
+	copy(b0[1:], nonce)
+	n := uint64(len(plaintext))
+	for i := 15; i > c.nonceSize; i-- {
+		b0[i] = byte(n)
+		n >>= 8
+	}
+	c.block.Encrypt(x[:], b0[:])
+
+	if len(additionalData) > 0 {
+		// the length of the associated data prefixes it, see NIST SP 800-38C, Appendix A.2.2
+		var header []byte
+		if len(additionalData) < 1<<16-1<<8 {
+			header = make([]byte, 2, 2+len(additionalData))
+			binary.BigEndian.PutUint16(header, uint16(len(additionalData)))
+		} else {
+			header = make([]byte, 6, 6+len(additionalData))
+			header[0], header[1] = 0xff, 0xfe
+			binary.BigEndian.PutUint32(header[2:], uint32(len(additionalData)))
+		}
+		c.cbcMAC(&x, append(header, additionalData...))
+	}
+	c.cbcMAC(&x, plaintext)
+
+	var s0 [16]byte
+	c.counter(&s0, nonce, 0)
+	c.block.Encrypt(s0[:], s0[:])
+	tag := make([]byte, c.tagSize)
+	xorBytes(tag, x[:c.tagSize], s0[:c.tagSize])
+	return tag
+}
+
+// cbcMAC chains the blocks of data, zero padded, into x
+func (c *ccm) cbcMAC(x *[16]byte, data []byte) {
+	for len(data) > 0 {
+		n := xorBytes(x[:], x[:], data)
+		data = data[n:]
+		c.block.Encrypt(x[:], x[:])
+	}
+}
+
+// ctr encrypts src into dst with the counter blocks starting at 1
+func (c *ccm) ctr(nonce, dst, src []byte) {
+	var ctr, stream [16]byte
+	for i := uint64(1); len(src) > 0; i++ {
+		c.counter(&ctr, nonce, i)
+		c.block.Encrypt(stream[:], ctr[:])
+		n := xorBytes(dst, src, stream[:])
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// counter sets the counter block i of the nonce
+func (c *ccm) counter(ctr *[16]byte, nonce []byte, i uint64) {
+	*ctr = [16]byte{}
+	ctr[0] = byte(14 - c.nonceSize)
+	copy(ctr[1:], nonce)
+	for j := 15; j > c.nonceSize; j-- {
+		ctr[j] = byte(i)
+		i >>= 8
+	}
+}
+
+// xorBytes sets dst[i] = x[i] ^ y[i] for the shortest of the slices and returns its length
+func xorBytes(dst, x, y []byte) int {
+	n := len(x)
+	if len(y) < n {
+		n = len(y)
+	}
+	for i := 0; i < n; i++ {
+		dst[i] = x[i] ^ y[i]
+	}
+	return n
+}
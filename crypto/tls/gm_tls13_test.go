@@ -0,0 +1,186 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	cmcrypto "chainmaker.org/chainmaker/common/v2/crypto"
+	"github.com/stretchr/testify/require"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.Nil(t, err)
+	return b
+}
+
+func testAEAD(t *testing.T, aead cipher.AEAD, nonce, plaintext, additionalData, ciphertext []byte) {
+	sealed := aead.Seal(nil, nonce, plaintext, additionalData)
+	require.Equal(t, ciphertext, sealed)
+	opened, err := aead.Open(nil, nonce, sealed, additionalData)
+	require.Nil(t, err)
+	require.Equal(t, plaintext, opened)
+
+	// in place, as the records are
+	buf := append([]byte(nil), plaintext...)
+	sealed = aead.Seal(buf[:0], nonce, buf, additionalData)
+	require.Equal(t, ciphertext, sealed)
+	opened, err = aead.Open(sealed[:0], nonce, sealed, additionalData)
+	require.Nil(t, err)
+	require.Equal(t, plaintext, opened)
+
+	sealed = aead.Seal(nil, nonce, plaintext, additionalData)
+	sealed[0] ^= 1
+	_, err = aead.Open(nil, nonce, sealed, additionalData)
+	require.NotNil(t, err)
+	sealed[0] ^= 1
+	_, err = aead.Open(nil, nonce, sealed, append([]byte{0}, additionalData...))
+	require.NotNil(t, err)
+	_, err = aead.Open(nil, nonce, sealed[:aead.Overhead()-1], additionalData)
+	require.NotNil(t, err)
+}
+
+func TestCCM(t *testing.T) {
+	// NIST SP 800-38C, Appendix C, Example 1
+	block, err := aes.NewCipher(decodeHex(t, "404142434445464748494a4b4c4d4e4f"))
+	require.Nil(t, err)
+	aead, err := newCCM(block, 7, 4)
+	require.Nil(t, err)
+	testAEAD(t, aead, decodeHex(t, "10111213141516"), decodeHex(t, "20212223"),
+		decodeHex(t, "0001020304050607"), decodeHex(t, "7162015b4dac255d"))
+
+	// RFC 3610, Packet Vector #1
+	block, err = aes.NewCipher(decodeHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf"))
+	require.Nil(t, err)
+	aead, err = newCCM(block, 13, 8)
+	require.Nil(t, err)
+	testAEAD(t, aead, decodeHex(t, "00000003020100a0a1a2a3a4a5"),
+		decodeHex(t, "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e"), decodeHex(t, "0001020304050607"),
+		decodeHex(t, "588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0"))
+
+	_, err = newCCM(block, 6, 16)
+	require.NotNil(t, err)
+	_, err = newCCM(block, 12, 15)
+	require.NotNil(t, err)
+}
+
+// RFC 8998, Appendix A
+func TestSM4AEAD(t *testing.T) {
+	key := decodeHex(t, "0123456789abcdeffedcba9876543210")
+	nonce := decodeHex(t, "00001234567800000000abcd")
+	additionalData := decodeHex(t, "feedfacedeadbeeffeedfacedeadbeefabaddad2")
+	plaintext := decodeHex(t, "aaaaaaaaaaaaaaaabbbbbbbbbbbbbbbbccccccccccccccccdddddddddddddddd"+
+		"eeeeeeeeeeeeeeeeffffffffffffffffeeeeeeeeeeeeeeeeaaaaaaaaaaaaaaaa")
+	block, err := sm4.NewCipher(key)
+	require.Nil(t, err)
+
+	gcm, err := cipher.NewGCM(block)
+	require.Nil(t, err)
+	testAEAD(t, gcm, nonce, plaintext, additionalData, decodeHex(t,
+		"17f399f08c67d5ee19d0dc9969c4bb7d5fd46fd3756489069157b282bb200735"+
+			"d82710ca5c22f0ccfa7cbf93d496ac15a56834cbcf98c397b4024a2691233b8d"+
+			"83de3541e4c2b58177e065a9bf7b62ec"))
+
+	ccm, err := newCCM(block, aeadNonceLength, ccmTagSize)
+	require.Nil(t, err)
+	testAEAD(t, ccm, nonce, plaintext, additionalData, decodeHex(t,
+		"48af93501fa62adbcd414cce6034d895dda1bf8f132f042098661572e7483094"+
+			"fd12e518ce062c98acee28d95df4416bed31a2f04476c18bb40c84a74b97dc5b"+
+			"16842d4fa186f56ab33256971fa110f4"))
+
+	// the record nonce is the sequence number xored into the IV
+	for _, id := range gmCipherSuitesTLS13 {
+		suite := cipherSuiteTLS13ByID(id)
+		require.NotNil(t, suite)
+		aead := suite.aead(key, nonce)
+		sealed := aead.Seal(nil, make([]byte, 8), plaintext, additionalData)
+		require.Len(t, sealed, len(plaintext)+16)
+		opened, err := aead.Open(nil, make([]byte, 8), sealed, additionalData)
+		require.Nil(t, err)
+		require.Equal(t, plaintext, opened)
+	}
+}
+
+func TestSM3Digest(t *testing.T) {
+	h := tls13Hash(cipherSuiteTLS13ByID(TLS_SM4_GCM_SM3).hash)
+	require.Equal(t, sm3Size, h.Size())
+
+	d := h.New()
+	d.Write([]byte("abc"))
+	// GB/T 32905-2016, Appendix A.1
+	require.Equal(t, "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0", hex.EncodeToString(d.Sum(nil)))
+	// Sum appends without writing
+	prefix := []byte("prefix")
+	require.Equal(t, append(append([]byte(nil), prefix...), d.Sum(nil)...), d.Sum(prefix))
+	require.Equal(t, sm3.Sm3Sum([]byte("abc")), d.Sum(nil))
+
+	clone := cloneHash(d, h)
+	require.NotNil(t, clone)
+	d.Write([]byte("def"))
+	require.Equal(t, sm3.Sm3Sum([]byte("abc")), clone.Sum(nil))
+	clone.Write([]byte("def"))
+	require.True(t, bytes.Equal(d.Sum(nil), clone.Sum(nil)))
+	d.Reset()
+	require.Equal(t, sm3.Sm3Sum(nil), d.Sum(nil))
+}
+
+func TestTLS13CipherSuites(t *testing.T) {
+	config := &Config{}
+	suites := config.tls13CipherSuites()
+	require.Equal(t, defaultCipherSuitesTLS13(), suites)
+	require.Equal(t, defaultCurvePreferences, config.curvePreferences())
+
+	config.GMSupport = NewGMSupport()
+	config.GMSupport.EnableTLS13Mode()
+	require.False(t, config.gmssl())
+	suites = config.tls13CipherSuites()
+	require.Equal(t, gmCipherSuitesTLS13, suites[:len(gmCipherSuitesTLS13)])
+	require.Equal(t, CurveSM2, config.curvePreferences()[0])
+
+	config.CipherSuites = []uint16{GMTLS_ECC_SM4_GCM_SM3, TLS_SM4_CCM_SM3}
+	suites = config.tls13CipherSuites()
+	require.Equal(t, []uint16{TLS_SM4_CCM_SM3}, suites[:len(suites)-len(defaultCipherSuitesTLS13())])
+	require.Equal(t, "TLS_SM4_CCM_SM3", CipherSuiteName(TLS_SM4_CCM_SM3))
+}
+
+func TestCertificateVerifySM2(t *testing.T) {
+	// GB/T 32918.2-2016, Appendix A.2
+	d, ok := new(big.Int).SetString("3945208f7b2144b13f36e38ac6d39f95889393692860b51a42fb81ef4df7c5b8", 16)
+	require.True(t, ok)
+	priv := &sm2.PrivateKey{D: d}
+	priv.Curve = sm2.P256Sm2()
+	priv.X, priv.Y = priv.Curve.ScalarBaseMult(d.Bytes())
+	require.Equal(t, "9f9df311e5421a150dd7d161e4bc5c672179fad1833fc076bb08ff356f35020", priv.X.Text(16))
+	signed := []byte("TLS 1.3, server CertificateVerify")
+
+	// signed with the distinguishing ID of RFC 8998, not the default one
+	sig := decodeHex(t, "304602210090d320b71443ec65704ea2e3dc0f0fa8c90ac8a2b86a9860629cc935f107d16a"+
+		"022100e5b3cfbe7943672380eb4600aaecf8bccf523959865cd08cbe90f2549356211b")
+	require.Nil(t, verifyCertificateVerify(signatureSM2, &priv.PublicKey, cmcrypto.SM3, signed, sig))
+	require.NotNil(t, verifyHandshakeSignature(signatureSM2, &priv.PublicKey, cmcrypto.SM3, signed, sig))
+	sig[len(sig)-1] ^= 1
+	require.NotNil(t, verifyCertificateVerify(signatureSM2, &priv.PublicKey, cmcrypto.SM3, signed, sig))
+
+	sig, err := signCertificateVerify(rand.Reader, priv, signatureSM2, signed, cmcrypto.SM3)
+	require.Nil(t, err)
+	require.Nil(t, verifyCertificateVerify(signatureSM2, &priv.PublicKey, cmcrypto.SM3, signed, sig))
+	require.False(t, priv.PublicKey.Verify(signed, sig))
+	_, err = signCertificateVerify(rand.Reader, struct{ crypto.Signer }{priv}, signatureSM2, signed, cmcrypto.SM3)
+	require.NotNil(t, err)
+}
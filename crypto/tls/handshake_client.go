@@ -119,7 +119,7 @@ func (c *Conn) makeClientHello() (*clientHelloMsg, ecdheParameters, error) {
 
 	var params ecdheParameters
 	if hello.supportedVersions[0] == VersionTLS13 {
-		hello.cipherSuites = append(hello.cipherSuites, defaultCipherSuitesTLS13()...)
+		hello.cipherSuites = append(hello.cipherSuites, config.tls13CipherSuites()...)
 
 		curveID := config.curvePreferences()[0]
 		if _, ok := curveForCurveID(curveID); curveID != X25519 && !ok {
@@ -139,6 +139,15 @@ func (c *Conn) clientHandshake() (err error) {
 	if c.config == nil {
 		c.config = defaultConfig()
 	}
+	if c.handshakes == 0 && c.config.GetConfigForServer != nil {
+		config, err := c.config.GetConfigForServer(c.config)
+		if err != nil {
+			return err
+		}
+		if config != nil {
+			c.config = config
+		}
+	}
 
 	// This may be a renegotiation handshake, in which case some fields
 	// need to be reset.
@@ -146,7 +155,7 @@ func (c *Conn) clientHandshake() (err error) {
 
 	var hello *clientHelloMsg
 	var ecdheParams ecdheParameters
-	if c.config.GMSupport != nil {
+	if c.config.gmssl() {
 		c.vers = VersionGMSSL
 		hello, err = makeClientHelloGM(c.config)
 	} else {
@@ -172,7 +181,7 @@ func (c *Conn) clientHandshake() (err error) {
 	}
 
 	var serverHello *serverHelloMsg
-	if c.config.GMSupport != nil {
+	if c.config.gmssl() {
 		if session != nil {
 			hello.sessionTicket = session.sessionTicket
 			// A random session ID is used to detect when the
@@ -220,7 +229,7 @@ func (c *Conn) clientHandshake() (err error) {
 		return hs.handshake()
 	}
 
-	if c.config.GMSupport != nil {
+	if c.config.gmssl() {
 		hs := &clientHandshakeStateGM{
 			c:       c,
 			hello:   hello,
@@ -849,6 +858,7 @@ func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
 			CurrentTime:   c.config.time(),
 			DNSName:       c.config.ServerName,
 			Intermediates: cmx509.NewCertPool(),
+			Revocation:    c.revocationChecker(),
 		}
 		for _, cert := range certs[1:] {
 			opts.Intermediates.AddCert(cert)
@@ -756,6 +756,7 @@ func (c *Conn) processCertsFromClient(certificate Certificate) error {
 			CurrentTime:   c.config.time(),
 			Intermediates: cmx509.NewCertPool(),
 			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			Revocation:    c.revocationChecker(),
 		}
 
 		for _, cert := range certs[1:] {
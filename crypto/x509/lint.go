@@ -0,0 +1,381 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package x509
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	bccrypto "chainmaker.org/chainmaker/common/v2/crypto"
+)
+
+// LintSeverity the severity of a lint finding
+type LintSeverity int
+
+const (
+	// LintWarning a finding which does not prevent the certificate from being used
+	LintWarning LintSeverity = iota + 1
+	// LintError a breach of the chain rules
+	LintError
+)
+
+// String implements fmt.Stringer
+func (s LintSeverity) String() string {
+	switch s {
+	case LintWarning:
+		return "warning"
+	case LintError:
+		return "error"
+	default:
+		return fmt.Sprintf("LintSeverity(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, for the JSON reports
+func (s LintSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// DefaultLintOUs the roles of the certificates of the members of a chain
+var DefaultLintOUs = []string{"consensus", "common", "client", "light", "admin"}
+
+const (
+	defaultLintMaxValidity   = 10 * 365 * 24 * time.Hour
+	defaultLintMaxCAValidity = 20 * 365 * 24 * time.Hour
+)
+
+// LintOptions the chain configuration the certificates are checked against,
+// the zero values select the defaults
+type LintOptions struct {
+	// KeyTypes the public key types allowed by the chain, any if empty
+	KeyTypes []bccrypto.KeyType
+	// OrganizationalUnits the roles allowed for the end-entity certificates, DefaultLintOUs if empty
+	OrganizationalUnits []string
+	// MaxValidity and MaxCAValidity the longest validity periods of the
+	// end-entity and CA certificates, 10 and 20 years by default
+	MaxValidity   time.Duration
+	MaxCAValidity time.Duration
+	// CurrentTime the time of the expiry checks, now if zero
+	CurrentTime time.Time
+}
+
+// LintFinding a problem a rule found in a certificate
+type LintFinding struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+// LintRule checks that a certificate follows a chain rule
+type LintRule interface {
+	// Name identifies the rule in the reports
+	Name() string
+	// Lint returns the findings of the certificate, none if it follows the rule
+	Lint(cert *Certificate, opts *LintOptions) []LintFinding
+}
+
+type lintRuleFunc struct {
+	name string
+	lint func(cert *Certificate, opts *LintOptions) []LintFinding
+}
+
+// NewLintRule returns the rule of the function, whose findings need no Rule name
+func NewLintRule(name string, lint func(cert *Certificate, opts *LintOptions) []LintFinding) LintRule {
+	return &lintRuleFunc{name: name, lint: lint}
+}
+
+func (r *lintRuleFunc) Name() string {
+	return r.name
+}
+
+func (r *lintRuleFunc) Lint(cert *Certificate, opts *LintOptions) []LintFinding {
+	return r.lint(cert, opts)
+}
+
+// LintReport the findings of the rules in a certificate
+type LintReport struct {
+	Subject      string        `json:"subject"`
+	SerialNumber string        `json:"serial_number"`
+	Findings     []LintFinding `json:"findings"`
+	Errors       int           `json:"errors"`
+	Warnings     int           `json:"warnings"`
+}
+
+// String returns the findings, one per line
+func (r *LintReport) String() string {
+	var b strings.Builder
+	status := "ok"
+	if r.Errors > 0 {
+		status = "failed"
+	}
+	fmt.Fprintf(&b, "%s, subject: %s, serial number: %s, errors: %d, warnings: %d",
+		status, r.Subject, r.SerialNumber, r.Errors, r.Warnings)
+	for _, f := range r.Findings {
+		fmt.Fprintf(&b, "\n  %s [%s] %s", f.Severity, f.Rule, f.Message)
+	}
+	return b.String()
+}
+
+// Linter checks certificates against a set of rules
+type Linter struct {
+	rules []LintRule
+}
+
+// NewLinter returns the linter of the rules, DefaultLintRules if none
+func NewLinter(rules ...LintRule) *Linter {
+	if len(rules) == 0 {
+		rules = DefaultLintRules()
+	}
+	return &Linter{rules: rules}
+}
+
+// Lint checks the certificate against each rule
+func (l *Linter) Lint(cert *Certificate, opts *LintOptions) *LintReport {
+	if opts == nil {
+		opts = &LintOptions{}
+	}
+	report := &LintReport{
+		Subject:      cert.Subject.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		Findings:     []LintFinding{},
+	}
+	for _, rule := range l.rules {
+		for _, f := range rule.Lint(cert, opts) {
+			f.Rule = rule.Name()
+			switch f.Severity {
+			case LintError:
+				report.Errors++
+			case LintWarning:
+				report.Warnings++
+			}
+			report.Findings = append(report.Findings, f)
+		}
+	}
+	return report
+}
+
+// LintPEM checks each certificate of the PEM blocks
+func (l *Linter) LintPEM(certPEM []byte, opts *LintOptions) ([]*LintReport, error) {
+	var reports []*LintReport
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse certificate: [%v]", err)
+		}
+		reports = append(reports, l.Lint(cert, opts))
+	}
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("fail to parse certificate")
+	}
+	return reports, nil
+}
+
+// DefaultLintRules returns the rules of the certificates of a chain
+func DefaultLintRules() []LintRule {
+	return []LintRule{
+		NewLintRule("key_type", lintKeyType),
+		NewLintRule("basic_constraints", lintBasicConstraints),
+		NewLintRule("organizational_unit", lintOrganizationalUnit),
+		NewLintRule("key_identifiers", lintKeyIdentifiers),
+		NewLintRule("validity", lintValidity),
+		NewLintRule("subject_alt_names", lintSubjectAltNames),
+	}
+}
+
+func lintErrorf(format string, args ...interface{}) LintFinding {
+	return LintFinding{Severity: LintError, Message: fmt.Sprintf(format, args...)}
+}
+
+func lintWarningf(format string, args ...interface{}) LintFinding {
+	return LintFinding{Severity: LintWarning, Message: fmt.Sprintf(format, args...)}
+}
+
+// lintKeyType checks that the key is of a type of the chain, and not a weak RSA key
+func lintKeyType(cert *Certificate, opts *LintOptions) []LintFinding {
+	if cert.PublicKey == nil {
+		return []LintFinding{lintErrorf("unsupported public key")}
+	}
+	keyType := cert.PublicKey.Type()
+	name := bccrypto.KeyType2NameMap[keyType]
+	var findings []LintFinding
+	if keyType == bccrypto.RSA512 || keyType == bccrypto.RSA1024 {
+		findings = append(findings, lintErrorf("weak key %s", name))
+	}
+	if len(opts.KeyTypes) == 0 {
+		return findings
+	}
+	for _, allowed := range opts.KeyTypes {
+		if keyType == allowed {
+			return findings
+		}
+	}
+	return append(findings, lintErrorf("key %s not allowed by the chain", name))
+}
+
+// lintBasicConstraints checks that only the CA certificates may sign certificates
+func lintBasicConstraints(cert *Certificate, opts *LintOptions) []LintFinding {
+	certSign := cert.KeyUsage&x509.KeyUsageCertSign != 0
+	if cert.IsCA {
+		if !cert.BasicConstraintsValid {
+			return []LintFinding{lintErrorf("CA certificate without basic constraints")}
+		}
+		if !certSign {
+			return []LintFinding{lintErrorf("CA certificate without the cert sign key usage")}
+		}
+		return nil
+	}
+	if certSign {
+		return []LintFinding{lintErrorf("end-entity certificate with the cert sign key usage")}
+	}
+	return nil
+}
+
+// lintOrganizationalUnit checks that the OU of an end-entity certificate is a role of the chain
+func lintOrganizationalUnit(cert *Certificate, opts *LintOptions) []LintFinding {
+	if cert.IsCA {
+		return nil
+	}
+	allowed := opts.OrganizationalUnits
+	if len(allowed) == 0 {
+		allowed = DefaultLintOUs
+	}
+	ous := cert.Subject.OrganizationalUnit
+	if len(ous) == 0 {
+		return []LintFinding{lintErrorf("no organizational unit, one of %s expected", strings.Join(allowed, ", "))}
+	}
+	var findings []LintFinding
+	if len(ous) > 1 {
+		findings = append(findings, lintWarningf("%d organizational units, the role is the first one", len(ous)))
+	}
+	for _, ou := range allowed {
+		if ous[0] == ou {
+			return findings
+		}
+	}
+	return append(findings, lintErrorf("organizational unit %q, one of %s expected", ous[0], strings.Join(allowed, ", ")))
+}
+
+// lintKeyIdentifiers checks that the SKI, and the AKI unless self-signed, are present
+func lintKeyIdentifiers(cert *Certificate, opts *LintOptions) []LintFinding {
+	var findings []LintFinding
+	if len(cert.SubjectKeyId) == 0 {
+		findings = append(findings, lintErrorf("no subject key identifier"))
+	}
+	if len(cert.AuthorityKeyId) == 0 && !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		findings = append(findings, lintErrorf("no authority key identifier"))
+	}
+	return findings
+}
+
+// lintValidity checks that the validity period is bounded, and current
+func lintValidity(cert *Certificate, opts *LintOptions) []LintFinding {
+	if !cert.NotAfter.After(cert.NotBefore) {
+		return []LintFinding{lintErrorf("not after %s is not after not before %s",
+			cert.NotAfter.UTC().Format(time.RFC3339), cert.NotBefore.UTC().Format(time.RFC3339))}
+	}
+
+	maxValidity, maxValidityOpt := defaultLintMaxValidity, opts.MaxValidity
+	if cert.IsCA {
+		maxValidity, maxValidityOpt = defaultLintMaxCAValidity, opts.MaxCAValidity
+	}
+	if maxValidityOpt > 0 {
+		maxValidity = maxValidityOpt
+	}
+	var findings []LintFinding
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity > maxValidity {
+		findings = append(findings, lintErrorf("validity of %d days exceeds %d days",
+			validity/(24*time.Hour), maxValidity/(24*time.Hour)))
+	}
+
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if now.Before(cert.NotBefore) {
+		findings = append(findings, lintWarningf("not valid before %s", cert.NotBefore.UTC().Format(time.RFC3339)))
+	} else if now.After(cert.NotAfter) {
+		findings = append(findings, lintWarningf("expired at %s", cert.NotAfter.UTC().Format(time.RFC3339)))
+	}
+	return findings
+}
+
+// lintSubjectAltNames checks that the SANs are well-formed, and that a TLS server certificate has some
+func lintSubjectAltNames(cert *Certificate, opts *LintOptions) []LintFinding {
+	var findings []LintFinding
+	for _, name := range cert.DNSNames {
+		if err := checkDNSName(name); err != nil {
+			findings = append(findings, lintErrorf("DNS name %q %s", name, err.Error()))
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.IsUnspecified() {
+			findings = append(findings, lintWarningf("unspecified IP address %s", ip))
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if at := strings.LastIndex(email, "@"); at <= 0 || checkDNSName(email[at+1:]) != nil {
+			findings = append(findings, lintErrorf("email address %q malformed", email))
+		}
+	}
+	for _, uri := range cert.URIs {
+		if !uri.IsAbs() {
+			findings = append(findings, lintErrorf("URI %q not absolute", uri))
+		}
+	}
+
+	sans := len(cert.DNSNames) + len(cert.IPAddresses) + len(cert.EmailAddresses) + len(cert.URIs)
+	if sans == 0 && !cert.IsCA {
+		for _, usage := range cert.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageServerAuth {
+				findings = append(findings, lintWarningf("TLS server certificate without subject alt names"))
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// checkDNSName checks the syntax of a DNS name, which may start with a wildcard label
+func checkDNSName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("empty")
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("longer than 253 characters")
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 && len(labels) > 2 {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("has a label of %d characters", len(label))
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("has label %q starting or ending with a hyphen", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("has invalid character %q", c)
+			}
+		}
+	}
+	return nil
+}
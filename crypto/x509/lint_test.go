@@ -0,0 +1,137 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package x509
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	bccrypto "chainmaker.org/chainmaker/common/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// lintRules returns the rules of the findings by severity
+func lintRules(report *LintReport) map[string]LintSeverity {
+	rules := make(map[string]LintSeverity)
+	for _, f := range report.Findings {
+		if f.Severity > rules[f.Rule] {
+			rules[f.Rule] = f.Severity
+		}
+	}
+	return rules
+}
+
+func TestLinter(t *testing.T) {
+	for _, gm := range []bool{true, false} {
+		pki := newTestPKI(t, gm)
+		linter := NewLinter()
+		keyTypes := []bccrypto.KeyType{bccrypto.ECC_NISTP256}
+		if gm {
+			keyTypes = []bccrypto.KeyType{bccrypto.SM2}
+		}
+		opts := &LintOptions{KeyTypes: keyTypes}
+
+		// the certificates following the chain rules have no findings
+		report := linter.Lint(pki.cert, opts)
+		require.Empty(t, report.Findings, "%s", report)
+		node := pki.sign(t, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "consensus1.chainmaker.org", OrganizationalUnit: []string{"consensus"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			SubjectKeyId: []byte{5, 6, 7, 8},
+			DNSNames:     []string{"consensus1.chainmaker.org", "*.nodes.chainmaker.org"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}, newTestKey(t, gm))
+		report = linter.Lint(node, opts)
+		require.Empty(t, report.Findings, "%s", report)
+		require.Equal(t, "ok", report.String()[:2])
+
+		// the key type of another chain, an expired certificate
+		report = linter.Lint(node, &LintOptions{
+			KeyTypes:    []bccrypto.KeyType{bccrypto.RSA2048},
+			CurrentTime: node.NotAfter.Add(time.Hour),
+		})
+		require.Equal(t, map[string]LintSeverity{"key_type": LintError, "validity": LintWarning}, lintRules(report))
+		require.Equal(t, 1, report.Errors)
+		require.Equal(t, 1, report.Warnings)
+
+		// each rule reports its findings
+		bad := pki.sign(t, &x509.Certificate{
+			SerialNumber: big.NewInt(3),
+			Subject:      pkix.Name{CommonName: "peer1", OrganizationalUnit: []string{"peer", "consensus"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(11 * 365 * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			SubjectKeyId: []byte{9},
+			DNSNames:     []string{"-peer1.chainmaker.org", "peer1..chainmaker.org", "peer*.chainmaker.org"},
+		}, newTestKey(t, gm))
+		report = linter.Lint(bad, opts)
+		require.Equal(t, map[string]LintSeverity{
+			"basic_constraints":   LintError,
+			"organizational_unit": LintError,
+			"validity":            LintError,
+			"subject_alt_names":   LintError,
+		}, lintRules(report))
+		require.Equal(t, 6, report.Errors)
+		require.Equal(t, 1, report.Warnings)
+		require.Equal(t, "failed", report.String()[:6])
+
+		// the OUs are those of the chain
+		report = linter.Lint(bad, &LintOptions{
+			OrganizationalUnits: []string{"peer"},
+			MaxValidity:         20 * 365 * 24 * time.Hour,
+		})
+		require.Equal(t, map[string]LintSeverity{
+			"basic_constraints":   LintError,
+			"organizational_unit": LintWarning,
+			"subject_alt_names":   LintError,
+		}, lintRules(report))
+	}
+}
+
+func TestLinter_PEM(t *testing.T) {
+	pki := newTestPKI(t, true)
+	leaf, _ := pki.issue(t, x509.ExtKeyUsageServerAuth)
+	certPEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pki.cert.Raw})...)
+
+	// the rules are pluggable
+	linter := NewLinter(append(DefaultLintRules(), NewLintRule("common_name",
+		func(cert *Certificate, opts *LintOptions) []LintFinding {
+			if !strings.HasPrefix(cert.Subject.CommonName, "node.") {
+				return []LintFinding{{Severity: LintWarning, Message: "not a node"}}
+			}
+			return nil
+		}))...)
+	reports, err := linter.LintPEM(certPEM, nil)
+	require.Nil(t, err)
+	require.Len(t, reports, 2)
+	require.Equal(t, map[string]LintSeverity{
+		"organizational_unit": LintError,
+		"key_identifiers":     LintError,
+		"subject_alt_names":   LintWarning,
+	}, lintRules(reports[0]))
+	require.Equal(t, map[string]LintSeverity{"common_name": LintWarning}, lintRules(reports[1]))
+
+	reportJSON, err := json.Marshal(reports[0])
+	require.Nil(t, err)
+	require.Contains(t, string(reportJSON), `"severity":"error"`)
+
+	_, err = linter.LintPEM([]byte("not a certificate"), nil)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,751 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x509
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	bccrypto "chainmaker.org/chainmaker/common/v2/crypto"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+// This file builds and verifies the OCSP requests and responses of RFC 6960,
+// for the SM2 certificates as well as the ECDSA and RSA ones, the CertIDs of
+// the issuers with SM2 keys being hashed with SM3 by default.
+
+var idPKIXOCSPBasic = asn1.ObjectIdentifier([]int{1, 3, 6, 1, 5, 5, 7, 48, 1, 1})
+
+// OCSPResponseStatus contains the result of an OCSP request. See
+// https://tools.ietf.org/html/rfc6960#section-2.3
+type OCSPResponseStatus int
+
+const (
+	OCSPSuccess       OCSPResponseStatus = 0
+	OCSPMalformed     OCSPResponseStatus = 1
+	OCSPInternalError OCSPResponseStatus = 2
+	OCSPTryLater      OCSPResponseStatus = 3
+	// Status code four is unused in OCSP. See
+	// https://tools.ietf.org/html/rfc6960#section-4.2.1
+	OCSPSignatureRequired OCSPResponseStatus = 5
+	OCSPUnauthorized      OCSPResponseStatus = 6
+)
+
+func (r OCSPResponseStatus) String() string {
+	switch r {
+	case OCSPSuccess:
+		return "success"
+	case OCSPMalformed:
+		return "malformed"
+	case OCSPInternalError:
+		return "internal error"
+	case OCSPTryLater:
+		return "try later"
+	case OCSPSignatureRequired:
+		return "signature required"
+	case OCSPUnauthorized:
+		return "unauthorized"
+	default:
+		return "unknown OCSP status: " + strconv.Itoa(int(r))
+	}
+}
+
+// OCSPResponseError is returned by ParseOCSPResponse when the response itself
+// is an error, not just that it's indicating that a certificate is revoked.
+type OCSPResponseError struct {
+	Status OCSPResponseStatus
+}
+
+func (r OCSPResponseError) Error() string {
+	return "x509: error from OCSP server: " + r.Status.String()
+}
+
+// These are internal structures that reflect the ASN.1 structure of an OCSP
+// request and response. See RFC 6960, sections 4.1 and 4.2.
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspTBSRequest struct {
+	Version       int              `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
+	RequestList   []ocspSingleRequest
+}
+
+type ocspSingleRequest struct {
+	Cert ocspCertID
+}
+
+type ocspResponseASN1 struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+var ocspHashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   asn1.ObjectIdentifier([]int{1, 3, 14, 3, 2, 26}),
+	crypto.SHA256: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 1}),
+	crypto.SHA384: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 2}),
+	crypto.SHA512: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 3}),
+	bccrypto.SM3:  asn1.ObjectIdentifier([]int{1, 2, 156, 10197, 1, 401}),
+}
+
+func getOCSPHashFromOID(target asn1.ObjectIdentifier) crypto.Hash {
+	for h, oid := range ocspHashOIDs {
+		if oid.Equal(target) {
+			return h
+		}
+	}
+	return crypto.Hash(0)
+}
+
+func newOCSPHash(h crypto.Hash) (hash.Hash, error) {
+	if h == bccrypto.SM3 {
+		return sm3.New(), nil
+	}
+	if _, ok := ocspHashOIDs[h]; !ok || !h.Available() {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return h.New(), nil
+}
+
+// The status values that can be expressed in OCSP. See RFC 6960.
+const (
+	// OCSPGood means that the certificate is valid.
+	OCSPGood = iota
+	// OCSPRevoked means that the certificate has been deliberately revoked.
+	OCSPRevoked
+	// OCSPUnknown means that the OCSP responder doesn't know about the certificate.
+	OCSPUnknown
+)
+
+// OCSPRequest represents an OCSP request. See RFC 6960.
+type OCSPRequest struct {
+	HashAlgorithm  crypto.Hash
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+// Marshal marshals the OCSP request to ASN.1 DER encoded form.
+func (req *OCSPRequest) Marshal() ([]byte, error) {
+	hashAlg, ok := ocspHashOIDs[req.HashAlgorithm]
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return asn1.Marshal(ocspRequest{
+		ocspTBSRequest{
+			Version: 0,
+			RequestList: []ocspSingleRequest{
+				{
+					Cert: ocspCertID{
+						pkix.AlgorithmIdentifier{
+							Algorithm:  hashAlg,
+							Parameters: asn1.NullRawValue,
+						},
+						req.IssuerNameHash,
+						req.IssuerKeyHash,
+						req.SerialNumber,
+					},
+				},
+			},
+		},
+	})
+}
+
+// OCSPResponse represents an OCSP response containing a single SingleResponse.
+// See RFC 6960.
+type OCSPResponse struct {
+	Raw []byte
+
+	// Status is one of {OCSPGood, OCSPRevoked, OCSPUnknown}
+	Status                                        int
+	SerialNumber                                  *big.Int
+	ProducedAt, ThisUpdate, NextUpdate, RevokedAt time.Time
+	RevocationReason                              int
+	// Certificate is the responder certificate embedded in the response, if any
+	Certificate *Certificate
+	// TBSResponseData contains the raw bytes of the signed response.
+	TBSResponseData    []byte
+	Signature          []byte
+	SignatureAlgorithm SignatureAlgorithm
+
+	// IssuerHash is the hash used to compute the IssuerNameHash and
+	// IssuerKeyHash. If zero when creating a response, the default of
+	// OCSPRequestOptions is used.
+	IssuerHash     crypto.Hash
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+
+	// Extensions contains raw X.509 extensions from the singleExtensions field
+	// of the OCSP response.
+	Extensions []pkix.Extension
+}
+
+// CheckSignatureFrom checks that the signature in resp is a valid signature
+// from issuer.
+func (resp *OCSPResponse) CheckSignatureFrom(issuer *Certificate) error {
+	return issuer.CheckSignature(resp.SignatureAlgorithm, resp.TBSResponseData, resp.Signature)
+}
+
+// OCSPParseError results from an invalid OCSP request or response.
+type OCSPParseError string
+
+func (p OCSPParseError) Error() string {
+	return string(p)
+}
+
+// ParseOCSPRequest parses an OCSP request in DER form. It only supports
+// requests for a single certificate. Signed requests are not supported.
+func ParseOCSPRequest(der []byte) (*OCSPRequest, error) {
+	var req ocspRequest
+	rest, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, OCSPParseError("x509: trailing data in OCSP request")
+	}
+
+	if len(req.TBSRequest.RequestList) == 0 {
+		return nil, OCSPParseError("x509: OCSP request contains no request body")
+	}
+	innerRequest := req.TBSRequest.RequestList[0]
+
+	hashFunc := getOCSPHashFromOID(innerRequest.Cert.HashAlgorithm.Algorithm)
+	if hashFunc == crypto.Hash(0) {
+		return nil, OCSPParseError("x509: OCSP request uses unknown hash function")
+	}
+
+	return &OCSPRequest{
+		HashAlgorithm:  hashFunc,
+		IssuerNameHash: innerRequest.Cert.NameHash,
+		IssuerKeyHash:  innerRequest.Cert.IssuerKeyHash,
+		SerialNumber:   innerRequest.Cert.SerialNumber,
+	}, nil
+}
+
+// ParseOCSPResponse parses an OCSP response in DER form and returns the status
+// of cert, or of its only certificate if cert is nil.
+//
+// If issuer is not nil, the response must be about a certificate of issuer and
+// be signed either by issuer, or by the embedded responder certificate, which
+// issuer must have delegated the OCSP signing to and which must be valid now.
+func ParseOCSPResponse(der []byte, cert, issuer *Certificate) (*OCSPResponse, error) {
+	return parseOCSPResponse(der, cert, issuer, time.Now())
+}
+
+// parseOCSPResponse is ParseOCSPResponse checking the responder certificate at now
+func parseOCSPResponse(der []byte, cert, issuer *Certificate, now time.Time) (*OCSPResponse, error) {
+	var resp ocspResponseASN1
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, OCSPParseError("x509: trailing data in OCSP response")
+	}
+
+	if status := OCSPResponseStatus(resp.Status); status != OCSPSuccess {
+		return nil, OCSPResponseError{status}
+	}
+
+	if !resp.Response.ResponseType.Equal(idPKIXOCSPBasic) {
+		return nil, OCSPParseError("x509: bad OCSP response type")
+	}
+
+	var basicResp ocspBasicResponse
+	rest, err = asn1.Unmarshal(resp.Response.Response, &basicResp)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, OCSPParseError("x509: trailing data in OCSP response")
+	}
+
+	if n := len(basicResp.TBSResponseData.Responses); n == 0 || cert == nil && n > 1 {
+		return nil, OCSPParseError("x509: OCSP response contains bad number of responses")
+	}
+
+	var singleResp ocspSingleResponse
+	if cert == nil {
+		singleResp = basicResp.TBSResponseData.Responses[0]
+	} else {
+		match := false
+		for _, resp := range basicResp.TBSResponseData.Responses {
+			if cert.SerialNumber.Cmp(resp.CertID.SerialNumber) == 0 {
+				singleResp = resp
+				match = true
+				break
+			}
+		}
+		if !match {
+			return nil, OCSPParseError("x509: no OCSP response matching the supplied certificate")
+		}
+	}
+
+	ret := &OCSPResponse{
+		Raw:                der,
+		TBSResponseData:    basicResp.TBSResponseData.Raw,
+		Signature:          basicResp.Signature.RightAlign(),
+		SignatureAlgorithm: getSignatureAlgorithmFromAI(basicResp.SignatureAlgorithm),
+		Extensions:         singleResp.SingleExtensions,
+		SerialNumber:       singleResp.CertID.SerialNumber,
+		ProducedAt:         basicResp.TBSResponseData.ProducedAt,
+		ThisUpdate:         singleResp.ThisUpdate,
+		NextUpdate:         singleResp.NextUpdate,
+		IssuerHash:         getOCSPHashFromOID(singleResp.CertID.HashAlgorithm.Algorithm),
+		IssuerNameHash:     singleResp.CertID.NameHash,
+		IssuerKeyHash:      singleResp.CertID.IssuerKeyHash,
+	}
+	if ret.IssuerHash == 0 {
+		return nil, OCSPParseError("x509: unsupported OCSP issuer hash algorithm")
+	}
+
+	if len(basicResp.Certificates) > 0 {
+		// Responders should only send a single certificate, the one of the
+		// responder, but some send more. All but the first are ignored.
+		ret.Certificate, err = ParseCertificate(basicResp.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if issuer != nil {
+		if err = ret.checkIssuer(issuer, now); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ext := range singleResp.SingleExtensions {
+		if ext.Critical {
+			return nil, OCSPParseError("x509: unsupported critical extension in OCSP response")
+		}
+	}
+
+	switch {
+	case bool(singleResp.Good):
+		ret.Status = OCSPGood
+	case bool(singleResp.Unknown):
+		ret.Status = OCSPUnknown
+	default:
+		ret.Status = OCSPRevoked
+		ret.RevokedAt = singleResp.Revoked.RevocationTime
+		ret.RevocationReason = int(singleResp.Revoked.Reason)
+	}
+
+	return ret, nil
+}
+
+// checkIssuer checks that the response is about a certificate of issuer and
+// is signed by issuer or by a responder it authorized, valid at now, see RFC
+// 6960, Section 4.2.2.2
+func (resp *OCSPResponse) checkIssuer(issuer *Certificate, now time.Time) error {
+	nameHash, keyHash, err := ocspIssuerHashes(issuer, resp.IssuerHash)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(nameHash, resp.IssuerNameHash) || !bytes.Equal(keyHash, resp.IssuerKeyHash) {
+		return OCSPParseError("x509: OCSP response is not about a certificate of the issuer")
+	}
+
+	signer := issuer
+	if resp.Certificate != nil && !resp.Certificate.Equal(issuer) {
+		responder := resp.Certificate
+		if err = issuer.CheckSignature(responder.SignatureAlgorithm, responder.RawTBSCertificate,
+			responder.Signature); err != nil {
+			return OCSPParseError("x509: bad signature on OCSP responder certificate: " + err.Error())
+		}
+		authorized := false
+		for _, usage := range responder.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageOCSPSigning {
+				authorized = true
+				break
+			}
+		}
+		if !authorized {
+			return OCSPParseError("x509: OCSP responder certificate is not authorized for OCSP signing")
+		}
+		if now.Before(responder.NotBefore) || now.After(responder.NotAfter) {
+			return OCSPParseError("x509: OCSP responder certificate is not valid at " +
+				now.UTC().Format(time.RFC3339))
+		}
+		signer = responder
+	}
+
+	if err = resp.CheckSignatureFrom(signer); err != nil {
+		return OCSPParseError("x509: bad OCSP signature: " + err.Error())
+	}
+	return nil
+}
+
+// ocspIssuerHashes returns the hashes of the name and of the public key of issuer
+func ocspIssuerHashes(issuer *Certificate, hashFunc crypto.Hash) (nameHash, keyHash []byte, err error) {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return nil, nil, err
+	}
+
+	h, err := newOCSPHash(hashFunc)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	keyHash = h.Sum(nil)
+
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	nameHash = h.Sum(nil)
+	return nameHash, keyHash, nil
+}
+
+// OCSPRequestOptions contains options for constructing OCSP requests.
+type OCSPRequestOptions struct {
+	// Hash contains the hash function that should be used when constructing
+	// the OCSP request. If zero, SM3 is used for the issuers with SM2 keys,
+	// SHA-1 for the others.
+	Hash crypto.Hash
+}
+
+func (opts *OCSPRequestOptions) hash(issuer *Certificate) crypto.Hash {
+	if opts != nil && opts.Hash != 0 {
+		return opts.Hash
+	}
+	if issuer.PublicKey != nil {
+		if _, ok := issuer.PublicKey.ToStandardKey().(*sm2.PublicKey); ok {
+			return bccrypto.SM3
+		}
+	}
+	// SHA-1 is nearly universally used in OCSP.
+	return crypto.SHA1
+}
+
+// CreateOCSPRequest returns a DER-encoded, OCSP request for the status of
+// cert. If opts is nil then sensible defaults are used.
+func CreateOCSPRequest(cert, issuer *Certificate, opts *OCSPRequestOptions) ([]byte, error) {
+	hashFunc := opts.hash(issuer)
+	nameHash, keyHash, err := ocspIssuerHashes(issuer, hashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &OCSPRequest{
+		HashAlgorithm:  hashFunc,
+		IssuerNameHash: nameHash,
+		IssuerKeyHash:  keyHash,
+		SerialNumber:   cert.SerialNumber,
+	}
+	return req.Marshal()
+}
+
+// CreateOCSPResponse returns a DER-encoded OCSP response with the specified
+// contents, signed by priv, the key of responderCert.
+//
+// The responder cert is used to populate the responder's name field, and the
+// certificate itself is provided alongside the signature unless it is the issuer.
+//
+// The issuer cert is used to populate the IssuerNameHash and IssuerKeyHash fields.
+//
+// The template is used to populate the SerialNumber, Status, RevokedAt,
+// RevocationReason, ThisUpdate, NextUpdate and IssuerHash fields.
+//
+// The ProducedAt date is automatically set to the current date, to the nearest minute.
+func CreateOCSPResponse(issuer, responderCert *Certificate, template OCSPResponse,
+	priv crypto.Signer) ([]byte, error) {
+	if template.IssuerHash == 0 {
+		template.IssuerHash = (*OCSPRequestOptions)(nil).hash(issuer)
+	}
+	nameHash, keyHash, err := ocspIssuerHashes(issuer, template.IssuerHash)
+	if err != nil {
+		return nil, err
+	}
+
+	innerResponse := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  ocspHashOIDs[template.IssuerHash],
+				Parameters: asn1.NullRawValue,
+			},
+			NameHash:      nameHash,
+			IssuerKeyHash: keyHash,
+			SerialNumber:  template.SerialNumber,
+		},
+		ThisUpdate: template.ThisUpdate.UTC(),
+		NextUpdate: template.NextUpdate.UTC(),
+	}
+
+	switch template.Status {
+	case OCSPGood:
+		innerResponse.Good = true
+	case OCSPUnknown:
+		innerResponse.Unknown = true
+	case OCSPRevoked:
+		innerResponse.Revoked = ocspRevokedInfo{
+			RevocationTime: template.RevokedAt.UTC(),
+			Reason:         asn1.Enumerated(template.RevocationReason),
+		}
+	}
+
+	rawResponderID := asn1.RawValue{
+		Class:      2, // context-specific
+		Tag:        1, // Name (explicit tag)
+		IsCompound: true,
+		Bytes:      responderCert.RawSubject,
+	}
+	tbsResponseData := ocspResponseData{
+		Version:        0,
+		RawResponderID: rawResponderID,
+		ProducedAt:     time.Now().Truncate(time.Minute).UTC(),
+		Responses:      []ocspSingleResponse{innerResponse},
+	}
+
+	tbsResponseDataDER, err := asn1.Marshal(tbsResponseData)
+	if err != nil {
+		return nil, err
+	}
+
+	hashFunc, signatureAlgorithm, err := signingParamsForPublicKey(priv.Public(), template.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var digest []byte
+	if hashFunc == bccrypto.SM3 {
+		//当SM3时取ZA方式签名,所以不在这里做hash
+		digest = tbsResponseDataDER
+	} else {
+		if !hashFunc.Available() {
+			return nil, x509.ErrUnsupportedAlgorithm
+		}
+		h := hashFunc.New()
+		h.Write(tbsResponseDataDER)
+		digest = h.Sum(nil)
+	}
+	signature, err := priv.Sign(rand.Reader, digest, hashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	response := ocspBasicResponse{
+		TBSResponseData:    tbsResponseData,
+		SignatureAlgorithm: signatureAlgorithm,
+		Signature: asn1.BitString{
+			Bytes:     signature,
+			BitLength: 8 * len(signature),
+		},
+	}
+	if !responderCert.Equal(issuer) {
+		response.Certificates = []asn1.RawValue{
+			{FullBytes: responderCert.Raw},
+		}
+	}
+	responseDER, err := asn1.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ocspResponseASN1{
+		Status: asn1.Enumerated(OCSPSuccess),
+		Response: ocspResponseBytes{
+			ResponseType: idPKIXOCSPBasic,
+			Response:     responseDER,
+		},
+	})
+}
+
+// checkOCSPResponse returns the revocation status of a verified response at now
+func checkOCSPResponse(resp *OCSPResponse, now time.Time) error {
+	if now.Before(resp.ThisUpdate.Add(-ocspClockSkew)) {
+		return fmt.Errorf("%w: the OCSP response is not valid before %s", ErrRevocationUnknown,
+			resp.ThisUpdate.UTC().Format(time.RFC3339))
+	}
+	if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+		return fmt.Errorf("%w: the OCSP response expired at %s", ErrRevocationUnknown,
+			resp.NextUpdate.UTC().Format(time.RFC3339))
+	}
+	switch resp.Status {
+	case OCSPGood:
+		return nil
+	case OCSPRevoked:
+		return RevokedError{
+			SerialNumber:   resp.SerialNumber,
+			RevocationTime: resp.RevokedAt,
+			Reason:         resp.RevocationReason,
+		}
+	default:
+		return fmt.Errorf("%w: the OCSP responder does not know certificate %s",
+			ErrRevocationUnknown, resp.SerialNumber)
+	}
+}
+
+// ocspClockSkew the tolerance to the clocks of the responders, and of the CRL issuers
+const ocspClockSkew = 5 * time.Minute
+
+// ocspMaxResponseSize the largest OCSP response read from a responder
+const ocspMaxResponseSize = 1 << 20
+
+// OCSPChecker checks the certificates by OCSP, caching the responses until
+// their NextUpdate. The stale responses are evicted when a response is cached.
+type OCSPChecker struct {
+	// Fetch sends the DER request about cert to an OCSP responder and returns
+	// its DER response
+	Fetch func(cert *Certificate, request []byte) ([]byte, error)
+
+	mu    sync.Mutex
+	cache map[string]*OCSPResponse
+}
+
+// NewOCSPChecker returns an OCSPChecker fetching the responses with fetch, or
+// if it is nil by posting the requests to the first OCSP server of the certificates
+func NewOCSPChecker(fetch func(cert *Certificate, request []byte) ([]byte, error)) *OCSPChecker {
+	if fetch == nil {
+		fetch = postOCSPRequest
+	}
+	return &OCSPChecker{
+		Fetch: fetch,
+		cache: make(map[string]*OCSPResponse),
+	}
+}
+
+// CheckRevocation implements RevocationChecker
+func (c *OCSPChecker) CheckRevocation(cert, issuer *Certificate, now time.Time) error {
+	key := string(issuer.Raw) + cert.SerialNumber.String()
+	c.mu.Lock()
+	resp, ok := c.cache[key]
+	if ok && ocspResponseStale(resp, now) {
+		delete(c.cache, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		return checkOCSPResponse(resp, now)
+	}
+
+	req, err := CreateOCSPRequest(cert, issuer, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRevocationUnknown, err)
+	}
+	der, err := c.Fetch(cert, req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRevocationUnknown, err)
+	}
+	resp, err = parseOCSPResponse(der, cert, issuer, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRevocationUnknown, err)
+	}
+	if !resp.NextUpdate.IsZero() && !ocspResponseStale(resp, now) {
+		c.mu.Lock()
+		for k, cached := range c.cache {
+			if ocspResponseStale(cached, now) {
+				delete(c.cache, k)
+			}
+		}
+		c.cache[key] = resp
+		c.mu.Unlock()
+	}
+	return checkOCSPResponse(resp, now)
+}
+
+// ocspResponseStale whether a cached response must be fetched again at now,
+// once past its NextUpdate or the validity of its responder certificate
+func ocspResponseStale(resp *OCSPResponse, now time.Time) bool {
+	if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+		return true
+	}
+	return resp.Certificate != nil && now.After(resp.Certificate.NotAfter)
+}
+
+// postOCSPRequest posts the request to the first OCSP server of cert
+func postOCSPRequest(cert *Certificate, request []byte) ([]byte, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.New("x509: certificate has no OCSP server")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(cert.OCSPServer[0], "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("x509: OCSP server returned %s", resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, ocspMaxResponseSize))
+}
+
+// NewStapledOCSPChecker returns a checker of the certificate whose OCSP
+// response was stapled, e.g. by a TLS server. The status of the others is unknown.
+func NewStapledOCSPChecker(response []byte) RevocationChecker {
+	return stapledOCSPChecker(response)
+}
+
+type stapledOCSPChecker []byte
+
+func (s stapledOCSPChecker) CheckRevocation(cert, issuer *Certificate, now time.Time) error {
+	resp, err := parseOCSPResponse(s, cert, issuer, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRevocationUnknown, err)
+	}
+	return checkOCSPResponse(resp, now)
+}
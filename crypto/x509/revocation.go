@@ -0,0 +1,288 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package x509
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrRevocationUnknown results when the revocation status of a certificate
+// cannot be established, e.g. without a fresh CRL or OCSP response of its issuer
+var ErrRevocationUnknown = errors.New("x509: revocation status unknown")
+
+// RevocationChecker checks the revocation status of the certificates of a chain
+type RevocationChecker interface {
+	// CheckRevocation returns nil if cert, issued by issuer, is not revoked at
+	// now, a RevokedError if it is, or an error wrapping ErrRevocationUnknown
+	// if its status cannot be established.
+	CheckRevocation(cert, issuer *Certificate, now time.Time) error
+}
+
+// RevokedError results when a certificate is revoked by its issuer
+type RevokedError struct {
+	SerialNumber   *big.Int
+	RevocationTime time.Time
+	// Reason the CRLReason of RFC 5280, Section 5.3.1
+	Reason int
+}
+
+func (e RevokedError) Error() string {
+	return fmt.Sprintf("x509: certificate %s was revoked at %s, reason %d",
+		e.SerialNumber, e.RevocationTime.UTC().Format(time.RFC3339), e.Reason)
+}
+
+// RevocationCheckers checks the certificates with each checker in turn until
+// one establishes their status
+type RevocationCheckers []RevocationChecker
+
+// CheckRevocation implements RevocationChecker
+func (checkers RevocationCheckers) CheckRevocation(cert, issuer *Certificate, now time.Time) error {
+	err := ErrRevocationUnknown
+	for _, checker := range checkers {
+		if err = checker.CheckRevocation(cert, issuer, now); !errors.Is(err, ErrRevocationUnknown) {
+			return err
+		}
+	}
+	return err
+}
+
+// RequireRevocationStatus returns a checker rejecting the certificates whose
+// status the checker cannot establish, which Verify accepts otherwise
+func RequireRevocationStatus(checker RevocationChecker) RevocationChecker {
+	return requiredRevocationStatus{checker}
+}
+
+type requiredRevocationStatus struct {
+	checker RevocationChecker
+}
+
+func (r requiredRevocationStatus) CheckRevocation(cert, issuer *Certificate, now time.Time) error {
+	err := r.checker.CheckRevocation(cert, issuer, now)
+	if errors.Is(err, ErrRevocationUnknown) {
+		return fmt.Errorf("x509: revocation status of certificate %s required, %v", cert.SerialNumber, err)
+	}
+	return err
+}
+
+// CheckChainRevocation checks that no certificate of the chain, which ends
+// with its root, is revoked by the next one. The certificates whose status is
+// unknown are accepted, see RequireRevocationStatus.
+func CheckChainRevocation(checker RevocationChecker, chain []*Certificate, now time.Time) error {
+	for i := 0; i+1 < len(chain); i++ {
+		err := checker.CheckRevocation(chain[i], chain[i+1], now)
+		if err != nil && !errors.Is(err, ErrRevocationUnknown) {
+			return CertificateInvalidError{chain[i], Revoked, err.Error()}
+		}
+	}
+	return nil
+}
+
+// CRLCache holds the CRLs of the issuers, each certificate being checked
+// against the latest fresh CRL of its issuer whose signature is valid. The
+// CRLs older than the one used are dropped.
+type CRLCache struct {
+	mu sync.RWMutex
+	// crls the CRLs by issuer, the latest first
+	crls map[string][]*crlEntry
+}
+
+type crlEntry struct {
+	list    *pkix.CertificateList
+	revoked map[string]pkix.RevokedCertificate
+	// verifiedBy the issuer certificate which signed the CRL, once checked
+	verifiedBy []byte
+}
+
+// NewCRLCache returns an empty CRLCache
+func NewCRLCache() *CRLCache {
+	return &CRLCache{crls: make(map[string][]*crlEntry)}
+}
+
+// AddCRLFile adds the CRLs of a PEM or DER file
+func (c *CRLCache) AddCRLFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return c.AddCRL(data)
+}
+
+// AddCRL adds the CRLs of PEM blocks, or a DER CRL. Their signatures are
+// checked against the issuers of the certificates being verified.
+func (c *CRLCache) AddCRL(data []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		return c.addCRL(data)
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		if err := c.addCRL(block.Bytes); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *CRLCache) addCRL(der []byte) error {
+	list := new(pkix.CertificateList)
+	rest, err := asn1.Unmarshal(der, list)
+	if err != nil {
+		return fmt.Errorf("x509: failed to parse CRL, %s", err.Error())
+	}
+	if len(rest) > 0 {
+		return errors.New("x509: trailing data after CRL")
+	}
+	key, err := issuerKey(list.TBSCertList.Issuer)
+	if err != nil {
+		return err
+	}
+
+	entry := &crlEntry{
+		list:    list,
+		revoked: make(map[string]pkix.RevokedCertificate, len(list.TBSCertList.RevokedCertificates)),
+	}
+	for _, rc := range list.TBSCertList.RevokedCertificates {
+		entry.revoked[rc.SerialNumber.String()] = rc
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.crls[key] {
+		if bytes.Equal(e.list.TBSCertList.Raw, list.TBSCertList.Raw) &&
+			bytes.Equal(e.list.SignatureValue.Bytes, list.SignatureValue.Bytes) {
+			return nil
+		}
+	}
+	entries := append(c.crls[key], entry)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].list.TBSCertList.ThisUpdate.After(entries[j].list.TBSCertList.ThisUpdate)
+	})
+	c.crls[key] = entries
+	return nil
+}
+
+// CheckRevocation implements RevocationChecker
+func (c *CRLCache) CheckRevocation(cert, issuer *Certificate, now time.Time) error {
+	var rdn pkix.RDNSequence
+	if _, err := asn1.Unmarshal(cert.RawIssuer, &rdn); err != nil {
+		return err
+	}
+	key, err := issuerKey(rdn)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	entries := c.crls[key]
+	c.mu.RUnlock()
+
+	for i, entry := range entries {
+		if !c.verify(entry, issuer) {
+			continue
+		}
+		tbs := entry.list.TBSCertList
+		if now.Before(tbs.ThisUpdate.Add(-ocspClockSkew)) {
+			continue
+		}
+		c.prune(key, issuer, entries[i+1:])
+		if !tbs.NextUpdate.IsZero() && now.After(tbs.NextUpdate) {
+			return fmt.Errorf("%w: the CRL of %s expired at %s", ErrRevocationUnknown,
+				issuer.Subject, tbs.NextUpdate.UTC().Format(time.RFC3339))
+		}
+		if rc, ok := entry.revoked[cert.SerialNumber.String()]; ok && !now.Before(rc.RevocationTime) {
+			return RevokedError{
+				SerialNumber:   rc.SerialNumber,
+				RevocationTime: rc.RevocationTime,
+				Reason:         crlReason(rc.Extensions),
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: no valid CRL of %s", ErrRevocationUnknown, issuer.Subject)
+}
+
+// prune drops the older CRLs signed by issuer, the CRLs of the other issuers
+// with the same name are kept
+func (c *CRLCache) prune(key string, issuer *Certificate, older []*crlEntry) {
+	dropped := make(map[*crlEntry]bool)
+	for _, entry := range older {
+		if c.verify(entry, issuer) {
+			dropped[entry] = true
+		}
+	}
+	if len(dropped) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entries []*crlEntry
+	for _, entry := range c.crls[key] {
+		if !dropped[entry] {
+			entries = append(entries, entry)
+		}
+	}
+	c.crls[key] = entries
+}
+
+// verify whether the CRL is signed by issuer
+func (c *CRLCache) verify(entry *crlEntry, issuer *Certificate) bool {
+	c.mu.RLock()
+	verifiedBy := entry.verifiedBy
+	c.mu.RUnlock()
+	if bytes.Equal(verifiedBy, issuer.Raw) {
+		return true
+	}
+	if issuer.CheckCRLSignature(entry.list) != nil {
+		return false
+	}
+	c.mu.Lock()
+	entry.verifiedBy = issuer.Raw
+	c.mu.Unlock()
+	return true
+}
+
+// issuerKey the key of the CRLs of an issuer, its name being re-encoded so
+// that the names of the certificates and of the CRLs compare equal
+func issuerKey(rdn pkix.RDNSequence) (string, error) {
+	der, err := asn1.Marshal(rdn)
+	if err != nil {
+		return "", err
+	}
+	return string(der), nil
+}
+
+var oidExtensionCRLReasons = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// crlReason returns the reason code of a revoked certificate, unspecified by default
+func crlReason(extensions []pkix.Extension) int {
+	for _, ext := range extensions {
+		if ext.Id.Equal(oidExtensionCRLReasons) {
+			var reason asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil {
+				return int(reason)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,273 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package x509
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	bccrypto "chainmaker.org/chainmaker/common/v2/crypto"
+	"github.com/stretchr/testify/require"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// testPKI a CA, with its template and key, which issues the test certificates
+type testPKI struct {
+	template *x509.Certificate
+	key      crypto.Signer
+	cert     *Certificate
+	serial   int64
+}
+
+func newTestPKI(t *testing.T, gm bool) *testPKI {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.chainmaker.org", Organization: []string{"chainmaker.org"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+	pki := &testPKI{template: template, key: newTestKey(t, gm), serial: 1}
+	der, err := CreateCertificate(rand.Reader, template, template, pki.key.Public(), pki.key)
+	require.Nil(t, err)
+	pki.cert, err = ParseCertificate(der)
+	require.Nil(t, err)
+	return pki
+}
+
+func newTestKey(t *testing.T, gm bool) crypto.Signer {
+	if gm {
+		key, err := sm2.GenerateKey(rand.Reader)
+		require.Nil(t, err)
+		return key
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	return key
+}
+
+// issue returns a new certificate, with the given extended key usage
+func (pki *testPKI) issue(t *testing.T, extKeyUsage x509.ExtKeyUsage) (*Certificate, crypto.Signer) {
+	pki.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(pki.serial),
+		Subject:      pkix.Name{CommonName: "node.chainmaker.org", Organization: []string{"chainmaker.org"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+	}
+	key := newTestKey(t, isSM2(pki.key))
+	return pki.sign(t, template, key), key
+}
+
+// sign returns the certificate of the template for the key
+func (pki *testPKI) sign(t *testing.T, template *x509.Certificate, key crypto.Signer) *Certificate {
+	der, err := CreateCertificate(rand.Reader, template, pki.template, key.Public(), pki.key)
+	require.Nil(t, err)
+	cert, err := ParseCertificate(der)
+	require.Nil(t, err)
+	return cert
+}
+
+func isSM2(key crypto.Signer) bool {
+	_, ok := key.(*sm2.PrivateKey)
+	return ok
+}
+
+func (pki *testPKI) crl(t *testing.T, thisUpdate, nextUpdate time.Time, revoked ...*Certificate) []byte {
+	var revokedCerts []pkix.RevokedCertificate
+	for _, cert := range revoked {
+		revokedCerts = append(revokedCerts, pkix.RevokedCertificate{
+			SerialNumber:   cert.SerialNumber,
+			RevocationTime: thisUpdate,
+		})
+	}
+	der, err := CreateCRL(rand.Reader, pki.template, pki.key, revokedCerts, thisUpdate, nextUpdate)
+	require.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func (pki *testPKI) verify(cert *Certificate, checker RevocationChecker, now time.Time) error {
+	roots := NewCertPool()
+	roots.AddCert(pki.cert)
+	_, err := cert.Verify(VerifyOptions{
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		Revocation:  checker,
+	})
+	return err
+}
+
+func requireRevoked(t *testing.T, err error) {
+	var invalid CertificateInvalidError
+	require.True(t, errors.As(err, &invalid), "%v", err)
+	require.Equal(t, Revoked, invalid.Reason)
+}
+
+func TestCRLCache(t *testing.T) {
+	for _, gm := range []bool{true, false} {
+		pki := newTestPKI(t, gm)
+		good, _ := pki.issue(t, x509.ExtKeyUsageClientAuth)
+		revoked, _ := pki.issue(t, x509.ExtKeyUsageClientAuth)
+		now := time.Now()
+
+		cache := NewCRLCache()
+		require.Nil(t, cache.AddCRL(pki.crl(t, now.Add(-time.Minute), now.Add(time.Hour), revoked)))
+		require.Nil(t, pki.verify(good, cache, now))
+		requireRevoked(t, pki.verify(revoked, cache, now))
+
+		// the status is unknown once the CRL expired
+		later := now.Add(2 * time.Hour)
+		require.Nil(t, pki.verify(revoked, cache, later))
+		require.NotNil(t, pki.verify(good, RequireRevocationStatus(cache), later))
+
+		// the latest CRL is used, a CRL of another CA is ignored
+		other := newTestPKI(t, gm)
+		require.Nil(t, cache.AddCRL(other.crl(t, now, now.Add(time.Hour), good)))
+		require.Nil(t, pki.verify(good, RequireRevocationStatus(cache), now))
+		crl := pki.crl(t, now, now.Add(time.Hour), good)
+		require.Nil(t, cache.AddCRL(crl))
+		requireRevoked(t, pki.verify(good, cache, now))
+		// the older CRLs of the CA are dropped, a CRL is added once
+		require.Nil(t, cache.AddCRL(crl))
+		for _, entries := range cache.crls {
+			require.Len(t, entries, 2)
+		}
+
+		// a CRL which is not valid yet is ignored
+		require.Nil(t, cache.AddCRL(pki.crl(t, now.Add(time.Hour), now.Add(2*time.Hour))))
+		requireRevoked(t, pki.verify(good, cache, now))
+		require.Nil(t, pki.verify(good, cache, now.Add(time.Hour)))
+
+		require.NotNil(t, cache.AddCRL([]byte("not a CRL")))
+	}
+}
+
+func TestOCSP(t *testing.T) {
+	for _, gm := range []bool{true, false} {
+		pki := newTestPKI(t, gm)
+		good, _ := pki.issue(t, x509.ExtKeyUsageServerAuth)
+		revoked, _ := pki.issue(t, x509.ExtKeyUsageServerAuth)
+		responder, responderKey := pki.issue(t, x509.ExtKeyUsageOCSPSigning)
+		unauthorized, unauthorizedKey := pki.issue(t, x509.ExtKeyUsageServerAuth)
+		now := time.Now()
+
+		// the responder answers with its delegated certificate
+		var requests int
+		offline := false
+		checker := NewOCSPChecker(func(cert *Certificate, request []byte) ([]byte, error) {
+			if offline {
+				return nil, errors.New("offline")
+			}
+			requests++
+			req, err := ParseOCSPRequest(request)
+			require.Nil(t, err)
+			require.Equal(t, cert.SerialNumber, req.SerialNumber)
+			if gm {
+				require.Equal(t, bccrypto.SM3, req.HashAlgorithm)
+			}
+			template := OCSPResponse{
+				Status:       OCSPGood,
+				SerialNumber: req.SerialNumber,
+				ThisUpdate:   now.Add(-time.Minute),
+				NextUpdate:   now.Add(time.Hour),
+			}
+			if req.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
+				template.Status = OCSPRevoked
+				template.RevokedAt = now.Add(-time.Minute)
+				template.RevocationReason = 1
+			}
+			return CreateOCSPResponse(pki.cert, responder, template, responderKey)
+		})
+		require.Nil(t, pki.verify(good, checker, now))
+		err := pki.verify(revoked, checker, now)
+		requireRevoked(t, err)
+		require.Contains(t, err.Error(), "reason 1")
+		// the responses are cached until their next update
+		require.Nil(t, pki.verify(good, checker, now))
+		require.Equal(t, 2, requests)
+
+		// a response signed by the issuer itself
+		der, err := CreateOCSPResponse(pki.cert, pki.cert, OCSPResponse{
+			Status:       OCSPRevoked,
+			SerialNumber: revoked.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(time.Hour),
+			RevokedAt:    now,
+		}, pki.key)
+		require.Nil(t, err)
+		resp, err := ParseOCSPResponse(der, revoked, pki.cert)
+		require.Nil(t, err)
+		require.Equal(t, OCSPRevoked, resp.Status)
+		require.Nil(t, resp.Certificate)
+		requireRevoked(t, pki.verify(revoked, NewStapledOCSPChecker(der), now))
+		// the staple says nothing about the other certificates
+		require.Nil(t, pki.verify(good, NewStapledOCSPChecker(der), now))
+
+		// a responder without the OCSP signing usage, or of another issuer, is rejected
+		der, err = CreateOCSPResponse(pki.cert, unauthorized, OCSPResponse{
+			Status:       OCSPGood,
+			SerialNumber: revoked.SerialNumber,
+			ThisUpdate:   now,
+		}, unauthorizedKey)
+		require.Nil(t, err)
+		_, err = ParseOCSPResponse(der, revoked, pki.cert)
+		require.NotNil(t, err)
+		_, err = ParseOCSPResponse(der, revoked, newTestPKI(t, gm).cert)
+		require.NotNil(t, err)
+		requireRevoked(t, pki.verify(revoked, RevocationCheckers{NewStapledOCSPChecker(der), checker}, now))
+
+		// the delegated responder certificate must be valid
+		der, err = CreateOCSPResponse(pki.cert, responder, OCSPResponse{
+			Status:       OCSPGood,
+			SerialNumber: good.SerialNumber,
+			ThisUpdate:   now,
+		}, responderKey)
+		require.Nil(t, err)
+		_, err = ParseOCSPResponse(der, good, pki.cert)
+		require.Nil(t, err)
+		_, err = parseOCSPResponse(der, good, pki.cert, responder.NotAfter.Add(time.Second))
+		require.Contains(t, err.Error(), "not valid")
+		_, err = parseOCSPResponse(der, good, pki.cert, responder.NotBefore.Add(-time.Second))
+		require.Contains(t, err.Error(), "not valid")
+
+		// the stale responses are removed from the cache
+		offline = true
+		require.Len(t, checker.cache, 2)
+		require.NotNil(t, checker.CheckRevocation(good, pki.cert, now.Add(2*time.Hour)))
+		require.Len(t, checker.cache, 1)
+		require.NotNil(t, checker.CheckRevocation(revoked, pki.cert, now.Add(2*time.Hour)))
+		require.Len(t, checker.cache, 0)
+		// or evicted when a response is cached
+		offline = false
+		require.Nil(t, checker.CheckRevocation(good, pki.cert, now))
+		now = now.Add(2 * time.Hour)
+		requireRevoked(t, pki.verify(revoked, checker, now))
+		require.Len(t, checker.cache, 1)
+		_, ok := checker.cache[string(pki.cert.Raw)+revoked.SerialNumber.String()]
+		require.True(t, ok)
+		// as those of an expired responder
+		resp = &OCSPResponse{NextUpdate: now.Add(48 * time.Hour), Certificate: responder}
+		require.False(t, ocspResponseStale(resp, now))
+		require.True(t, ocspResponseStale(resp, responder.NotAfter.Add(time.Second)))
+	}
+}
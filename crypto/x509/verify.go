@@ -65,6 +65,9 @@ const (
 	// CANotAuthorizedForExtKeyUsage results when an intermediate or root
 	// certificate does not permit a requested extended key usage.
 	CANotAuthorizedForExtKeyUsage
+	// Revoked results when a certificate of the chain is revoked, according to
+	// the RevocationChecker given in the VerifyOptions.
+	Revoked
 )
 
 // CertificateInvalidError results when an odd error occurs. Users of this
@@ -95,6 +98,8 @@ func (e CertificateInvalidError) Error() string {
 		return "x509: issuer has name constraints but leaf doesn't have a SAN extension"
 	case UnconstrainedName:
 		return "x509: issuer has name constraints but leaf contains unknown or unconstrained name: " + e.Detail
+	case Revoked:
+		return "x509: certificate is revoked: " + e.Detail
 	}
 	return "x509: unknown error"
 }
@@ -210,6 +215,9 @@ type VerifyOptions struct {
 	// certificates from consuming excessive amounts of CPU time when
 	// validating.
 	MaxConstraintComparisions int
+	// Revocation, if not nil, checks that no certificate of the chains is
+	// revoked, the chains with a revoked certificate being rejected.
+	Revocation RevocationChecker
 }
 
 const (
@@ -734,7 +742,7 @@ func (c *Certificate) isValid(certType int, currentChain []*Certificate, opts *V
 // root that enumerates EKUs prevents a leaf from asserting an EKU not in that
 // list.
 //
-// WARNING: this function doesn't do any revocation checking.
+// The revocation status is checked only with a RevocationChecker in opts.
 func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err error) {
 	// Platform-specific verification needs the ASN.1 contents so
 	// this makes the behavior consistent across platforms.
@@ -783,7 +791,7 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 	// If any key usage is acceptable then we're done.
 	for _, usage := range keyUsages {
 		if usage == x509.ExtKeyUsageAny {
-			return candidateChains, nil
+			return c.checkRevocation(candidateChains, &opts)
 		}
 	}
 
@@ -797,7 +805,36 @@ func (c *Certificate) Verify(opts VerifyOptions) (chains [][]*Certificate, err e
 		return nil, CertificateInvalidError{c, IncompatibleUsage, ""}
 	}
 
-	return chains, nil
+	return c.checkRevocation(chains, &opts)
+}
+
+// checkRevocation returns the chains without revoked certificate
+func (c *Certificate) checkRevocation(chains [][]*Certificate, opts *VerifyOptions) ([][]*Certificate, error) {
+	if opts.Revocation == nil {
+		return chains, nil
+	}
+	now := opts.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var (
+		valid [][]*Certificate
+		err   error
+	)
+	for _, chain := range chains {
+		if chainErr := CheckChainRevocation(opts.Revocation, chain, now); chainErr != nil {
+			if err == nil {
+				err = chainErr
+			}
+			continue
+		}
+		valid = append(valid, chain)
+	}
+	if len(valid) == 0 {
+		return nil, err
+	}
+	return valid, nil
 }
 
 func appendToFreshChain(chain []*Certificate, cert *Certificate) []*Certificate {
@@ -28,6 +28,8 @@ const (
 	SUBSYSTEM_WASM_WASMER             = "wasmer"
 	SUBSYSTEM_TXPOOL                  = "txpool"
 	SUBSYSTEM_VM                      = "vm"
+	SUBSYSTEM_MSGBUS                  = "msgbus"
+	SUBSYSTEM_BIRDSNEST               = "birdsnest"
 
 	ChainId                           = "chainId"
 	PoolType                          = "poolType"
@@ -0,0 +1,591 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReplayBufferSize  = 1024
+	defaultReconnectInterval = time.Second
+	// maxBridgeFrameSize bounds the payload of a frame read from a connection
+	maxBridgeFrameSize = 64 << 20
+	// frame header: seq(8) | topic(4) | length(4)
+	bridgeFrameHeaderSize = 16
+)
+
+var (
+	// ErrBridgeFrameTooLarge is reported when a received frame exceeds the size limit.
+	ErrBridgeFrameTooLarge = errors.New("bridge frame too large")
+	// ErrBridgeClosed is returned when starting a stopped bridge.
+	ErrBridgeClosed = errors.New("bridge is closed")
+)
+
+// Serializer converts the payloads of a topic forwarded by a bridge.
+type Serializer interface {
+	Marshal(payload interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// BytesSerializer forwards []byte payloads as they are.
+type BytesSerializer struct{}
+
+func (BytesSerializer) Marshal(payload interface{}) ([]byte, error) {
+	data, ok := payload.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("payload type %T is not []byte", payload)
+	}
+	return data, nil
+}
+
+func (BytesSerializer) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+// JSONSerializer forwards payloads encoded as JSON. New returns the pointer
+// the received data is decoded into, a generic value is decoded if New is nil.
+type JSONSerializer struct {
+	New func() interface{}
+}
+
+func (s JSONSerializer) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (s JSONSerializer) Unmarshal(data []byte) (interface{}, error) {
+	if s.New == nil {
+		var v interface{}
+		err := json.Unmarshal(data, &v)
+		return v, err
+	}
+	v := s.New()
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Transport is the local stream transport used by a bridge. Any stream that
+// can be exposed as a net.Conn, such as a loopback gRPC stream, can be plugged in.
+type Transport interface {
+	Listen() (net.Listener, error)
+	Dial(ctx context.Context) (net.Conn, error)
+}
+
+type netTransport struct {
+	network string
+	address string
+}
+
+// NewUnixTransport returns a Transport on the Unix socket at path. A stale
+// socket file is removed by Listen().
+func NewUnixTransport(path string) Transport {
+	return &netTransport{network: "unix", address: path}
+}
+
+// NewTCPTransport returns a Transport on a TCP address, meant to be a loopback one.
+func NewTCPTransport(address string) Transport {
+	return &netTransport{network: "tcp", address: address}
+}
+
+func (t *netTransport) Listen() (net.Listener, error) {
+	if t.network == "unix" {
+		if err := os.Remove(t.address); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return net.Listen(t.network, t.address)
+}
+
+func (t *netTransport) Dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, t.network, t.address)
+}
+
+// BridgeOption configures a BridgeServer or a BridgeClient.
+type BridgeOption func(*bridgeOptions)
+
+type bridgeOptions struct {
+	replaySize        int
+	reconnectInterval time.Duration
+	onError           func(error)
+}
+
+// WithReplayBuffer sets how many forwarded messages the server keeps to replay
+// to reconnecting clients.
+func WithReplayBuffer(size int) BridgeOption {
+	return func(o *bridgeOptions) {
+		o.replaySize = size
+	}
+}
+
+// WithReconnectInterval sets how long the client waits before dialing again
+// after the connection is lost.
+func WithReconnectInterval(d time.Duration) BridgeOption {
+	return func(o *bridgeOptions) {
+		o.reconnectInterval = d
+	}
+}
+
+// WithBridgeErrorHandler sets the handler of the connection and serializer errors.
+func WithBridgeErrorHandler(fn func(error)) BridgeOption {
+	return func(o *bridgeOptions) {
+		o.onError = fn
+	}
+}
+
+func newBridgeOptions(opts []BridgeOption) bridgeOptions {
+	o := bridgeOptions{
+		replaySize:        defaultReplayBufferSize,
+		reconnectInterval: defaultReconnectInterval,
+		onError:           func(error) {},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.replaySize <= 0 {
+		o.replaySize = defaultReplayBufferSize
+	}
+	return o
+}
+
+type bridgeFrame struct {
+	seq   uint64
+	topic Topic
+	data  []byte
+}
+
+func writeBridgeFrame(w io.Writer, f *bridgeFrame) error {
+	var hdr [bridgeFrameHeaderSize]byte
+	binary.BigEndian.PutUint64(hdr[0:8], f.seq)
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(f.topic))
+	binary.BigEndian.PutUint32(hdr[12:16], uint32(len(f.data)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(f.data)
+	return err
+}
+
+func readBridgeFrame(r io.Reader) (*bridgeFrame, error) {
+	var hdr [bridgeFrameHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[12:16])
+	if size > maxBridgeFrameSize {
+		return nil, ErrBridgeFrameTooLarge
+	}
+	f := &bridgeFrame{
+		seq:   binary.BigEndian.Uint64(hdr[0:8]),
+		topic: Topic(int32(binary.BigEndian.Uint32(hdr[8:12]))),
+		data:  make([]byte, size),
+	}
+	if _, err := io.ReadFull(r, f.data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func writeUint64(w io.Writer, v uint64) error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	_, err := w.Write(b[:])
+	return err
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// BridgeServer forwards the messages of selected topics of a local message bus
+// to the BridgeClients connected over a Transport.
+//
+// Every forwarded message gets a sequence number and is kept in a bounded
+// replay buffer. A connecting client sends the last sequence number it has
+// received, the server replays the newer messages still in the buffer, then
+// streams the new ones. The server sends its start time as epoch first, a client that
+// sees a new epoch (the server restarted) asks for the whole buffer.
+type BridgeServer struct {
+	bus       MessageBus
+	transport Transport
+	opts      bridgeOptions
+	epoch     uint64
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	ring       []*bridgeFrame
+	seq        uint64 // sequence number of the last forwarded message
+	closed     bool
+	listener   net.Listener
+	conns      map[net.Conn]*bool // conn -> whether the peer hung up
+	forwarders []*bridgeForwarder
+	wg         sync.WaitGroup
+}
+
+// NewBridgeServer creates a bridge server forwarding from the bus.
+func NewBridgeServer(bus MessageBus, transport Transport, opts ...BridgeOption) *BridgeServer {
+	s := &BridgeServer{
+		bus:       bus,
+		transport: transport,
+		opts:      newBridgeOptions(opts),
+		epoch:     uint64(time.Now().UnixNano()),
+		conns:     make(map[net.Conn]*bool),
+	}
+	s.ring = make([]*bridgeFrame, s.opts.replaySize)
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Forward forwards the messages published on the topic, encoded by the serializer.
+func (s *BridgeServer) Forward(topic Topic, serializer Serializer) {
+	f := &bridgeForwarder{server: s, topic: topic, serializer: serializer}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.forwarders = append(s.forwarders, f)
+	s.mu.Unlock()
+	// keep the order of the topic without blocking the bus for a slow bridge
+	s.bus.Register(topic, f, WithQueue(defaultMessageBufferSize, PolicyDropOldest))
+}
+
+// Start listens on the transport and serves the clients in the background.
+func (s *BridgeServer) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrBridgeClosed
+	}
+	l, err := s.transport.Listen()
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	s.wg.Add(1)
+	go s.acceptLoop(l)
+	return nil
+}
+
+// Stop closes the listener and the client connections and unregisters the
+// forwarded topics from the bus.
+func (s *BridgeServer) Stop() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	forwarders := s.forwarders
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	for _, f := range forwarders {
+		s.bus.UnRegister(f.topic, f)
+	}
+	s.wg.Wait()
+}
+
+// append adds a message to the replay buffer and wakes up the connections.
+func (s *BridgeServer) append(topic Topic, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.seq++
+	s.ring[s.seq%uint64(len(s.ring))] = &bridgeFrame{seq: s.seq, topic: topic, data: data}
+	s.cond.Broadcast()
+}
+
+// oldest returns the sequence number of the oldest message in the replay buffer.
+func (s *BridgeServer) oldest() uint64 {
+	size := uint64(len(s.ring))
+	if s.seq < size {
+		return 1
+	}
+	return s.seq - size + 1
+}
+
+func (s *BridgeServer) acceptLoop(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if !closed {
+				s.opts.onError(err)
+			}
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		hungUp := false
+		s.conns[conn] = &hungUp
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(conn, &hungUp)
+	}
+}
+
+func (s *BridgeServer) serve(conn net.Conn, hungUp *bool) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	if err := writeUint64(conn, s.epoch); err != nil {
+		s.opts.onError(err)
+		return
+	}
+	lastSeq, err := readUint64(conn)
+	if err != nil {
+		s.opts.onError(err)
+		return
+	}
+	// the client sends nothing more, a read returns when it hangs up
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, conn)
+		s.mu.Lock()
+		*hungUp = true
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}()
+
+	w := bufio.NewWriter(conn)
+	next := lastSeq + 1
+	var frames []*bridgeFrame
+	for {
+		s.mu.Lock()
+		for next > s.seq && !s.closed && !*hungUp {
+			s.cond.Wait()
+		}
+		if s.closed || *hungUp {
+			s.mu.Unlock()
+			return
+		}
+		if oldest := s.oldest(); next < oldest {
+			next = oldest
+		}
+		frames = frames[:0]
+		for seq := next; seq <= s.seq; seq++ {
+			frames = append(frames, s.ring[seq%uint64(len(s.ring))])
+		}
+		s.mu.Unlock()
+
+		for _, f := range frames {
+			if err = writeBridgeFrame(w, f); err != nil {
+				break
+			}
+			next = f.seq + 1
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			s.opts.onError(err)
+			return
+		}
+	}
+}
+
+// bridgeForwarder is the subscriber of a forwarded topic.
+type bridgeForwarder struct {
+	server     *BridgeServer
+	topic      Topic
+	serializer Serializer
+}
+
+func (f *bridgeForwarder) OnMessage(m *Message) {
+	data, err := f.serializer.Marshal(m.Payload)
+	if err != nil {
+		f.server.opts.onError(fmt.Errorf("marshal message of topic %s: %w", f.topic, err))
+		return
+	}
+	f.server.append(f.topic, data)
+}
+
+func (f *bridgeForwarder) OnQuit() {
+	// the server is stopped by Stop()
+}
+
+// BridgeClient receives the messages forwarded by a BridgeServer and
+// republishes them on a local message bus with PublishSafe(), keeping their
+// order. It reconnects after the connection is lost and resumes after the
+// last received message, messages that left the replay buffer of the server
+// in the meantime are lost.
+type BridgeClient struct {
+	bus       MessageBus
+	transport Transport
+	opts      bridgeOptions
+
+	mu          sync.Mutex
+	serializers map[Topic]Serializer
+	conn        net.Conn
+	started     bool
+
+	// only used by the receiving goroutine
+	epoch   uint64
+	lastSeq uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBridgeClient creates a bridge client republishing on the bus.
+func NewBridgeClient(bus MessageBus, transport Transport, opts ...BridgeOption) *BridgeClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BridgeClient{
+		bus:         bus,
+		transport:   transport,
+		opts:        newBridgeOptions(opts),
+		serializers: make(map[Topic]Serializer),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Subscribe republishes the messages of the topic decoded by the serializer,
+// the messages of other topics are ignored.
+func (c *BridgeClient) Subscribe(topic Topic, serializer Serializer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serializers[topic] = serializer
+}
+
+// Start connects to the server in the background.
+func (c *BridgeClient) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return ErrBridgeClosed
+	}
+	if c.started {
+		return nil
+	}
+	c.started = true
+	c.wg.Add(1)
+	go c.loop()
+	return nil
+}
+
+// Stop closes the connection and stops reconnecting.
+func (c *BridgeClient) Stop() {
+	c.mu.Lock()
+	c.cancel()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+func (c *BridgeClient) loop() {
+	defer c.wg.Done()
+	for {
+		err := c.run()
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.opts.onError(err)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.opts.reconnectInterval):
+		}
+	}
+}
+
+// run connects to the server and receives until the connection fails.
+func (c *BridgeClient) run() error {
+	conn, err := c.transport.Dial(c.ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.ctx.Err() != nil {
+		c.mu.Unlock()
+		_ = conn.Close()
+		return c.ctx.Err()
+	}
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	epoch, err := readUint64(r)
+	if err != nil {
+		return err
+	}
+	if epoch != c.epoch {
+		c.epoch, c.lastSeq = epoch, 0
+	}
+	if err = writeUint64(conn, c.lastSeq); err != nil {
+		return err
+	}
+	for {
+		f, err := readBridgeFrame(r)
+		if err != nil {
+			return err
+		}
+		if f.seq <= c.lastSeq {
+			continue
+		}
+		c.lastSeq = f.seq
+		c.mu.Lock()
+		serializer := c.serializers[f.topic]
+		c.mu.Unlock()
+		if serializer == nil {
+			continue
+		}
+		payload, err := serializer.Unmarshal(f.data)
+		if err != nil {
+			c.opts.onError(fmt.Errorf("unmarshal message of topic %s: %w", f.topic, err))
+			continue
+		}
+		c.bus.PublishSafe(f.topic, payload)
+	}
+}
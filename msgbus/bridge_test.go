@@ -0,0 +1,121 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type chanSub struct {
+	DefaultSubscriber
+	c chan *Message
+}
+
+func (s *chanSub) OnMessage(m *Message) {
+	s.c <- m
+}
+
+type blockEvent struct {
+	Height uint64 `json:"height"`
+}
+
+func testBridgeTransport(t *testing.T) Transport {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("msgbus-bridge-%d.sock", time.Now().UnixNano()))
+	t.Cleanup(func() { _ = os.Remove(path) })
+	return NewUnixTransport(path)
+}
+
+func receive(t *testing.T, c chan *Message) *Message {
+	select {
+	case m := <-c:
+		return m
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for a bridged message")
+		return nil
+	}
+}
+
+func TestBridge(t *testing.T) {
+	transport := testBridgeTransport(t)
+	local, remote := NewMessageBus(), NewMessageBus()
+	defer local.Close()
+	defer remote.Close()
+
+	server := NewBridgeServer(local, transport)
+	server.Forward(BlockInfo, JSONSerializer{New: func() interface{} { return &blockEvent{} }})
+	server.Forward(TxPoolSignal, BytesSerializer{})
+	require.Nil(t, server.Start())
+	defer server.Stop()
+
+	received := &chanSub{c: make(chan *Message, 16)}
+	remote.Register(BlockInfo, received)
+	remote.Register(TxPoolSignal, received)
+	client := NewBridgeClient(remote, transport, WithReconnectInterval(10*time.Millisecond))
+	client.Subscribe(BlockInfo, JSONSerializer{New: func() interface{} { return &blockEvent{} }})
+	require.Nil(t, client.Start())
+	defer client.Stop()
+
+	local.Publish(BlockInfo, &blockEvent{Height: 1})
+	m := receive(t, received.c)
+	require.Equal(t, BlockInfo, m.Topic)
+	require.Equal(t, &blockEvent{Height: 1}, m.Payload)
+
+	// forwarded but not subscribed by the client
+	local.Publish(TxPoolSignal, []byte("tx"))
+	local.Publish(BlockInfo, &blockEvent{Height: 2})
+	m = receive(t, received.c)
+	require.Equal(t, &blockEvent{Height: 2}, m.Payload)
+}
+
+func TestBridgeReplay(t *testing.T) {
+	transport := testBridgeTransport(t)
+	local, remote := NewMessageBus(), NewMessageBus()
+	defer local.Close()
+	defer remote.Close()
+
+	server := NewBridgeServer(local, transport, WithReplayBuffer(4))
+	server.Forward(TxPoolSignal, BytesSerializer{})
+	require.Nil(t, server.Start())
+	for i := 0; i < 10; i++ {
+		local.PublishSafe(TxPoolSignal, []byte{byte(i)})
+	}
+	// not forwarded, a []byte payload is expected
+	local.PublishSafe(TxPoolSignal, "not bytes")
+	require.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return server.seq == 10
+	}, time.Second, 10*time.Millisecond)
+
+	received := &chanSub{c: make(chan *Message, 16)}
+	remote.Register(TxPoolSignal, received)
+	client := NewBridgeClient(remote, transport, WithReconnectInterval(10*time.Millisecond))
+	client.Subscribe(TxPoolSignal, BytesSerializer{})
+	require.Nil(t, client.Start())
+	defer client.Stop()
+
+	// only the last messages are still in the replay buffer
+	for i := 6; i < 10; i++ {
+		require.Equal(t, []byte{byte(i)}, receive(t, received.c).Payload)
+	}
+
+	// the client reconnects to a restarted server
+	server.Stop()
+	server = NewBridgeServer(local, transport, WithReplayBuffer(4))
+	server.Forward(TxPoolSignal, BytesSerializer{})
+	require.Nil(t, server.Start())
+	defer server.Stop()
+	local.PublishSafe(TxPoolSignal, []byte("after restart"))
+	require.Equal(t, []byte("after restart"), receive(t, received.c).Payload)
+}
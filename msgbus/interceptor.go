@@ -0,0 +1,79 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"time"
+)
+
+// Interceptor observes the messages passing through a message bus, for
+// example to attach tracing or audit logging. Interceptors are called in the
+// order they were added, the After* methods in reverse order.
+type Interceptor interface {
+	// BeforePublish is called before a message is published.
+	BeforePublish(m *Message)
+	// AfterPublish is called after a message was handed over to the bus.
+	AfterPublish(m *Message)
+	// BeforeDeliver is called before the subscriber's OnMessage().
+	BeforeDeliver(m *Message, sub Subscriber)
+	// AfterDeliver is called after the subscriber's OnMessage() returned.
+	AfterDeliver(m *Message, sub Subscriber, elapsed time.Duration)
+}
+
+// DefaultInterceptor implements Interceptor with no-ops, embed it to only
+// implement some of the methods.
+type DefaultInterceptor struct{}
+
+func (DefaultInterceptor) BeforePublish(*Message) {}
+
+func (DefaultInterceptor) AfterPublish(*Message) {}
+
+func (DefaultInterceptor) BeforeDeliver(*Message, Subscriber) {}
+
+func (DefaultInterceptor) AfterDeliver(*Message, Subscriber, time.Duration) {}
+
+// Option configures a message bus created by NewMessageBus().
+type Option func(*messageBusImpl)
+
+// WithInterceptors adds interceptors to the message bus.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(b *messageBusImpl) {
+		b.interceptors = append(b.interceptors, interceptors...)
+	}
+}
+
+// beforePublish runs the interceptors before a publish.
+func (b *messageBusImpl) beforePublish(m *Message) {
+	for _, i := range b.interceptors {
+		i.BeforePublish(m)
+	}
+}
+
+// afterPublish runs the interceptors after a publish.
+func (b *messageBusImpl) afterPublish(m *Message) {
+	for i := len(b.interceptors) - 1; i >= 0; i-- {
+		b.interceptors[i].AfterPublish(m)
+	}
+}
+
+// deliver calls the subscriber's OnMessage() wrapped by the interceptors.
+func (b *messageBusImpl) deliver(m *Message, sub Subscriber) {
+	if len(b.interceptors) == 0 {
+		sub.OnMessage(m)
+		return
+	}
+	for _, i := range b.interceptors {
+		i.BeforeDeliver(m, sub)
+	}
+	start := time.Now()
+	sub.OnMessage(m)
+	elapsed := time.Since(start)
+	for i := len(b.interceptors) - 1; i >= 0; i-- {
+		b.interceptors[i].AfterDeliver(m, sub, elapsed)
+	}
+}
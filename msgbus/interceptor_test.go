@@ -0,0 +1,95 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordInterceptor struct {
+	name   string
+	mu     *sync.Mutex
+	events *[]string
+}
+
+func (r *recordInterceptor) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.events = append(*r.events, r.name+"."+event)
+}
+
+func (r *recordInterceptor) BeforePublish(m *Message) {
+	r.record(fmt.Sprintf("BeforePublish(%v)", m.Payload))
+}
+
+func (r *recordInterceptor) AfterPublish(m *Message) {
+	r.record(fmt.Sprintf("AfterPublish(%v)", m.Payload))
+}
+
+func (r *recordInterceptor) BeforeDeliver(m *Message, _ Subscriber) {
+	r.record(fmt.Sprintf("BeforeDeliver(%v)", m.Payload))
+}
+
+func (r *recordInterceptor) AfterDeliver(m *Message, _ Subscriber, _ time.Duration) {
+	r.record(fmt.Sprintf("AfterDeliver(%v)", m.Payload))
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	bus := NewMessageBus(WithInterceptors(
+		&recordInterceptor{name: "a", mu: &mu, events: &events},
+		&recordInterceptor{name: "b", mu: &mu, events: &events},
+	))
+	defer bus.Close()
+	bus.Register(TxPoolSignal, &sub{})
+
+	bus.PublishSync(TxPoolSignal, 1)
+	require.Equal(t, []string{
+		"a.BeforePublish(1)", "b.BeforePublish(1)",
+		"a.BeforeDeliver(1)", "b.BeforeDeliver(1)",
+		"b.AfterDeliver(1)", "a.AfterDeliver(1)",
+		"b.AfterPublish(1)", "a.AfterPublish(1)",
+	}, events)
+}
+
+func TestInterceptorQueue(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	bus := NewMessageBus(WithInterceptors(&recordInterceptor{name: "a", mu: &mu, events: &events}))
+	defer bus.Close()
+	bus.Register(TxPoolSignal, &sub{}, WithQueue(4, PolicyBlock))
+
+	bus.Publish(TxPoolSignal, 1)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 4
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, events, "a.BeforeDeliver(1)")
+	require.Contains(t, events, "a.AfterDeliver(1)")
+}
+
+func TestWithMetrics(t *testing.T) {
+	// creating twice must reuse the registered metrics
+	for i := 0; i < 2; i++ {
+		bus := NewMessageBus(WithMetrics())
+		bus.Register(TxPoolSignal, &sub{}, WithQueue(4, PolicyBlock))
+		bus.PublishSync(TxPoolSignal, i)
+		bus.Publish(TxPoolSignal, i)
+		bus.PublishSafe(TxPoolSignal, i)
+		bus.Close()
+	}
+}
@@ -8,6 +8,7 @@ SPDX-License-Identifier: Apache-2.0
 package msgbus
 
 import (
+	"context"
 	"sync"
 )
 
@@ -19,7 +20,8 @@ const (
 type MessageBus interface {
 	// A subscriber register on s specific topic.
 	// When a message on this topic is published, the subscriber's OnMessage() is called.
-	Register(topic Topic, sub Subscriber)
+	// Options such as WithQueue() apply to this subscriber on this topic only.
+	Register(topic Topic, sub Subscriber, opts ...SubscribeOption)
 	// UnRegister unregister the subscriber from message bus.
 	UnRegister(topic Topic, sub Subscriber)
 	// Used to publish a message on this message bus to notify subscribers.
@@ -30,8 +32,14 @@ type MessageBus interface {
 	// Used to publish a message on this message bus to notify subscribers.
 	// Sync mod, make sure all messages  are completed sequentially.
 	PublishSync(topic Topic, payload interface{})
+	// Request sends the payload to the Responder registered on the topic and waits for its reply.
+	// It fails when ctx is done or the message bus is closed before the reply arrives.
+	Request(ctx context.Context, topic Topic, payload interface{}) (interface{}, error)
 	// Close the message bus, all publishes are ignored.
 	Close()
+	// Stats returns the queue counters of a subscriber registered with WithQueue().
+	// It returns false if the subscriber has no queue on this topic.
+	Stats(topic Topic, sub Subscriber) (QueueStats, bool)
 }
 
 // Subscriber should implement these methods,
@@ -52,24 +60,33 @@ type messageBusImpl struct {
 	topicMap   sync.Map
 	once       sync.Once
 	channelMap sync.Map
+	// subKey -> *subscriberQueue, for subscribers registered with a queue
+	queueMap sync.Map
+	// topic -> channel of the messages published in safe mode
+	safeChannelMap sync.Map
 	// messageC     chan *Message
-	safeMessageC chan *Message
-	quitC        chan struct{}
-	closed       bool
+	quitC  chan struct{}
+	closed bool
+	// interceptors are set at creation and never changed
+	interceptors []Interceptor
 }
 
-func NewMessageBus() MessageBus {
-	return &messageBusImpl{
+// NewMessageBus creates a message bus, options such as WithMetrics() are optional.
+func NewMessageBus(opts ...Option) MessageBus {
+	b := &messageBusImpl{
 		mu: sync.RWMutex{},
 		// topicMap:     make(map[Topic]*list.List),
 		topicMap:   sync.Map{},
 		once:       sync.Once{},
 		channelMap: sync.Map{},
 		// messageC:     make(chan *Message, defaultMessageBufferSize),
-		safeMessageC: make(chan *Message, defaultMessageBufferSize),
-		quitC:        make(chan struct{}),
-		closed:       false,
+		quitC:  make(chan struct{}),
+		closed: false,
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 type Message struct {
@@ -78,7 +95,7 @@ type Message struct {
 }
 
 // Register topic for subscriber
-func (b *messageBusImpl) Register(topic Topic, sub Subscriber) {
+func (b *messageBusImpl) Register(topic Topic, sub Subscriber, opts ...SubscribeOption) {
 	b.once.Do(func() {
 		b.handleMessageLooping()
 	})
@@ -98,17 +115,12 @@ func (b *messageBusImpl) Register(topic Topic, sub Subscriber) {
 		// make one channel for each topic
 		msgC := make(chan *Message, defaultMessageBufferSize)
 		b.channelMap.Store(topic, msgC)
+		// make one safe channel for each topic, so a slow subscriber only blocks the safe messages of its topic
+		safeC := make(chan *Message, defaultMessageBufferSize)
+		b.safeChannelMap.Store(topic, safeC)
 		// start listening channel message for topic
-		go func() {
-			for {
-				select {
-				case <-b.quitC:
-					return
-				case m := <-msgC:
-					go b.notify(m, false)
-				}
-			}
-		}()
+		go b.notifyLooping(msgC, false)
+		go b.notifyLooping(safeC, true)
 	}
 	subs, _ := b.topicMap.Load(topic)
 
@@ -117,6 +129,13 @@ func (b *messageBusImpl) Register(topic Topic, sub Subscriber) {
 	if isRedundant(s, sub) {
 		return
 	}
+	options := &subscribeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.queueSize > 0 {
+		b.queueMap.Store(subKey{topic, sub}, newSubscriberQueue(sub, options, b.deliver))
+	}
 	s = append(s, sub)
 	b.topicMap.Store(topic, s)
 }
@@ -137,6 +156,10 @@ func (b *messageBusImpl) UnRegister(topic Topic, sub Subscriber) {
 			if s == sub {
 				newSubs := append(subs[:i], subs[i+1:]...)
 				b.topicMap.Store(topic, newSubs)
+				if q, ok := b.queueMap.Load(subKey{topic, sub}); ok {
+					q.(*subscriberQueue).close()
+					b.queueMap.Delete(subKey{topic, sub})
+				}
 			}
 		}
 	}
@@ -156,7 +179,10 @@ func (b *messageBusImpl) Publish(topic Topic, payload interface{}) {
 		return
 	}
 	channel, _ := c.(chan *Message)
-	channel <- &Message{Topic: topic, Payload: payload}
+	m := &Message{Topic: topic, Payload: payload}
+	b.beforePublish(m)
+	channel <- m
+	b.afterPublish(m)
 }
 
 func (b *messageBusImpl) PublishSafe(topic Topic, payload interface{}) {
@@ -167,7 +193,16 @@ func (b *messageBusImpl) PublishSafe(topic Topic, payload interface{}) {
 		return
 	}
 
-	b.safeMessageC <- &Message{Topic: topic, Payload: payload}
+	// fetch the safe channel for topic & push message into channel
+	c, _ := b.safeChannelMap.Load(topic)
+	if c == nil {
+		return
+	}
+	channel, _ := c.(chan *Message)
+	m := &Message{Topic: topic, Payload: payload}
+	b.beforePublish(m)
+	channel <- m
+	b.afterPublish(m)
 }
 
 func (b *messageBusImpl) PublishSync(topic Topic, payload interface{}) {
@@ -177,9 +212,12 @@ func (b *messageBusImpl) PublishSync(topic Topic, payload interface{}) {
 	}
 	subs, _ := val.([]Subscriber)
 
+	m := &Message{topic, payload}
+	b.beforePublish(m)
 	for _, sub := range subs {
-		sub.OnMessage(&Message{topic, payload})
+		b.deliver(m, sub)
 	}
+	b.afterPublish(m)
 }
 
 func (b *messageBusImpl) Close() {
@@ -194,34 +232,61 @@ func (b *messageBusImpl) Close() {
 			return true
 		})
 		// close(b.messageC)
-		close(b.safeMessageC)
+		b.safeChannelMap.Range(func(_, v interface{}) bool {
+			channel, _ := v.(chan *Message)
+			close(channel)
+			return true
+		})
+		b.queueMap.Range(func(_, v interface{}) bool {
+			q, _ := v.(*subscriberQueue)
+			q.close()
+			return true
+		})
 	}
 }
 
+// Stats implements the MessageBus interface.
+func (b *messageBusImpl) Stats(topic Topic, sub Subscriber) (QueueStats, bool) {
+	q, ok := b.queueMap.Load(subKey{topic, sub})
+	if !ok {
+		return QueueStats{}, false
+	}
+	return q.(*subscriberQueue).stats(), true
+}
+
 func (b *messageBusImpl) handleMessageLooping() {
 	go func() {
-		for {
-			select {
-			case m := <-b.safeMessageC:
-				b.notify(m, true)
-			case <-b.quitC:
-				b.mu.Lock()
-				// for each top, notify subscribes that message bus is quiting now
-				b.topicMap.Range(func(_, v interface{}) bool {
-					s, _ := v.([]Subscriber)
-					length := len(s)
-					for i := 0; i < length; i++ {
-						s := s[i]
-						go s.OnQuit()
-					}
-					return true
-				})
-				b.closed = true
-				b.mu.Unlock()
+		<-b.quitC
+		b.mu.Lock()
+		// for each top, notify subscribes that message bus is quiting now
+		b.topicMap.Range(func(_, v interface{}) bool {
+			s, _ := v.([]Subscriber)
+			length := len(s)
+			for i := 0; i < length; i++ {
+				s := s[i]
+				go s.OnQuit()
+			}
+			return true
+		})
+		b.closed = true
+		b.mu.Unlock()
+	}()
+}
+
+// notifyLooping notifies the subscribers of the messages from msgC until the message bus is closed,
+// queued subscribers are notified in order, the others in order in safe mode or get a goroutine each
+func (b *messageBusImpl) notifyLooping(msgC chan *Message, isSafe bool) {
+	for {
+		select {
+		case <-b.quitC:
+			return
+		case m, ok := <-msgC:
+			if !ok {
 				return
 			}
+			b.notify(m, isSafe)
 		}
-	}()
+	}
 }
 
 // notify subscribers when msg comes
@@ -238,10 +303,12 @@ func (b *messageBusImpl) notify(m *Message, isSafe bool) {
 	subs, _ := val.([]Subscriber)
 
 	for _, sub := range subs {
-		if isSafe {
-			sub.OnMessage(m) // notify in order
+		if q, ok := b.queueMap.Load(subKey{m.Topic, sub}); ok {
+			q.(*subscriberQueue).push(m) // notify in order, bounded by the queue
+		} else if isSafe {
+			b.deliver(m, sub) // notify in order
 		} else {
-			go sub.OnMessage(m)
+			go b.deliver(m, sub)
 		}
 	}
 }
@@ -0,0 +1,73 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"fmt"
+	"time"
+
+	"chainmaker.org/chainmaker/common/v2/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricPublishCounter      = "metric_publish_counter"
+	metricDeliverTime         = "metric_deliver_time"
+	metricQueueDepth          = "metric_queue_depth"
+	helpPublishCounterMetric  = "published messages per topic metric"
+	helpDeliverTimeMetric     = "subscriber OnMessage time per topic and subscriber type metric"
+	helpQueueDepthMetric      = "queued messages per topic and subscriber type metric"
+	labelTopic                = "topic"
+	labelSubscriber           = "subscriber"
+	topicChannelSubscriberTag = "topic"
+)
+
+// WithMetrics records the publish counts, the queue depths and the
+// OnMessage() latency per topic and per subscriber type with the monitor
+// package.
+func WithMetrics() Option {
+	return func(b *messageBusImpl) {
+		b.interceptors = append(b.interceptors, &metricsInterceptor{
+			bus: b,
+			publishCounter: monitor.NewCounterVec(monitor.SUBSYSTEM_MSGBUS, metricPublishCounter,
+				helpPublishCounterMetric, labelTopic),
+			deliverTime: monitor.NewHistogramVec(monitor.SUBSYSTEM_MSGBUS, metricDeliverTime,
+				helpDeliverTimeMetric, prometheus.DefBuckets, labelTopic, labelSubscriber),
+			queueDepth: monitor.NewGaugeVec(monitor.SUBSYSTEM_MSGBUS, metricQueueDepth,
+				helpQueueDepthMetric, labelTopic, labelSubscriber),
+		})
+	}
+}
+
+// metricsInterceptor is the Interceptor that records the metrics.
+type metricsInterceptor struct {
+	DefaultInterceptor
+	bus            *messageBusImpl
+	publishCounter *prometheus.CounterVec
+	deliverTime    *prometheus.HistogramVec
+	queueDepth     *prometheus.GaugeVec
+}
+
+func (mi *metricsInterceptor) AfterPublish(m *Message) {
+	topic := m.Topic.String()
+	mi.publishCounter.WithLabelValues(topic).Inc()
+	// depth of the topic channel used by Publish()
+	if c, ok := mi.bus.channelMap.Load(m.Topic); ok {
+		channel, _ := c.(chan *Message)
+		mi.queueDepth.WithLabelValues(topic, topicChannelSubscriberTag).Set(float64(len(channel)))
+	}
+}
+
+func (mi *metricsInterceptor) AfterDeliver(m *Message, sub Subscriber, elapsed time.Duration) {
+	topic := m.Topic.String()
+	subType := fmt.Sprintf("%T", sub)
+	mi.deliverTime.WithLabelValues(topic, subType).Observe(elapsed.Seconds())
+	if stats, ok := mi.bus.Stats(m.Topic, sub); ok {
+		mi.queueDepth.WithLabelValues(topic, subType).Set(float64(stats.Len))
+	}
+}
@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	reflect "reflect"
 
 	msgbus "chainmaker.org/chainmaker/common/v2/msgbus"
@@ -83,15 +84,50 @@ func (mr *MockMessageBusMockRecorder) PublishSync(topic, payload interface{}) *g
 }
 
 // Register mocks base method.
-func (m *MockMessageBus) Register(topic msgbus.Topic, sub msgbus.Subscriber) {
+func (m *MockMessageBus) Register(topic msgbus.Topic, sub msgbus.Subscriber, opts ...msgbus.SubscribeOption) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Register", topic, sub)
+	varargs := []interface{}{topic, sub}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Register", varargs...)
 }
 
 // Register indicates an expected call of Register.
-func (mr *MockMessageBusMockRecorder) Register(topic, sub interface{}) *gomock.Call {
+func (mr *MockMessageBusMockRecorder) Register(topic, sub interface{}, opts ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockMessageBus)(nil).Register), topic, sub)
+	varargs := append([]interface{}{topic, sub}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockMessageBus)(nil).Register), varargs...)
+}
+
+// Request mocks base method.
+func (m *MockMessageBus) Request(ctx context.Context, topic msgbus.Topic, payload interface{}) (interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Request", ctx, topic, payload)
+	ret0, _ := ret[0].(interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Request indicates an expected call of Request.
+func (mr *MockMessageBusMockRecorder) Request(ctx, topic, payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Request", reflect.TypeOf((*MockMessageBus)(nil).Request), ctx, topic, payload)
+}
+
+// Stats mocks base method.
+func (m *MockMessageBus) Stats(topic msgbus.Topic, sub msgbus.Subscriber) (msgbus.QueueStats, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats", topic, sub)
+	ret0, _ := ret[0].(msgbus.QueueStats)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockMessageBusMockRecorder) Stats(topic, sub interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockMessageBus)(nil).Stats), topic, sub)
 }
 
 // UnRegister mocks base method.
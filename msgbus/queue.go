@@ -0,0 +1,196 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueueFull is passed to the error handler of a subscriber registered with
+// the PolicyError policy when a message is rejected.
+var ErrQueueFull = errors.New("subscriber queue is full")
+
+// QueuePolicy decides what happens to a message published to a subscriber
+// whose queue is full.
+type QueuePolicy int
+
+const (
+	// PolicyBlock waits until the subscriber takes a message from its queue.
+	// The delivery of the topic is blocked meanwhile, for Publish() and PublishSafe()
+	// alike, and so are the other subscribers of the topic. Other topics are not affected.
+	PolicyBlock QueuePolicy = iota
+	// PolicyDropOldest drops the oldest queued message to make room.
+	PolicyDropOldest
+	// PolicyDropNewest drops the published message.
+	PolicyDropNewest
+	// PolicyError drops the published message and reports ErrQueueFull to the
+	// error handler of the subscriber.
+	PolicyError
+)
+
+// SubscribeOption configures a subscriber at Register time.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	queueSize int
+	policy    QueuePolicy
+	onError   func(*Message, error)
+}
+
+// WithQueue delivers the messages of the subscriber in publish order through a
+// bounded queue of the given size, handled by one goroutine per subscriber.
+// The policy decides what happens when the queue is full.
+func WithQueue(size int, policy QueuePolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.queueSize = size
+		o.policy = policy
+	}
+}
+
+// WithErrorHandler sets the handler called for messages rejected by the
+// PolicyError policy.
+func WithErrorHandler(fn func(*Message, error)) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.onError = fn
+	}
+}
+
+// QueueStats are the counters of a subscriber queue.
+type QueueStats struct {
+	// Len is the number of messages waiting in the queue.
+	Len int
+	// Delivered is the number of messages passed to OnMessage().
+	Delivered uint64
+	// Dropped is the number of messages dropped because the queue was full.
+	Dropped uint64
+	// Delayed is the number of publishes that waited for room in the queue.
+	Delayed uint64
+}
+
+// subKey identifies a subscriber registered on a topic.
+type subKey struct {
+	topic Topic
+	sub   Subscriber
+}
+
+// subscriberQueue is the bounded queue of a single subscriber.
+type subscriberQueue struct {
+	sub     Subscriber
+	deliver func(*Message, Subscriber)
+	size    int
+	policy  QueuePolicy
+	onError func(*Message, error)
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	msgs     []*Message
+	closed   bool
+
+	delivered uint64
+	dropped   uint64
+	delayed   uint64
+}
+
+func newSubscriberQueue(sub Subscriber, opts *subscribeOptions,
+	deliver func(*Message, Subscriber)) *subscriberQueue {
+	q := &subscriberQueue{
+		sub:     sub,
+		deliver: deliver,
+		size:    opts.queueSize,
+		policy:  opts.policy,
+		onError: opts.onError,
+		msgs:    make([]*Message, 0, opts.queueSize),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	go q.loop()
+	return q
+}
+
+// push adds the message to the queue following the queue policy.
+func (q *subscriberQueue) push(m *Message) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	if len(q.msgs) >= q.size {
+		switch q.policy {
+		case PolicyBlock:
+			atomic.AddUint64(&q.delayed, 1)
+			for len(q.msgs) >= q.size && !q.closed {
+				q.notFull.Wait()
+			}
+			if q.closed {
+				q.mu.Unlock()
+				return
+			}
+		case PolicyDropOldest:
+			atomic.AddUint64(&q.dropped, 1)
+			q.msgs[0] = nil
+			q.msgs = q.msgs[1:]
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+			q.mu.Unlock()
+			if q.policy == PolicyError && q.onError != nil {
+				q.onError(m, ErrQueueFull)
+			}
+			return
+		}
+	}
+	q.msgs = append(q.msgs, m)
+	q.notEmpty.Signal()
+	q.mu.Unlock()
+}
+
+// loop delivers the queued messages until the queue is closed.
+func (q *subscriberQueue) loop() {
+	for {
+		q.mu.Lock()
+		for len(q.msgs) == 0 && !q.closed {
+			q.notEmpty.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		m := q.msgs[0]
+		q.msgs[0] = nil
+		q.msgs = q.msgs[1:]
+		q.notFull.Signal()
+		q.mu.Unlock()
+
+		q.deliver(m, q.sub)
+		atomic.AddUint64(&q.delivered, 1)
+	}
+}
+
+// close stops the delivery, queued messages are discarded.
+func (q *subscriberQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.msgs = nil
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *subscriberQueue) stats() QueueStats {
+	q.mu.Lock()
+	n := len(q.msgs)
+	q.mu.Unlock()
+	return QueueStats{
+		Len:       n,
+		Delivered: atomic.LoadUint64(&q.delivered),
+		Dropped:   atomic.LoadUint64(&q.dropped),
+		Delayed:   atomic.LoadUint64(&q.delayed),
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSub blocks in OnMessage until it is released.
+type blockingSub struct {
+	mu      sync.Mutex
+	seq     []int
+	started int32
+	release chan struct{}
+}
+
+func (s *blockingSub) OnMessage(m *Message) {
+	atomic.AddInt32(&s.started, 1)
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, _ := m.Payload.(int)
+	s.seq = append(s.seq, i)
+}
+
+func (s *blockingSub) OnQuit() {}
+
+func (s *blockingSub) received() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int{}, s.seq...)
+}
+
+func TestQueueInOrder(t *testing.T) {
+	bus := NewMessageBus()
+	defer bus.Close()
+	s := &sub4safe{seq: make([]int, 0)}
+	bus.Register(ProposedBlock, s, WithQueue(16, PolicyBlock))
+	for i := 0; i < 1000; i++ {
+		bus.PublishSafe(ProposedBlock, i)
+	}
+	require.Eventually(t, func() bool {
+		stats, ok := bus.Stats(ProposedBlock, s)
+		return ok && stats.Delivered == 1000
+	}, 3*time.Second, 10*time.Millisecond)
+	require.True(t, isOrder(s.seq))
+}
+
+func TestQueueDropPolicies(t *testing.T) {
+	bus := NewMessageBus()
+	defer bus.Close()
+	oldest := &blockingSub{release: make(chan struct{})}
+	newest := &blockingSub{release: make(chan struct{})}
+	var rejected int32
+	failing := &blockingSub{release: make(chan struct{})}
+	bus.Register(TxPoolSignal, oldest, WithQueue(2, PolicyDropOldest))
+	bus.Register(TxPoolSignal, newest, WithQueue(2, PolicyDropNewest))
+	bus.Register(TxPoolSignal, failing, WithQueue(2, PolicyError),
+		WithErrorHandler(func(m *Message, err error) {
+			require.Equal(t, ErrQueueFull, err)
+			atomic.AddInt32(&rejected, 1)
+		}))
+
+	// the first message is taken by the blocked subscriber, two are queued
+	bus.PublishSafe(TxPoolSignal, 0)
+	require.Eventually(t, func() bool {
+		for _, s := range []*blockingSub{oldest, newest, failing} {
+			if atomic.LoadInt32(&s.started) == 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	for i := 1; i < 10; i++ {
+		bus.PublishSafe(TxPoolSignal, i)
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&rejected) == 7
+	}, time.Second, time.Millisecond)
+
+	close(oldest.release)
+	close(newest.release)
+	close(failing.release)
+	require.Eventually(t, func() bool {
+		return len(oldest.received()) == 3 && len(newest.received()) == 3 && len(failing.received()) == 3
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []int{0, 8, 9}, oldest.received())
+	require.Equal(t, []int{0, 1, 2}, newest.received())
+	require.Equal(t, []int{0, 1, 2}, failing.received())
+	for _, s := range []Subscriber{oldest, newest, failing} {
+		stats, ok := bus.Stats(TxPoolSignal, s)
+		require.True(t, ok)
+		require.Equal(t, uint64(7), stats.Dropped)
+	}
+}
+
+func TestQueueBlockPolicy(t *testing.T) {
+	bus := NewMessageBus()
+	defer bus.Close()
+	s := &blockingSub{release: make(chan struct{})}
+	bus.Register(ProposedBlock, s, WithQueue(1, PolicyBlock))
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			bus.PublishSafe(ProposedBlock, i)
+		}
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		stats, _ := bus.Stats(ProposedBlock, s)
+		return stats.Delayed >= 1
+	}, time.Second, time.Millisecond)
+	close(s.release)
+	<-done
+	require.Eventually(t, func() bool {
+		return len(s.received()) == 5
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []int{0, 1, 2, 3, 4}, s.received())
+
+	// no stats without a queue
+	_, ok := bus.Stats(ProposedBlock, &sub{})
+	require.False(t, ok)
+
+	// unregister stops the queue
+	bus.UnRegister(ProposedBlock, s)
+	_, ok = bus.Stats(ProposedBlock, s)
+	require.False(t, ok)
+}
+
+func TestQueueBlockPolicyOtherTopics(t *testing.T) {
+	bus := NewMessageBus()
+	defer bus.Close()
+	blocked := &blockingSub{release: make(chan struct{})}
+	bus.Register(ProposedBlock, blocked, WithQueue(1, PolicyBlock))
+	other := &blockingSub{release: make(chan struct{})}
+	close(other.release)
+	bus.Register(TxPoolSignal, other)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			bus.PublishSafe(ProposedBlock, i)
+		}
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		stats, _ := bus.Stats(ProposedBlock, blocked)
+		return stats.Delayed >= 1
+	}, time.Second, time.Millisecond)
+
+	// the safe messages of the other topics are still delivered
+	for i := 0; i < 5; i++ {
+		bus.PublishSafe(TxPoolSignal, i)
+	}
+	require.Eventually(t, func() bool {
+		return len(other.received()) == 5
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []int{0, 1, 2, 3, 4}, other.received())
+	close(blocked.release)
+	<-done
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNoResponder is returned by Request when no Responder is registered on the topic.
+	ErrNoResponder = errors.New("no responder registered on topic")
+	// ErrBusClosed is returned by Request when the message bus is closed before the reply arrives.
+	ErrBusClosed = errors.New("message bus is closed")
+)
+
+// Responder is a subscriber that also answers requests made with Request().
+// It is registered with Register() like any other subscriber.
+type Responder interface {
+	Subscriber
+
+	// OnRequest handles a request, the returned reply or error is routed back
+	// to the caller of Request(). The context is done when the caller gives up.
+	OnRequest(ctx context.Context, m *Message) (interface{}, error)
+}
+
+type reply struct {
+	payload interface{}
+	err     error
+}
+
+// Request implements the MessageBus interface.
+func (b *messageBusImpl) Request(ctx context.Context, topic Topic, payload interface{}) (interface{}, error) {
+	b.mu.RLock()
+	if b.isClosed() {
+		b.mu.RUnlock()
+		return nil, ErrBusClosed
+	}
+	responder := b.responder(topic)
+	b.mu.RUnlock()
+	if responder == nil {
+		return nil, ErrNoResponder
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replyC := make(chan reply, 1)
+	go func() {
+		r, err := responder.OnRequest(ctx, &Message{Topic: topic, Payload: payload})
+		replyC <- reply{payload: r, err: err}
+	}()
+
+	select {
+	case r := <-replyC:
+		return r.payload, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-b.quitC:
+		return nil, ErrBusClosed
+	}
+}
+
+// responder returns the first Responder registered on the topic.
+func (b *messageBusImpl) responder(topic Topic) Responder {
+	val, _ := b.topicMap.Load(topic)
+	subs, _ := val.([]Subscriber)
+	for _, sub := range subs {
+		if r, ok := sub.(Responder); ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// isClosed reports whether Close() was called.
+func (b *messageBusImpl) isClosed() bool {
+	select {
+	case <-b.quitC:
+		return true
+	default:
+		return b.closed
+	}
+}
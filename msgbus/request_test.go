@@ -0,0 +1,80 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type echoResponder struct {
+	DefaultSubscriber
+	delay time.Duration
+}
+
+func (r *echoResponder) OnRequest(ctx context.Context, m *Message) (interface{}, error) {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if m.Payload == nil {
+		return nil, errors.New("empty request")
+	}
+	return m.Payload, nil
+}
+
+func TestRequest(t *testing.T) {
+	bus := NewMessageBus()
+	defer bus.Close()
+
+	_, err := bus.Request(context.Background(), TxPoolSignal, 1)
+	require.Equal(t, ErrNoResponder, err)
+
+	// plain subscribers are skipped
+	bus.Register(TxPoolSignal, &sub{})
+	bus.Register(TxPoolSignal, &echoResponder{})
+	r, err := bus.Request(context.Background(), TxPoolSignal, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, r)
+
+	_, err = bus.Request(context.Background(), TxPoolSignal, nil)
+	require.EqualError(t, err, "empty request")
+}
+
+func TestRequestTimeout(t *testing.T) {
+	bus := NewMessageBus()
+	defer bus.Close()
+	bus.Register(TxPoolSignal, &echoResponder{delay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := bus.Request(ctx, TxPoolSignal, 1)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestRequestClose(t *testing.T) {
+	bus := NewMessageBus()
+	bus.Register(TxPoolSignal, &echoResponder{delay: time.Second})
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := bus.Request(context.Background(), TxPoolSignal, 1)
+		errC <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	bus.Close()
+	require.Equal(t, ErrBusClosed, <-errC)
+
+	_, err := bus.Request(context.Background(), TxPoolSignal, 1)
+	require.Equal(t, ErrBusClosed, err)
+}
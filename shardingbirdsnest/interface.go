@@ -12,4 +12,11 @@ type ShardingAlgorithm interface {
 	DoShardingOnce(bn.Key) (index int)
 }
 
+// ResizableAlgorithm A ShardingAlgorithm that can be created for another number of shards, required to reshard
+type ResizableAlgorithm interface {
+	ShardingAlgorithm
+	// Resize the same algorithm for length shards
+	Resize(length int) ShardingAlgorithm
+}
+
 type KeyModuloAlgorithm func(key bn.Key, length int) int
@@ -0,0 +1,241 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package shardingbirdsnest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	bn "chainmaker.org/chainmaker/common/v2/birdsnest"
+)
+
+const (
+	// LayoutDir prefix of the snapshot path of the bird's nests created by a reshard
+	// eg: data/org1/tx_filter/layout8/chain1/birdsnest1
+	LayoutDir = "layout"
+	// reshardFileName the file of the layout being migrated to, holding the time the reshard began
+	reshardFileName = "reshard"
+)
+
+var (
+	ErrReshardInProgress     = errors.New("a reshard is in progress")
+	ErrNoReshardInProgress   = errors.New("no reshard in progress")
+	ErrReshardSameLength     = errors.New("the number of shards is unchanged")
+	ErrAlgorithmNotResizable = errors.New("the sharding algorithm is not resizable")
+	ErrReshardNotMigrated    = errors.New("the keys of the previous layout are still in the AbsoluteExpireTime window")
+)
+
+// shardingLayout the bird's nests of a number of shards and the algorithm placing the keys on them
+type shardingLayout struct {
+	bn        []bn.BirdsNest
+	algorithm ShardingAlgorithm
+	length    uint32
+	// dir snapshot path of the bird's nests, the path of the bird's nest configuration if empty
+	dir string
+}
+
+/*
+BeginReshard
+Migrate the sharding to length shards online. The keys are added to the new layout from now on, and Contains
+queries the new layout and then the previous one, so no key is lost during the migration.
+A cuckoo filter only stores fingerprints, the keys cannot be placed again from the filter contents. The contents
+are migrated once the keys of the previous layout are out of the AbsoluteExpireTime window, then CompleteReshard
+drops the previous layout. When they are added again before (e.g. the txIds of the block store within the window),
+ForceCompleteReshard drops it at once.
+The reshard is recorded in the snapshot and resumed after a restart; restarting with another number of shards in
+the configuration begins the reshard as well.
+*/
+func (s *ShardingBirdsNest) BeginReshard(length uint32) error {
+	s.lifecycleM.Lock()
+	defer s.lifecycleM.Unlock()
+	s.layoutM.Lock()
+	defer s.layoutM.Unlock()
+	if s.previous != nil {
+		return ErrReshardInProgress
+	}
+	if length == 0 {
+		return bn.ErrBirdsNestSizeCannotBeZero
+	}
+	if length == s.length {
+		return ErrReshardSameLength
+	}
+	resizable, ok := s.algorithm.(ResizableAlgorithm)
+	if !ok {
+		return ErrAlgorithmNotResizable
+	}
+	layout, err := s.openLayout(length, resizable.Resize(int(length)), true)
+	if err != nil && err != bn.ErrCannotModifyTheNestConfiguration {
+		return err
+	}
+	for _, nest := range layout.bn {
+		if s.verifier != nil {
+			nest.SetExistenceVerifier(s.verifier)
+		}
+		// the height signals a serialization in the Height mode, which blocks until the nest is started
+		if s.cancel != nil && !s.stopped {
+			nest.Start(s.ctx)
+			nest.SetHeight(s.height)
+		}
+	}
+	reshardAt, err := s.reshardBeganAt(layout.dir)
+	if err != nil {
+		_ = s.closeLayout(context.Background(), layout)
+		return err
+	}
+	previous := &shardingLayout{bn: s.bn, algorithm: s.algorithm, length: s.length, dir: s.dir}
+	s.bn, s.algorithm, s.length, s.dir, s.previous = layout.bn, layout.algorithm, layout.length, layout.dir, previous
+	s.reshardAt = reshardAt
+	if err = s.serialize(); err != nil {
+		// the previous layout remains
+		s.bn, s.algorithm, s.length, s.dir, s.previous = previous.bn, previous.algorithm, previous.length,
+			previous.dir, nil
+		_ = s.closeLayout(context.Background(), layout)
+		return err
+	}
+	s.log.Infof("sharding bird's nest resharding from %v to %v shards", previous.length, length)
+	return nil
+}
+
+// CompleteReshard Drop the layout being migrated from, its bird's nests are stopped and their snapshots removed.
+// ErrReshardNotMigrated is returned until the AbsoluteExpireTime window has elapsed since BeginReshard, nothing
+// expires without a window.
+func (s *ShardingBirdsNest) CompleteReshard(ctx context.Context) error {
+	return s.completeReshard(ctx, false)
+}
+
+// ForceCompleteReshard Drop the layout being migrated from like CompleteReshard, before the end of the window. The
+// keys of the previous layout in the window must have been added again, the others are lost.
+func (s *ShardingBirdsNest) ForceCompleteReshard(ctx context.Context) error {
+	return s.completeReshard(ctx, true)
+}
+
+func (s *ShardingBirdsNest) completeReshard(ctx context.Context, force bool) error {
+	s.lifecycleM.Lock()
+	defer s.lifecycleM.Unlock()
+	s.layoutM.Lock()
+	defer s.layoutM.Unlock()
+	previous := s.previous
+	if previous == nil {
+		return ErrNoReshardInProgress
+	}
+	window := time.Duration(s.config.Birdsnest.GetRules().GetAbsoluteExpireTime()) * time.Second
+	if !force && (window <= 0 || time.Since(s.reshardAt) < window) {
+		return ErrReshardNotMigrated
+	}
+	s.previous = nil
+	if err := s.serialize(); err != nil {
+		s.previous = previous
+		return err
+	}
+	s.previousLength = 0
+	if err := os.Remove(filepath.Join(s.dir, reshardFileName)); err != nil && !os.IsNotExist(err) {
+		s.log.Errorf("sharding bird's nest remove reshard file error: %v", err)
+	}
+	s.log.Infof("sharding bird's nest reshard to %v shards completed", s.length)
+	return s.closeLayout(ctx, previous)
+}
+
+// Resharding whether a reshard is in progress
+func (s *ShardingBirdsNest) Resharding() bool {
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
+	return s.previous != nil
+}
+
+// reshardBeganAt Get the time the reshard to the layout of the directory began, now for a new reshard
+func (s *ShardingBirdsNest) reshardBeganAt(dir string) (time.Time, error) {
+	path := filepath.Join(dir, reshardFileName)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		var nano int64
+		nano, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, nano), nil
+	}
+	if !os.IsNotExist(err) {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return time.Time{}, err
+	}
+	if err = ioutil.WriteFile(path, []byte(strconv.FormatInt(now.UnixNano(), 10)), 0644); err != nil {
+		return time.Time{}, err
+	}
+	return now, nil
+}
+
+// openLayout Open the bird's nests of a layout of length shards. A layout created by a reshard lives in its own
+// directory, the original layout in the path of the bird's nest configuration.
+func (s *ShardingBirdsNest) openLayout(length uint32, alg ShardingAlgorithm, resharded bool) (*shardingLayout,
+	error) {
+	dir := filepath.Join(s.config.Birdsnest.Snapshot.Path, LayoutDir+strconv.Itoa(int(length)))
+	if !resharded {
+		_, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			dir = ""
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	config := *s.config.Birdsnest
+	if dir != "" {
+		snapshot := *config.Snapshot
+		snapshot.Path = dir
+		config.Snapshot = &snapshot
+	}
+	var (
+		err    error
+		layout = &shardingLayout{bn: make([]bn.BirdsNest, length), algorithm: alg, length: length, dir: dir}
+	)
+	for i := 0; i < int(length); i++ {
+		var birdsNest bn.BirdsNest
+		birdsNest, err = bn.NewBirdsNestByNumber(&config, s.exitC, s.strategy, s.log, i+1)
+		if err != nil {
+			if err != bn.ErrCannotModifyTheNestConfiguration {
+				return nil, err
+			}
+		}
+		layout.bn[i] = birdsNest
+	}
+	return layout, err
+}
+
+// closeLayout Stop the bird's nests of a layout and remove their snapshots, the first error is returned
+func (s *ShardingBirdsNest) closeLayout(ctx context.Context, layout *shardingLayout) error {
+	var result error
+	report := func(err error) {
+		if err == nil {
+			return
+		}
+		if result == nil {
+			result = err
+			return
+		}
+		s.log.Errorf("sharding bird's nest close layout error: %v", err)
+	}
+	for _, nest := range layout.bn {
+		report(nest.Stop(ctx))
+	}
+	if layout.dir != "" {
+		report(os.RemoveAll(layout.dir))
+		return result
+	}
+	// eg: data/org1/tx_filter/chain1/birdsnest1
+	path := filepath.Join(s.config.Birdsnest.Snapshot.Path, s.config.Birdsnest.ChainId)
+	for i := range layout.bn {
+		report(os.RemoveAll(filepath.Join(path, bn.Filepath+strconv.Itoa(i+1))))
+	}
+	return result
+}
@@ -0,0 +1,225 @@
+/*
+Copyright (C) BABEC. All rights reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package shardingbirdsnest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	bn "chainmaker.org/chainmaker/common/v2/birdsnest"
+	"chainmaker.org/chainmaker/pb-go/v2/common"
+)
+
+func getReshardSBN(length int, path string, t *testing.T) (*ShardingBirdsNest, error) {
+	return NewShardingBirdsNest(reshardConfig(length, path), make(chan struct{}), bn.LruStrategy,
+		NewConsistentHashSA(length, 0), bn.TestLogger{T: t})
+}
+
+func reshardConfig(length int, path string) *common.ShardingBirdsNestConfig {
+	return &common.ShardingBirdsNestConfig{
+		ChainId: "chain1",
+		Length:  uint32(length),
+		Timeout: 10,
+		Birdsnest: &common.BirdsNestConfig{
+			ChainId: "chain1",
+			Length:  5,
+			Rules:   &common.RulesConfig{AbsoluteExpireTime: 20},
+			Cuckoo: &common.CuckooConfig{
+				KeyType:       common.KeyType_KTDefault,
+				TagsPerBucket: 4,
+				BitsPerItem:   9,
+				MaxNumKeys:    100,
+				TableType:     1,
+			},
+			Snapshot: &common.SnapshotSerializerConfig{
+				Type:        common.SerializeIntervalType_Timed,
+				Timed:       &common.TimedSerializeIntervalConfig{Interval: 20},
+				BlockHeight: &common.BlockHeightSerializeIntervalConfig{Interval: 20},
+				Path:        filepath.Join(path, "birdsnest"),
+			},
+		},
+		Snapshot: &common.SnapshotSerializerConfig{
+			Type:        common.SerializeIntervalType_Timed,
+			Timed:       &common.TimedSerializeIntervalConfig{Interval: 20},
+			BlockHeight: &common.BlockHeightSerializeIntervalConfig{Interval: 20},
+			Path:        path,
+		},
+	}
+}
+
+func requireContains(t *testing.T, sbn *ShardingBirdsNest, keys []bn.Key) {
+	for _, key := range keys {
+		contains, err := sbn.Contains(key)
+		require.Nil(t, err)
+		require.True(t, contains, "key %v", key)
+	}
+}
+
+func TestConsistentHashShardingAlgorithm(t *testing.T) {
+	keys := bn.GetTimestampKeys(2000)
+	a4, a5 := NewConsistentHashSA(4, 0), NewConsistentHashSA(5, 0)
+	counts := make([]int, 5)
+	var moved int
+	for _, key := range keys {
+		index := a5.DoShardingOnce(key)
+		counts[index]++
+		if a4.DoShardingOnce(key) != index {
+			moved++
+		}
+	}
+	// about 1/5 of the keys move to the new shard
+	require.Less(t, moved, len(keys)*2/5)
+	for _, count := range counts {
+		require.Greater(t, count, len(keys)/10)
+	}
+	sharding := a5.DoSharding(keys)
+	require.Equal(t, 5, len(sharding))
+	for i := range sharding {
+		require.Equal(t, counts[i], len(sharding[i]))
+	}
+	require.Equal(t, a5.ring, a4.Resize(5).(*ConsistentHashShardingAlgorithm).ring)
+}
+
+func TestShardingBirdsNest_Reshard(t *testing.T) {
+	path := bn.TestDir + "sharding_reshard"
+	require.Nil(t, os.RemoveAll(path))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sbn, err := getReshardSBN(2, path, t)
+	require.Nil(t, err)
+	sbn.Start(context.Background())
+	old := bn.GetTimestampKeys(50)
+	require.Nil(t, sbn.AddsAndSetHeight(old, 1))
+	require.Equal(t, ErrReshardSameLength, sbn.BeginReshard(2))
+	require.Equal(t, ErrNoReshardInProgress, sbn.CompleteReshard(ctx))
+
+	// both layouts are queried during the migration
+	require.Nil(t, sbn.BeginReshard(4))
+	require.True(t, sbn.Resharding())
+	require.Equal(t, ErrReshardInProgress, sbn.BeginReshard(8))
+	added := bn.GetTimestampKeys(50)
+	require.Nil(t, sbn.AddsAndSetHeight(added, 2))
+	requireContains(t, sbn, old)
+	requireContains(t, sbn, added)
+	result, err := sbn.ContainsBatch(append(append([]bn.Key{}, old...), added...))
+	require.Nil(t, err)
+	for _, contains := range result {
+		require.True(t, contains)
+	}
+	require.Equal(t, 4, len(sbn.Infos()))
+	require.Nil(t, sbn.Stop(ctx))
+
+	// the reshard is resumed after a restart
+	sbn, err = getReshardSBN(4, path, t)
+	require.Nil(t, err)
+	require.True(t, sbn.Resharding())
+	requireContains(t, sbn, old)
+	requireContains(t, sbn, added)
+	_, err = getReshardSBN(8, path+"_other", t)
+	require.Nil(t, err)
+
+	// migrate the previous keys and drop the previous layout
+	require.Equal(t, ErrReshardNotMigrated, sbn.CompleteReshard(ctx))
+	require.Nil(t, sbn.Adds(old))
+	require.Nil(t, sbn.ForceCompleteReshard(ctx))
+	require.False(t, sbn.Resharding())
+	requireContains(t, sbn, old)
+	requireContains(t, sbn, added)
+	_, err = os.Stat(filepath.Join(path, "birdsnest", "chain1", bn.Filepath+"1"))
+	require.True(t, os.IsNotExist(err))
+	require.Nil(t, sbn.Stop(ctx))
+
+	// restarting with another number of shards begins a reshard
+	sbn, err = getReshardSBN(3, path, t)
+	require.Nil(t, err)
+	require.True(t, sbn.Resharding())
+	requireContains(t, sbn, old)
+	require.Nil(t, sbn.ForceCompleteReshard(ctx))
+	_, err = os.Stat(filepath.Join(path, "birdsnest", LayoutDir+"4"))
+	require.True(t, os.IsNotExist(err))
+	require.Nil(t, sbn.Stop(ctx))
+}
+
+func TestShardingBirdsNest_CompleteReshardWindow(t *testing.T) {
+	path := bn.TestDir + "sharding_reshard_window"
+	require.Nil(t, os.RemoveAll(path))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sbn, err := getReshardSBN(2, path, t)
+	require.Nil(t, err)
+	old := bn.GetTimestampKeys(50)
+	require.Nil(t, sbn.AddsAndSetHeight(old, 1))
+	require.Nil(t, sbn.BeginReshard(4))
+	reshardAt := sbn.reshardAt
+
+	// the previous keys are in the window
+	require.Equal(t, ErrReshardNotMigrated, sbn.CompleteReshard(ctx))
+	require.True(t, sbn.Resharding())
+	require.Nil(t, sbn.Stop(ctx))
+
+	// the window runs from the beginning of the reshard, not from the restart
+	sbn, err = getReshardSBN(4, path, t)
+	require.Nil(t, err)
+	require.True(t, sbn.reshardAt.Equal(reshardAt))
+	require.Equal(t, ErrReshardNotMigrated, sbn.CompleteReshard(ctx))
+
+	// the previous keys are out of the window
+	sbn.reshardAt = sbn.reshardAt.Add(-20 * time.Second)
+	require.Nil(t, sbn.CompleteReshard(ctx))
+	require.False(t, sbn.Resharding())
+	_, err = os.Stat(filepath.Join(path, "birdsnest", LayoutDir+"4", reshardFileName))
+	require.True(t, os.IsNotExist(err))
+	require.Nil(t, sbn.Stop(ctx))
+}
+
+func TestShardingBirdsNest_ReshardHeight(t *testing.T) {
+	path := bn.TestDir + "sharding_reshard_height"
+	require.Nil(t, os.RemoveAll(path))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	config := reshardConfig(2, path)
+	config.Snapshot.Type = common.SerializeIntervalType_Height
+	config.Birdsnest.Snapshot.Type = common.SerializeIntervalType_Height
+	config.Birdsnest.Snapshot.BlockHeight.Interval = 1
+
+	// a reshard before the start does not wait for the serialization of the new nests
+	sbn, err := NewShardingBirdsNest(config, make(chan struct{}), bn.LruStrategy, NewConsistentHashSA(2, 0),
+		bn.TestLogger{T: t})
+	require.Nil(t, err)
+	require.Nil(t, sbn.BeginReshard(3))
+	sbn.Start(context.Background())
+	old := bn.GetTimestampKeys(50)
+	require.Nil(t, sbn.AddsAndSetHeight(old, 1))
+	require.Nil(t, sbn.ForceCompleteReshard(ctx))
+
+	// nor one of a started nest
+	require.Nil(t, sbn.BeginReshard(4))
+	added := bn.GetTimestampKeys(50)
+	require.Nil(t, sbn.AddsAndSetHeight(added, 2))
+	requireContains(t, sbn, old)
+	requireContains(t, sbn, added)
+	for _, nest := range sbn.bn {
+		require.Equal(t, uint64(2), nest.GetHeight())
+	}
+	require.Nil(t, sbn.Stop(ctx))
+
+	config.Length = 4
+	sbn, err = NewShardingBirdsNest(config, make(chan struct{}), bn.LruStrategy, NewConsistentHashSA(4, 0),
+		bn.TestLogger{T: t})
+	require.Nil(t, err)
+	require.True(t, sbn.Resharding())
+	require.Equal(t, uint64(2), sbn.GetHeight())
+	requireContains(t, sbn, old)
+	requireContains(t, sbn, added)
+	require.Nil(t, sbn.Stop(ctx))
+}
@@ -6,6 +6,8 @@ SPDX-License-Identifier: Apache-2.0
 package shardingbirdsnest
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	bn "chainmaker.org/chainmaker/common/v2/birdsnest"
@@ -13,27 +15,123 @@ import (
 	"github.com/gogo/protobuf/proto"
 )
 
-// Start TODO Goroutinue should be turned off using context.Context here
-func (s *ShardingBirdsNest) Start() {
-	go s.serializeMonitor()
-	go s.serializeTimed()
+// Start the serialization goroutines of the sharding and of all bird's nests, they run until ctx is done or Stop is
+// called
+func (s *ShardingBirdsNest) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.lifecycleM.Lock()
+	defer s.lifecycleM.Unlock()
+	if s.cancel != nil || s.stopped {
+		cancel()
+		return
+	}
+	s.ctx = ctx
+	s.cancel = cancel
+	s.doneC = ctx.Done()
+	s.wg.Add(2)
+	go s.serializeMonitor(ctx)
+	go s.serializeTimed(ctx)
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
 	// start all bird's nest
 	for i := range s.bn {
-		s.bn[i].Start()
+		s.bn[i].Start(ctx)
+	}
+	if s.previous != nil {
+		for i := range s.previous.bn {
+			s.previous.bn[i].Start(ctx)
+		}
+	}
+}
+
+// Stop all bird's nests and the sharding serialization, flushes the final snapshots and closes the snapshot wals.
+// ctx bounds the wait for the in-flight serialization. The first error is returned, the others are logged.
+func (s *ShardingBirdsNest) Stop(ctx context.Context) error {
+	s.lifecycleM.Lock()
+	defer s.lifecycleM.Unlock()
+	if s.stopped {
+		return nil
+	}
+	if s.cancel != nil {
+		s.cancel()
+		if err := waitGroupContext(ctx, &s.wg); err != nil {
+			return err
+		}
+	}
+	s.stopped = true
+	if s.doneC == nil {
+		// never started, signals are dropped from now on
+		doneC := make(chan struct{})
+		close(doneC)
+		s.doneC = doneC
+	}
+	var result error
+	report := func(err error) {
+		if err == nil {
+			return
+		}
+		if result == nil {
+			result = err
+			return
+		}
+		s.log.Errorf("sharding bird's nest stop error: %v", err)
+	}
+	s.layoutM.RLock()
+	for i := range s.bn {
+		report(s.bn[i].Stop(ctx))
+	}
+	if s.previous != nil {
+		for i := range s.previous.bn {
+			report(s.previous.bn[i].Stop(ctx))
+		}
+	}
+	s.layoutM.RUnlock()
+	report(s.Serialize())
+	report(s.snapshot.Close())
+	return result
+}
+
+// waitGroupContext Wait for the wait group until ctx is done
+func waitGroupContext(ctx context.Context, wg *sync.WaitGroup) error {
+	doneC := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(doneC)
+	}()
+	select {
+	case <-doneC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func (s *ShardingBirdsNest) Serialize() error {
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
+	return s.serialize()
+}
+
+// serialize the sharding snapshot, the caller holds layoutM. During a reshard the snapshot records the number of
+// shards being migrated from as Length and the target one in Config
+func (s *ShardingBirdsNest) serialize() error {
 	t := time.Now()
 	defer func(log bn.Logger) {
 		elapsed := time.Since(t)
 		log.Infof("sharding bird's nest serialize success elapsed: %v", elapsed)
 	}(s.log)
 
+	length := s.length
+	if s.previous != nil {
+		length = s.previous.length
+	}
+	// the configuration of the current layout
+	config := *s.config
+	config.Length = s.length
 	sbn := &common.ShardingBirdsNest{
-		Length: s.config.Length,
+		Length: length,
 		Height: s.height,
-		Config: s.config,
+		Config: &config,
 	}
 	data, err := proto.Marshal(sbn)
 	if err != nil {
@@ -60,17 +158,29 @@ func (s *ShardingBirdsNest) Deserialize() error {
 	if err != nil {
 		return err
 	}
+	s.height = sharding.Height
+	resharding := sharding.GetLength() != sharding.GetConfig().GetLength()
+	if resharding && sharding.GetConfig().GetLength() != s.config.Length {
+		// the target of the reshard in progress changed
+		return ErrReshardInProgress
+	}
+	if sharding.GetLength() != s.config.Length {
+		s.previousLength = sharding.GetLength()
+		return nil
+	}
 	if proto.Equal(sharding.Config, s.config) {
 		err = ErrCannotModifyTheNestConfiguration
 	}
-	s.height = sharding.Height
 	return err
 }
 
-// serializeMonitor TODO Goroutinue should be turned off using context.Context here
-func (s *ShardingBirdsNest) serializeMonitor() {
-	for { // nolint
+// serializeMonitor
+func (s *ShardingBirdsNest) serializeMonitor(ctx context.Context) {
+	defer s.wg.Done()
+	for {
 		select {
+		case <-ctx.Done():
+			return
 		// 只有当前"序列化类型"的信号才能过来
 		case signal := <-s.serializeC:
 			t, ok := common.SerializeIntervalType_name[int32(signal.typ)]
@@ -98,30 +208,48 @@ func (s *ShardingBirdsNest) serializeMonitor() {
 	}
 }
 
-func (s *ShardingBirdsNest) serializeTimed() {
+func (s *ShardingBirdsNest) serializeTimed(ctx context.Context) {
+	defer s.wg.Done()
 	if s.config.Snapshot.Type != common.SerializeIntervalType_Timed {
 		return
 	}
 	ticker := time.NewTicker(time.Second * time.Duration(s.config.Snapshot.Timed.Interval))
-	// nolint
+	defer ticker.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
-			s.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Timed}
+			select {
+			case s.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Timed}:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
 }
 
 // nolint
 func (s *ShardingBirdsNest) serializeExit() {
-	s.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Exit}
+	s.sendSerializeSignal(serializeSignal{typ: common.SerializeIntervalType_Exit})
 }
 
 func (s *ShardingBirdsNest) serializeHeight(height uint64) {
 	if s.config.Snapshot.Type != common.SerializeIntervalType_Height {
 		return
 	}
-	s.serializeC <- serializeSignal{typ: common.SerializeIntervalType_Height, height: height}
+	s.sendSerializeSignal(serializeSignal{typ: common.SerializeIntervalType_Height, height: height})
+}
+
+// sendSerializeSignal Send the signal to serializeMonitor, dropped once the sharding is stopped
+func (s *ShardingBirdsNest) sendSerializeSignal(signal serializeSignal) {
+	s.lifecycleM.Lock()
+	doneC := s.doneC
+	s.lifecycleM.Unlock()
+	select {
+	case s.serializeC <- signal:
+	case <-doneC:
+	}
 }
 
 // Serialize signal
@@ -6,9 +6,18 @@ SPDX-License-Identifier: Apache-2.0
 package shardingbirdsnest
 
 import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
 	bn "chainmaker.org/chainmaker/common/v2/birdsnest"
 )
 
+const (
+	// DefaultVirtualNodes virtual nodes per shard on the consistent hash ring
+	DefaultVirtualNodes = 160
+)
+
 // ChecksumKeyModulo uint32 checksum
 func ChecksumKeyModulo(key bn.Key, length int) int {
 	return int(key.Key()[key.Len()-1]) % length
@@ -40,3 +49,79 @@ func (a ModuloShardingAlgorithm) DoSharding(shardingValues []bn.Key) [][]bn.Key
 func (a ModuloShardingAlgorithm) DoShardingOnce(key bn.Key) (index int) {
 	return ChecksumKeyModulo(key, a.Length)
 }
+
+// Resize modulo algorithm for length shards
+func (a ModuloShardingAlgorithm) Resize(length int) ShardingAlgorithm {
+	return NewModuloSA(length)
+}
+
+// ConsistentHashShardingAlgorithm Consistent hashing with virtual nodes, changing the number of shards from n to
+// n+1 only moves about 1/(n+1) of the keys, whereas the modulo algorithm moves most of them
+type ConsistentHashShardingAlgorithm struct {
+	Length       int
+	VirtualNodes int
+	// ring sorted hashes of the virtual nodes
+	ring []uint64
+	// shards shard of each virtual node of the ring
+	shards []int
+}
+
+// NewConsistentHashSA Create a consistent hash algorithm of l shards, virtualNodes <= 0 uses DefaultVirtualNodes
+func NewConsistentHashSA(l, virtualNodes int) *ConsistentHashShardingAlgorithm {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	a := &ConsistentHashShardingAlgorithm{
+		Length:       l,
+		VirtualNodes: virtualNodes,
+		ring:         make([]uint64, 0, l*virtualNodes),
+	}
+	shardOf := make(map[uint64]int, l*virtualNodes)
+	for i := 0; i < l; i++ {
+		for v := 0; v < virtualNodes; v++ {
+			h := hashBytes([]byte(strconv.Itoa(i) + "#" + strconv.Itoa(v)))
+			if _, ok := shardOf[h]; ok {
+				// collision, the first virtual node wins
+				continue
+			}
+			shardOf[h] = i
+			a.ring = append(a.ring, h)
+		}
+	}
+	sort.Slice(a.ring, func(i, j int) bool { return a.ring[i] < a.ring[j] })
+	a.shards = make([]int, len(a.ring))
+	for i, h := range a.ring {
+		a.shards[i] = shardOf[h]
+	}
+	return a
+}
+
+func (a *ConsistentHashShardingAlgorithm) DoSharding(shardingValues []bn.Key) [][]bn.Key {
+	result := make([][]bn.Key, a.Length)
+	for i := range shardingValues {
+		index := a.DoShardingOnce(shardingValues[i])
+		result[index] = append(result[index], shardingValues[i])
+	}
+	return result
+}
+
+// DoShardingOnce the shard of the first virtual node clockwise from the key hash
+func (a *ConsistentHashShardingAlgorithm) DoShardingOnce(key bn.Key) (index int) {
+	h := hashBytes(key.Key())
+	i := sort.Search(len(a.ring), func(i int) bool { return a.ring[i] >= h })
+	if i == len(a.ring) {
+		i = 0
+	}
+	return a.shards[i]
+}
+
+// Resize consistent hash algorithm for length shards with the same virtual nodes
+func (a *ConsistentHashShardingAlgorithm) Resize(length int) ShardingAlgorithm {
+	return NewConsistentHashSA(length, a.VirtualNodes)
+}
+
+func hashBytes(b []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return h.Sum64()
+}
@@ -6,8 +6,11 @@ SPDX-License-Identifier: Apache-2.0
 package shardingbirdsnest
 
 import (
+	"context"
 	"errors"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"time"
 
 	"go.uber.org/atomic"
@@ -20,25 +23,58 @@ const (
 	Filepath = "sharding"
 )
 
+var (
+	// DefaultMaxWorkers default number of shard workers running at a time
+	DefaultMaxWorkers = runtime.NumCPU()
+)
+
 var (
 	ErrAddsTimeout                      = errors.New("add multiple key timeout")
+	ErrContainsTimeout                  = errors.New("contains multiple key timeout")
 	ErrCannotModifyTheNestConfiguration = errors.New("when historical data exists, you cannot modify the nest " +
 		"configuration")
 )
 
 type ShardingBirdsNest struct {
-	bn []bn.BirdsNest
+	// layoutM protects bn, algorithm, length, dir and previous, which a reshard replaces
+	layoutM sync.RWMutex
+	bn      []bn.BirdsNest
+	// length the number of shards of the current layout, config.Length unless resharded after the start
+	length uint32
+	// dir snapshot path of the bird's nests, the path of the bird's nest configuration if empty
+	dir string
+	// previous the layout being migrated from during a reshard, nil otherwise
+	previous *shardingLayout
+	// previousLength the number of shards of the snapshot when it differs from the configuration
+	previousLength uint32
+	// reshardAt the time the reshard in progress began
+	reshardAt time.Time
 
 	config    *common.ShardingBirdsNestConfig
 	height    uint64
 	preHeight *atomic.Uint64
 	algorithm ShardingAlgorithm
+	strategy  bn.Strategy
+	verifier  bn.ExistenceVerifier
+	// workerC bounds the number of shard workers running at a time
+	workerC chan struct{}
 
 	log        bn.Logger
 	serializeC chan serializeSignal
-	// TODO exit -> context.Context
-	exitC    chan struct{}
-	snapshot *bn.WalSnapshot
+	exitC      chan struct{}
+	snapshot   *bn.WalSnapshot
+
+	// lifecycleM protects cancel, doneC and stopped
+	lifecycleM sync.Mutex
+	// ctx the context of Start, the bird's nests created by a reshard are started with it
+	ctx context.Context
+	// cancel stops the goroutines started by Start
+	cancel context.CancelFunc
+	doneC  <-chan struct{}
+	// stopped whether Stop was called
+	stopped bool
+	// wg the goroutines started by Start
+	wg sync.WaitGroup
 }
 
 func NewShardingBirdsNest(config *common.ShardingBirdsNestConfig, exitC chan struct{}, strategy bn.Strategy,
@@ -51,12 +87,14 @@ func NewShardingBirdsNest(config *common.ShardingBirdsNestConfig, exitC chan str
 	}
 	s := &ShardingBirdsNest{
 		algorithm:  alg,
+		strategy:   strategy,
 		exitC:      exitC,
 		config:     config,
 		snapshot:   snapshot,
 		log:        logger,
 		preHeight:  atomic.NewUint64(0),
 		serializeC: make(chan serializeSignal),
+		workerC:    make(chan struct{}, DefaultMaxWorkers),
 	}
 	err = s.Deserialize()
 	if err != nil {
@@ -64,18 +102,30 @@ func NewShardingBirdsNest(config *common.ShardingBirdsNestConfig, exitC chan str
 			return nil, err
 		}
 	}
-	birdsNests := make([]bn.BirdsNest, config.Length)
-	for i := 0; i < int(config.Length); i++ {
-		var birdsNest bn.BirdsNest
-		birdsNest, err = bn.NewBirdsNestByNumber(config.Birdsnest, exitC, strategy, logger, i+1)
-		if err != nil {
-			if err != bn.ErrCannotModifyTheNestConfiguration {
-				return nil, err
-			}
+	if s.previousLength != 0 {
+		// the number of shards changed, the snapshot layout is migrated to the configured one
+		resizable, ok := alg.(ResizableAlgorithm)
+		if !ok {
+			return nil, ErrAlgorithmNotResizable
+		}
+		s.previous, err = s.openLayout(s.previousLength, resizable.Resize(int(s.previousLength)), false)
+		if err != nil && err != bn.ErrCannotModifyTheNestConfiguration {
+			return nil, err
+		}
+		logger.Infof("sharding bird's nest resharding from %v to %v shards", s.previousLength, config.Length)
+	}
+	layout, err := s.openLayout(config.Length, alg, s.previous != nil)
+	if err != nil && err != bn.ErrCannotModifyTheNestConfiguration {
+		return nil, err
+	}
+	s.bn, s.length, s.dir = layout.bn, layout.length, layout.dir
+	if s.previous != nil {
+		reshardAt, reshardErr := s.reshardBeganAt(s.dir)
+		if reshardErr != nil {
+			return nil, reshardErr
 		}
-		birdsNests[i] = birdsNest
+		s.reshardAt = reshardAt
 	}
-	s.bn = birdsNests
 	return s, err
 }
 
@@ -86,9 +136,16 @@ func (s *ShardingBirdsNest) GetHeight() uint64 {
 func (s *ShardingBirdsNest) SetHeight(height uint64) {
 	s.height = height
 	s.serializeHeight(height)
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
 	for _, nest := range s.bn {
 		nest.SetHeight(height)
 	}
+	if s.previous != nil {
+		for _, nest := range s.previous.bn {
+			nest.SetHeight(height)
+		}
+	}
 }
 
 func (s *ShardingBirdsNest) AddsAndSetHeight(keys []bn.Key, height uint64) (result error) {
@@ -100,47 +157,33 @@ func (s *ShardingBirdsNest) AddsAndSetHeight(keys []bn.Key, height uint64) (resu
 	return nil
 }
 
+// Adds the keys, one worker per shard adds the keys of the shard. During a reshard only the new layout is added to
 func (s *ShardingBirdsNest) Adds(keys []bn.Key) (err error) {
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
 	var (
+		// the nests of the layout, a reshard may replace them once unlocked
+		nests = s.bn
 		// sharding algorithm
 		sharding = s.algorithm.DoSharding(keys)
-		// finish channel
-		finishC = make(chan int)
-		// running task
-		runningTask int
-		// Timeout
-		timeout = time.After(time.Duration(s.config.Timeout) * time.Second)
+		shards   []int
 	)
-	for i := 0; i < len(sharding); i++ {
-		if sharding[i] == nil {
-			continue
-		}
-		runningTask++
-		go func(i int, values []bn.Key) {
-			defer func() { finishC <- i }()
-			err = s.bn[i].Adds(values)
-		}(i, sharding[i])
-	}
-	for {
-		select {
-		case <-timeout:
-			return ErrAddsTimeout
-		case <-finishC:
-			if err != nil {
-				return
-			}
-			runningTask--
-			if runningTask <= 0 {
-				return
-			}
+	for i := range sharding {
+		if sharding[i] != nil {
+			shards = append(shards, i)
 		}
 	}
+	return s.runShards(shards, func(i int) error {
+		return nests[i].Adds(sharding[i])
+	}, ErrAddsTimeout)
 }
 
 func (s *ShardingBirdsNest) Add(key bn.Key) error {
 	if key == nil || key.Len() == 0 {
 		return bn.ErrKeyCannotBeEmpty
 	}
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
 	index := s.algorithm.DoShardingOnce(key)
 	err := s.bn[index].Add(key)
 	if err != nil {
@@ -153,12 +196,131 @@ func (s *ShardingBirdsNest) Contains(key bn.Key, rules ...common.RuleType) (bool
 	if key == nil || key.Len() == 0 {
 		return false, bn.ErrKeyCannotBeEmpty
 	}
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
 	index := s.algorithm.DoShardingOnce(key)
 	contains, err := s.bn[index].Contains(key, rules...)
 	if err != nil {
 		return false, err
 	}
-	return contains, nil
+	if contains || s.previous == nil {
+		return contains, nil
+	}
+	// during a reshard the key may still be in the layout being migrated from
+	index = s.previous.algorithm.DoShardingOnce(key)
+	return s.previous.bn[index].Contains(key, rules...)
+}
+
+// ContainsBatch Whether each key is contained, one worker per shard checks the keys of the shard. During a reshard
+// the keys not contained by the new layout are checked in the previous one
+func (s *ShardingBirdsNest) ContainsBatch(keys []bn.Key, rules ...common.RuleType) ([]bool, error) {
+	positions := make([]int, len(keys))
+	for i, key := range keys {
+		if key == nil || key.Len() == 0 {
+			return nil, bn.ErrKeyCannotBeEmpty
+		}
+		positions[i] = i
+	}
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
+	result := make([]bool, len(keys))
+	err := s.containsBatch(s.bn, s.algorithm, keys, positions, result, rules)
+	if err != nil {
+		return nil, err
+	}
+	if s.previous == nil {
+		return result, nil
+	}
+	positions = positions[:0]
+	for i := range result {
+		if !result[i] {
+			positions = append(positions, i)
+		}
+	}
+	err = s.containsBatch(s.previous.bn, s.previous.algorithm, keys, positions, result, rules)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// containsBatch Check the keys at positions in the nests of a layout, the results are set at the same positions
+func (s *ShardingBirdsNest) containsBatch(nests []bn.BirdsNest, alg ShardingAlgorithm, keys []bn.Key,
+	positions []int, result []bool, rules []common.RuleType) error {
+	var (
+		sharding = make([][]int, len(nests))
+		shards   []int
+	)
+	for _, p := range positions {
+		i := alg.DoShardingOnce(keys[p])
+		if sharding[i] == nil {
+			shards = append(shards, i)
+		}
+		sharding[i] = append(sharding[i], p)
+	}
+	return s.runShards(shards, func(i int) error {
+		for _, p := range sharding[i] {
+			contains, err := nests[i].Contains(keys[p], rules...)
+			if err != nil {
+				return err
+			}
+			result[p] = contains
+		}
+		return nil
+	}, ErrContainsTimeout)
+}
+
+// runShards Run the task of each shard in its own worker, at most maxWorkers workers run at a time across the calls.
+// The first error is returned, timeoutErr when the timeout of the configuration elapses first. The tasks not started
+// by then are skipped and the started ones are waited for, since they use the layout the caller holds.
+func (s *ShardingBirdsNest) runShards(shards []int, task func(shard int) error, timeoutErr error) error {
+	var (
+		workerC = s.workerC
+		wg      sync.WaitGroup
+		// buffered, the workers never block on their result
+		errC = make(chan error, len(shards))
+		// stopC closed once the result is known
+		stopC = make(chan struct{})
+		// Timeout
+		timeout = time.After(time.Duration(s.config.Timeout) * time.Second)
+	)
+	wg.Add(len(shards))
+	for _, shard := range shards {
+		go func(shard int) {
+			defer wg.Done()
+			select {
+			case workerC <- struct{}{}:
+			case <-stopC:
+				return
+			}
+			defer func() { <-workerC }()
+			errC <- task(shard)
+		}(shard)
+	}
+	var result error
+	for range shards {
+		select {
+		case <-timeout:
+			result = timeoutErr
+		case result = <-errC:
+		}
+		if result != nil {
+			break
+		}
+	}
+	close(stopC)
+	wg.Wait()
+	return result
+}
+
+// SetMaxWorkers Bound the number of shard workers running at a time, DefaultMaxWorkers by default
+func (s *ShardingBirdsNest) SetMaxWorkers(n int) {
+	if n <= 0 {
+		n = DefaultMaxWorkers
+	}
+	s.layoutM.Lock()
+	defer s.layoutM.Unlock()
+	s.workerC = make(chan struct{}, n)
 }
 
 func (s *ShardingBirdsNest) ValidateRule(key bn.Key, rules ...common.RuleType) error {
@@ -169,6 +331,8 @@ func (s *ShardingBirdsNest) ValidateRule(key bn.Key, rules ...common.RuleType) e
 	// is used by default; If Bird's Nest rules are inconsistent for each shard in the future, open the following code
 	// index := s.algorithm.DoShardingOnce(key)
 	// err := s.bn[index].ValidateRule(key, rules...)
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
 	err := s.bn[0].ValidateRule(key, rules...)
 	if err != nil {
 		return err
@@ -176,6 +340,21 @@ func (s *ShardingBirdsNest) ValidateRule(key bn.Key, rules ...common.RuleType) e
 	return nil
 }
 
+// SetExistenceVerifier Set the verifier of the positive hits of every shard
+func (s *ShardingBirdsNest) SetExistenceVerifier(verifier bn.ExistenceVerifier) {
+	s.layoutM.Lock()
+	defer s.layoutM.Unlock()
+	s.verifier = verifier
+	for i := range s.bn {
+		s.bn[i].SetExistenceVerifier(verifier)
+	}
+	if s.previous != nil {
+		for i := range s.previous.bn {
+			s.previous.bn[i].SetExistenceVerifier(verifier)
+		}
+	}
+}
+
 func (s *ShardingBirdsNest) Info() []uint64 {
 	return nil
 }
@@ -187,8 +366,11 @@ func (s *ShardingBirdsNest) Info() []uint64 {
 // index 2 current index
 // index 3 total cuckoo size
 // index 4 total space occupied by cuckoo
+// index 5 number of cuckoo filters
 func (s *ShardingBirdsNest) Infos() [][]uint64 {
-	infos := make([][]uint64, s.config.Length)
+	s.layoutM.RLock()
+	defer s.layoutM.RUnlock()
+	infos := make([][]uint64, s.length)
 	for i, birdsNest := range s.bn {
 		infos[i] = birdsNest.Info()
 	}
@@ -6,8 +6,12 @@ SPDX-License-Identifier: Apache-2.0
 package shardingbirdsnest
 
 import (
+	"context"
+	"os"
 	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	bn "chainmaker.org/chainmaker/common/v2/birdsnest"
 	"chainmaker.org/chainmaker/pb-go/v2/common"
@@ -301,7 +305,7 @@ func TestShardingBirdsNest_SetHeight(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.fields.bn.Start()
+			tt.fields.bn.Start(context.Background())
 			tt.fields.bn.SetHeight(tt.args.height)
 			if tt.fields.bn.GetHeight() != tt.args.height {
 				t.Errorf("SetHeight() got = %v, want %v", tt.fields.bn.GetHeight(), tt.args.height)
@@ -354,3 +358,105 @@ func getSBN(i int, path string, t *testing.T) *ShardingBirdsNest {
 	}
 	return nest
 }
+
+func TestShardingBirdsNest_Stop(t *testing.T) {
+	path := bn.TestDir + "sharding_stop"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	sbn := getSBN(4, path, t)
+	sbn.Start(context.Background())
+	keys := bn.GetTimestampKeys(20)
+	if err := sbn.AddsAndSetHeight(keys, 1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sbn.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// stopping twice is a no-op, signals are dropped once stopped
+	if err := sbn.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sbn.SetHeight(2)
+
+	// the final snapshots are restored
+	restored := getSBN(4, path, t)
+	defer func() { _ = restored.Stop(ctx) }()
+	for _, key := range keys {
+		contains, err := restored.Contains(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !contains {
+			t.Errorf("key %v not restored", key)
+		}
+	}
+}
+
+func TestShardingBirdsNest_ContainsBatch(t *testing.T) {
+	path := bn.TestDir + "sharding_contains_batch"
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	sbn := getSBN(4, path, t)
+	sbn.SetMaxWorkers(2)
+	keys := bn.GetTimestampKeys(40)
+	if err := sbn.Adds(keys[:20]); err != nil {
+		t.Fatal(err)
+	}
+	result, err := sbn.ContainsBatch(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != len(keys) {
+		t.Fatalf("ContainsBatch() got %v results, want %v", len(result), len(keys))
+	}
+	for i := range keys {
+		contains, err := sbn.Contains(keys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result[i] != contains || contains != (i < 20) {
+			t.Errorf("ContainsBatch() key %v got %v, want %v", i, result[i], contains)
+		}
+	}
+	if _, err = sbn.ContainsBatch([]bn.Key{keys[0], nil}); err != bn.ErrKeyCannotBeEmpty {
+		t.Errorf("ContainsBatch() error = %v, want %v", err, bn.ErrKeyCannotBeEmpty)
+	}
+}
+
+func TestShardingBirdsNest_runShards(t *testing.T) {
+	sbn := &ShardingBirdsNest{
+		config:  &common.ShardingBirdsNestConfig{Timeout: 10},
+		workerC: make(chan struct{}, 2),
+	}
+	var running int32
+	slow := func(shard int) error {
+		atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		if shard == 0 {
+			return bn.ErrKeyCannotBeEmpty
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+
+	// the started workers are done once the first error is returned
+	if err := sbn.runShards([]int{0, 1, 2, 3}, slow, ErrAddsTimeout); err != bn.ErrKeyCannotBeEmpty {
+		t.Errorf("runShards() error = %v, want %v", err, bn.ErrKeyCannotBeEmpty)
+	}
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("runShards() returned with %v running workers", n)
+	}
+
+	// and once the timeout is reported
+	sbn.config.Timeout = 0
+	if err := sbn.runShards([]int{1, 2, 3}, slow, ErrAddsTimeout); err != ErrAddsTimeout {
+		t.Errorf("runShards() error = %v, want %v", err, ErrAddsTimeout)
+	}
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("runShards() returned with %v running workers", n)
+	}
+}
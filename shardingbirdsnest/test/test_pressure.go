@@ -60,24 +60,41 @@ func main() {
 	}
 	heights := make([]uint64, 0, totalHeight)
 	costs := make([]opts.BarData, 0, totalHeight)
+	containsCosts := make([]opts.BarData, 0, totalHeight)
+	var addsTotal, containsTotal time.Duration
 	for i := uint64(0); i < totalHeight; i++ {
 		keys := bn.GetTimestampKeys(blockCap)
+		// block verification checks the txIds before they are added
 		now := time.Now()
+		_, err = sharding.ContainsBatch(keys)
+		if err != nil {
+			log.Errorf("contains batch, error: %v", err)
+			return
+		}
+		containsCost := time.Since(now)
+		now = time.Now()
 		err = sharding.AddsAndSetHeight(keys, i)
 		if err != nil {
 			log.Errorf("adds and set height, error: %v", err)
 			return
 		}
 		cost := time.Since(now)
+		addsTotal += cost
+		containsTotal += containsCost
 		costs = append(costs, opts.BarData{Value: cost.Nanoseconds()})
+		containsCosts = append(containsCosts, opts.BarData{Value: containsCost.Nanoseconds()})
 		heights = append(heights, i)
 	}
+	total := float64(blockCap * totalHeight)
+	fmt.Printf("adds: %.0f keys/s, contains batch: %.0f keys/s\n", total/addsTotal.Seconds(),
+		total/containsTotal.Seconds())
 	//_ = sharding.Serialize()
 	//for _, nest := range sharding.bn {
 	//	_ = nest.(bn.Serializer).Serialize()
 	//}
 	report.Report("Sharding bird's nest after optimization",
-		"", heights, report.Series{Name: "Category A", Data: costs})
+		"", heights, report.Series{Name: "Category A", Data: costs},
+		report.Series{Name: "Contains batch", Data: containsCosts})
 
 }
 
@@ -0,0 +1,150 @@
+package wal
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkpoint file layout: index(8) | checksum(4) | state
+const (
+	checkpointName       = "CHECKPOINT"
+	checkpointHeaderSize = 12
+)
+
+// SaveCheckpoint records that the state of the application is complete
+// through the entry at `index`. The checkpoint file is replaced atomically,
+// only the latest checkpoint is kept. When the CheckpointRetention option is
+// set, segments older than the retained entries are truncated in the
+// background.
+func (l *Log) SaveCheckpoint(index uint64, state []byte) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.corrupt {
+		return ErrCorrupt
+	} else if l.closed {
+		return ErrClosed
+	}
+	if index == 0 || index < l.firstIndex || index > l.lastIndex {
+		return ErrOutOfRange
+	}
+	l.cmu.Lock()
+	err := writeCheckpoint(l.path, index, state)
+	l.cmu.Unlock()
+	if err != nil {
+		return err
+	}
+	if l.ckptC != nil {
+		// keep only the latest pending truncation
+		select {
+		case <-l.ckptC:
+		default:
+		}
+		select {
+		case l.ckptC <- index:
+		default:
+		}
+	}
+	return nil
+}
+
+// LoadCheckpoint returns the index and the state of the latest checkpoint.
+// ErrNotFound is returned when no checkpoint was saved.
+func (l *Log) LoadCheckpoint() (index uint64, state []byte, err error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.corrupt {
+		return 0, nil, ErrCorrupt
+	} else if l.closed {
+		return 0, nil, ErrClosed
+	}
+	l.cmu.Lock()
+	defer l.cmu.Unlock()
+	data, err := ioutil.ReadFile(filepath.Join(l.path, checkpointName))
+	if os.IsNotExist(err) {
+		return 0, nil, ErrNotFound
+	} else if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < checkpointHeaderSize {
+		return 0, nil, ErrCorrupt
+	}
+	state = data[checkpointHeaderSize:]
+	if binary.LittleEndian.Uint32(data[8:12]) != NewCRC(state).Value() {
+		return 0, nil, ErrCorrupt
+	}
+	return binary.LittleEndian.Uint64(data[:8]), state, nil
+}
+
+// writeCheckpoint writes the checkpoint to a temp file and renames it over the
+// previous checkpoint.
+func writeCheckpoint(dir string, index uint64, state []byte) error {
+	data := make([]byte, checkpointHeaderSize, checkpointHeaderSize+len(state))
+	binary.LittleEndian.PutUint64(data[:8], index)
+	binary.LittleEndian.PutUint32(data[8:12], NewCRC(state).Value())
+	data = append(data, state...)
+	tempName := filepath.Join(dir, checkpointName+".TEMP")
+	f, err := os.Create(tempName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tempName, filepath.Join(dir, checkpointName)); err != nil {
+		return err
+	}
+	// sync the directory so the rename survives a crash
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// checkpointLoop truncates the front of the log after checkpoints until the
+// log is closed.
+func (l *Log) checkpointLoop(ckptC <-chan uint64) {
+	for index := range ckptC {
+		// a failed truncation is retried with the next checkpoint
+		_ = l.truncateToCheckpoint(index)
+	}
+}
+
+// truncateToCheckpoint removes the segments that only hold entries older than
+// the retained entries of the checkpoint. The segment holding the first
+// retained entry is kept whole.
+func (l *Log) truncateToCheckpoint(index uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.corrupt {
+		return ErrCorrupt
+	} else if l.closed {
+		return ErrClosed
+	}
+	retention := l.opts.CheckpointRetention
+	if index < retention {
+		return nil
+	}
+	target := index - retention + 1
+	if target > l.lastIndex {
+		target = l.lastIndex
+	}
+	if target <= l.firstIndex {
+		return nil
+	}
+	target = l.segments[l.findSegment(target)].index
+	if target <= l.firstIndex {
+		return nil
+	}
+	return l.truncateFront(target)
+}
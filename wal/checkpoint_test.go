@@ -0,0 +1,93 @@
+package wal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	opts := makeOpts(512, true, Binary)
+	l := testIteratorLog(t, opts, 100)
+
+	if _, _, err := l.LoadCheckpoint(); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	if err := l.SaveCheckpoint(101, nil); err != ErrOutOfRange {
+		t.Fatalf("expected %v, got %v", ErrOutOfRange, err)
+	}
+	if err := l.SaveCheckpoint(50, []byte("state-50")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SaveCheckpoint(80, []byte("state-80")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the latest checkpoint survives a restart, no entry is truncated
+	l, err := Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	index, state, err := l.LoadCheckpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != 80 || string(state) != "state-80" {
+		t.Fatalf("expected %d/%s, got %d/%s", 80, "state-80", index, state)
+	}
+	testFirstLast(t, l, 1, 100, nil)
+
+	// a damaged checkpoint is reported
+	data, err := ioutil.ReadFile("testlog/" + checkpointName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err = ioutil.WriteFile("testlog/"+checkpointName, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = l.LoadCheckpoint(); err != ErrCorrupt {
+		t.Fatalf("expected %v, got %v", ErrCorrupt, err)
+	}
+}
+
+func TestCheckpointRetention(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	opts := makeOpts(512, true, Binary)
+	opts.CheckpointRetention = 10
+	l := testIteratorLog(t, opts, 100)
+	defer l.Close()
+
+	if err := l.SaveCheckpoint(90, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+	// entries 81 through 100 must be kept, whole older segments are removed
+	var first uint64
+	for i := 0; i < 100; i++ {
+		first, _ = l.FirstIndex()
+		if first > 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if first <= 1 || first > 81 {
+		t.Fatalf("expected first index in (1, 81], got %d", first)
+	}
+	l.mu.RLock()
+	segStart := l.segments[0].index
+	l.mu.RUnlock()
+	if segStart != first {
+		t.Fatalf("expected truncation at segment start %d, got %d", segStart, first)
+	}
+	testFirstLast(t, l, first, 100, func(index uint64) []byte {
+		return []byte(dataStr(index))
+	})
+}
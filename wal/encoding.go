@@ -0,0 +1,215 @@
+package wal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"chainmaker.org/chainmaker/common/v2/crypto"
+)
+
+// CodecType identifies the compression codec of the entries in a segment.
+type CodecType byte
+
+const (
+	// NoCompression stores entries as they are written. This is the default.
+	NoCompression CodecType = 0
+	// Gzip compresses every entry with compress/gzip.
+	Gzip CodecType = 1
+	// Snappy is reserved for a snappy codec registered with RegisterCodec.
+	Snappy CodecType = 2
+	// Zstd is reserved for a zstd codec registered with RegisterCodec.
+	Zstd CodecType = 3
+)
+
+// Codec compresses and decompresses the data of single entries.
+type Codec interface {
+	// Encode returns the compressed src.
+	Encode(src []byte) ([]byte, error)
+	// Decode returns the decompressed src.
+	Decode(src []byte) ([]byte, error)
+}
+
+var (
+	// ErrCodecNotFound is returned when a segment or the options use a codec
+	// that was not registered.
+	ErrCodecNotFound = errors.New("codec not found")
+
+	// ErrCipherMismatch is returned when an encrypted segment is read without
+	// a cipher of the type it was written with.
+	ErrCipherMismatch = errors.New("cipher mismatch")
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[CodecType]Codec{
+		Gzip: gzipCodec{},
+	}
+)
+
+// RegisterCodec registers the codec used for segments of the codec type, for
+// example a snappy or zstd implementation. Registering a codec type twice
+// replaces the previous codec.
+func RegisterCodec(t CodecType, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[t] = c
+}
+
+func getCodec(t CodecType) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[t]
+	if !ok {
+		return nil, fmt.Errorf("%w, codec type: %d", ErrCodecNotFound, t)
+	}
+	return c, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// segment header layout: magic(4) | version(1) | format(1) | codec(1) | cipher(1) | crc(4)
+// The crc of the first 8 bytes tells a header from a segment without one whose
+// first entry happens to start with the magic.
+const (
+	segmentHeaderSize    = 12
+	segmentHeaderVersion = 1
+)
+
+var segmentMagic = []byte("CMWL")
+
+// segmentEncoding describes how the entries of a segment are stored. Segments
+// written before encodings existed have no header and use the LogFormat of
+// the options.
+type segmentEncoding struct {
+	header bool      // the segment starts with a header
+	format LogFormat // format of the entries
+	codec  CodecType // compression of the entry data
+	cipher byte      // zero for plain data, crypto.KeyType+1 for encrypted data
+}
+
+// newEncoding returns the encoding of new segments. A header is only written
+// when the data is compressed or encrypted, so plain logs stay compatible with
+// older readers.
+func (l *Log) newEncoding() segmentEncoding {
+	enc := segmentEncoding{format: l.opts.LogFormat, codec: l.opts.Compression}
+	if l.opts.Cipher != nil {
+		enc.cipher = byte(l.opts.Cipher.Type()) + 1
+	}
+	enc.header = enc.codec != NoCompression || enc.cipher != 0
+	return enc
+}
+
+// headerBytes returns the header of the segment, nil when it has none.
+func (enc segmentEncoding) headerBytes() []byte {
+	if !enc.header {
+		return nil
+	}
+	hdr := make([]byte, segmentHeaderSize)
+	copy(hdr, segmentMagic)
+	hdr[4], hdr[5], hdr[6], hdr[7] = segmentHeaderVersion, byte(enc.format), byte(enc.codec), enc.cipher
+	binary.LittleEndian.PutUint32(hdr[8:], NewCRC(hdr[:8]).Value())
+	return hdr
+}
+
+// parseSegmentHeader returns the encoding of the segment data and the size of
+// its header. Segments without a header use the provided format.
+func parseSegmentHeader(data []byte, format LogFormat) (segmentEncoding, int, error) {
+	if len(data) < segmentHeaderSize || !bytes.Equal(data[:len(segmentMagic)], segmentMagic) ||
+		binary.LittleEndian.Uint32(data[8:segmentHeaderSize]) != NewCRC(data[:8]).Value() {
+		return segmentEncoding{format: format}, 0, nil
+	}
+	if data[4] != segmentHeaderVersion {
+		return segmentEncoding{}, 0, ErrCorrupt
+	}
+	enc := segmentEncoding{
+		header: true,
+		format: LogFormat(data[5]),
+		codec:  CodecType(data[6]),
+		cipher: data[7],
+	}
+	if enc.format != Binary && enc.format != JSON {
+		return segmentEncoding{}, 0, ErrCorrupt
+	}
+	return enc, segmentHeaderSize, nil
+}
+
+// encodeData compresses and then encrypts the data of an entry.
+func (l *Log) encodeData(enc segmentEncoding, data []byte) ([]byte, error) {
+	var err error
+	if enc.codec != NoCompression {
+		var c Codec
+		if c, err = getCodec(enc.codec); err != nil {
+			return nil, err
+		}
+		if data, err = c.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+	if enc.cipher != 0 {
+		var key crypto.SymmetricKey
+		if key, err = l.cipherKey(enc); err != nil {
+			return nil, err
+		}
+		if data, err = key.Encrypt(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// decodeData decrypts and then decompresses the data of an entry.
+func (l *Log) decodeData(enc segmentEncoding, data []byte) ([]byte, error) {
+	var err error
+	if enc.cipher != 0 {
+		var key crypto.SymmetricKey
+		if key, err = l.cipherKey(enc); err != nil {
+			return nil, err
+		}
+		if data, err = key.Decrypt(data); err != nil {
+			return nil, err
+		}
+	}
+	if enc.codec != NoCompression {
+		var c Codec
+		if c, err = getCodec(enc.codec); err != nil {
+			return nil, err
+		}
+		if data, err = c.Decode(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (l *Log) cipherKey(enc segmentEncoding) (crypto.SymmetricKey, error) {
+	if l.opts.Cipher == nil || byte(l.opts.Cipher.Type())+1 != enc.cipher {
+		return nil, ErrCipherMismatch
+	}
+	return l.opts.Cipher, nil
+}
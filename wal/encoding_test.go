@@ -0,0 +1,246 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"chainmaker.org/chainmaker/common/v2/crypto/sym/aes"
+	"chainmaker.org/chainmaker/common/v2/crypto/sym/sm4"
+)
+
+var testEncodingData = func(index uint64) []byte {
+	return []byte(strings.Repeat(dataStr(index), 20))
+}
+
+func testWriteEntries(t *testing.T, l *Log, from, to uint64) {
+	t.Helper()
+	for i := from; i <= to; i++ {
+		if err := l.Write(i, testEncodingData(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	aesKey := &aes.AESKey{Key: []byte("0123456789abcdef")}
+	sm4Key := &sm4.SM4Key{Key: []byte("0123456789abcdef")}
+	for _, lf := range []LogFormat{Binary, JSON} {
+		func() {
+			os.RemoveAll("testlog")
+			defer os.RemoveAll("testlog")
+
+			// a directory with plain, compressed, encrypted and compressed and
+			// encrypted segments
+			steps := []*Options{
+				makeOpts(1024, true, lf),
+				makeOpts(1024, true, lf),
+				makeOpts(1024, true, lf),
+				makeOpts(1024, true, lf),
+			}
+			steps[1].Compression = Gzip
+			steps[2].Cipher = aesKey
+			steps[3].Compression = Gzip
+			steps[3].Cipher = sm4Key
+			var last uint64
+			for _, opts := range steps {
+				l, err := Open("testlog", opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				testWriteEntries(t, l, last+1, last+30)
+				for i := last + 1; i <= last+30; i++ {
+					data, err := l.Read(i)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(data, testEncodingData(i)) {
+						t.Fatalf("expected %s, got %s", testEncodingData(i), data)
+					}
+				}
+				last += 30
+				if err = l.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// reading the encrypted segments requires the key of their type
+			opts := makeOpts(1024, true, lf)
+			opts.Cipher = aesKey
+			l, err := Open("testlog", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = l.Read(70); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = l.Read(last); !errors.Is(err, ErrCipherMismatch) {
+				t.Fatalf("expected %v, got %v", ErrCipherMismatch, err)
+			}
+			l.Close()
+
+			// truncating keeps the segment headers
+			opts = steps[3]
+			l, err = Open("testlog", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = l.TruncateFront(last - 5); err != nil {
+				t.Fatal(err)
+			}
+			if err = l.TruncateBack(last - 1); err != nil {
+				t.Fatal(err)
+			}
+			testWriteEntries(t, l, last, last+10)
+			last += 10
+			l.Close()
+			l, err = Open("testlog", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testFirstLast(t, l, last-15, last, testEncodingData)
+			l.Close()
+		}()
+	}
+}
+
+func TestEncodingCompressed(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	opts := makeOpts(1<<20, true, Binary)
+	opts.Compression = Gzip
+	l, err := Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	testWriteEntries(t, l, 1, 10)
+	data, err := ioutil.ReadFile("testlog/" + segmentName(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, segmentMagic) {
+		t.Fatal("expected segment header")
+	}
+	if size := len(testEncodingData(1)) * 10; len(data) >= size {
+		t.Fatalf("expected less than %d bytes, got %d", size, len(data))
+	}
+
+	if _, err = Open("testlog2", &Options{Compression: Zstd}); !errors.Is(err, ErrCodecNotFound) {
+		t.Fatalf("expected %v, got %v", ErrCodecNotFound, err)
+	}
+}
+
+// forgeChecksum appends 4 bytes to data so that its checksum is value.
+func forgeChecksum(data []byte, value uint32) []byte {
+	// undo the mask of CRC.Value() and the final xor of crc32
+	v := value - 0xa282ead8
+	target := ^(v<<15 | v>>17)
+	// the table indexes leading to target, found backwards from the top bytes
+	var idx [4]byte
+	reg := target
+	for k := 3; k >= 0; k-- {
+		for j := 0; j < 256; j++ {
+			if table[j]>>24 == reg>>24 {
+				idx[k] = byte(j)
+				break
+			}
+		}
+		reg = (reg ^ table[idx[k]]) << 8
+	}
+	crc := ^uint32(NewCRC(data))
+	for k := 0; k < 4; k++ {
+		data = append(data, byte(crc)^idx[k])
+		crc = table[idx[k]] ^ crc>>8
+	}
+	return data
+}
+
+func TestEncodingLegacyMagic(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	// a segment without header whose first entry checksum reads as the magic
+	first := forgeChecksum(bytes.Repeat([]byte{'x'}, 63), binary.LittleEndian.Uint32(segmentMagic))
+	l, err := Open("testlog", makeOpts(1<<20, true, Binary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Write(1, first); err != nil {
+		t.Fatal(err)
+	}
+	testWriteEntries(t, l, 2, 10)
+	l.Close()
+	data, err := ioutil.ReadFile("testlog/" + segmentName(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, segmentMagic) {
+		t.Fatal("expected the magic at the start of the segment")
+	}
+
+	l, err = Open("testlog", makeOpts(1<<20, true, Binary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	testFirstLast(t, l, 1, 10, func(index uint64) []byte {
+		if index == 1 {
+			return first
+		}
+		return testEncodingData(index)
+	})
+}
+
+// failCodec fails to encode the data "fail"
+type failCodec struct{}
+
+func (failCodec) Encode(src []byte) ([]byte, error) {
+	if string(src) == "fail" {
+		return nil, errors.New("encode failed")
+	}
+	return src, nil
+}
+
+func (failCodec) Decode(src []byte) ([]byte, error) {
+	return src, nil
+}
+
+func TestEncodingFailedBatch(t *testing.T) {
+	RegisterCodec(CodecType(200), failCodec{})
+	for _, lf := range []LogFormat{Binary, JSON} {
+		func() {
+			os.RemoveAll("testlog")
+			defer os.RemoveAll("testlog")
+			opts := makeOpts(1<<20, true, lf)
+			opts.Compression = CodecType(200)
+			l, err := Open("testlog", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			testWriteEntries(t, l, 1, 10)
+
+			// the entries of a failed batch are dropped
+			var b Batch
+			b.Write(11, []byte("dropped"))
+			b.Write(12, []byte("fail"))
+			if err = l.WriteBatch(&b); err == nil {
+				t.Fatal("expected error")
+			}
+			testWriteEntries(t, l, 11, 12)
+			for i := uint64(1); i <= 12; i++ {
+				data, err := l.Read(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, testEncodingData(i)) {
+					t.Fatalf("expected %s, got %s", testEncodingData(i), data)
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,139 @@
+package wal
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// commitRequest is a single Write() waiting for a group commit.
+type commitRequest struct {
+	index uint64
+	data  []byte
+	done  chan error
+}
+
+// groupWrite queues the entry and waits until it was committed. The first
+// writer that finds no commit in progress becomes the leader and commits
+// groups of queued entries, with one write and one fsync per group, until
+// the queue is drained.
+func (l *Log) groupWrite(index uint64, data []byte) error {
+	req := &commitRequest{index: index, data: data, done: make(chan error, 1)}
+	l.gmu.Lock()
+	if l.gerr != nil {
+		l.gmu.Unlock()
+		return l.gerr
+	}
+	l.gqueue = append(l.gqueue, req)
+	if l.gleader {
+		l.gmu.Unlock()
+		return l.waitCommit(req)
+	}
+	l.gleader = true
+	for len(l.gqueue) > 0 {
+		reqs := l.gqueue
+		l.gqueue = nil
+		l.gmu.Unlock()
+		waiting := l.commitGroup(reqs)
+		l.gmu.Lock()
+		if l.gerr != nil {
+			// the log was closed while committing, the queue was already failed
+			for _, r := range waiting {
+				r.done <- l.gerr
+			}
+			break
+		}
+		if len(waiting) > 0 && len(l.gqueue) == 0 {
+			// the waiting entries can not be committed before the missing
+			// ones arrive, the writer of those becomes the next leader.
+			l.gqueue = waiting
+			break
+		}
+		l.gqueue = append(waiting, l.gqueue...)
+	}
+	l.gleader = false
+	l.gmu.Unlock()
+	return l.waitCommit(req)
+}
+
+// waitCommit waits for the commit of the queued entry. An entry still queued
+// after GroupCommitWait is ahead of the log, it is dequeued and fails with
+// ErrOutOfOrder.
+func (l *Log) waitCommit(req *commitRequest) error {
+	timer := time.NewTimer(l.opts.GroupCommitWait)
+	defer timer.Stop()
+	for {
+		select {
+		case err := <-req.done:
+			return err
+		case <-timer.C:
+		}
+		l.gmu.Lock()
+		for i, r := range l.gqueue {
+			if r == req {
+				l.gqueue = append(l.gqueue[:i], l.gqueue[i+1:]...)
+				l.gmu.Unlock()
+				return fmt.Errorf("%w, index: %d is ahead of the log", ErrOutOfOrder, req.index)
+			}
+		}
+		l.gmu.Unlock()
+		// the entry is being committed by the leader
+		timer.Reset(l.opts.GroupCommitWait)
+	}
+}
+
+// commitGroup writes the consecutive entries following the last index as one
+// batch and acknowledges their writers. Entries ahead of the log are returned
+// to wait for the next group.
+func (l *Log) commitGroup(reqs []*commitRequest) (waiting []*commitRequest) {
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].index < reqs[j].index
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.corrupt || l.closed {
+		err := ErrClosed
+		if l.corrupt {
+			err = ErrCorrupt
+		}
+		for _, r := range reqs {
+			r.done <- err
+		}
+		return nil
+	}
+	l.wbatch.Clear()
+	next := l.lastIndex + 1
+	var batched []*commitRequest
+	for _, r := range reqs {
+		switch {
+		case r.index == next:
+			l.wbatch.Write(r.index, r.data)
+			batched = append(batched, r)
+			next++
+		case r.index < next:
+			r.done <- fmt.Errorf("%w, index: %d and next index: %d", ErrOutOfOrder, r.index, next)
+		default:
+			waiting = append(waiting, r)
+		}
+	}
+	if len(batched) == 0 {
+		return waiting
+	}
+	err := l.writeBatch(&l.wbatch)
+	for _, r := range batched {
+		r.done <- err
+	}
+	return waiting
+}
+
+// failGroup fails all the writes waiting for a group commit, and the ones
+// that follow.
+func (l *Log) failGroup(err error) {
+	l.gmu.Lock()
+	defer l.gmu.Unlock()
+	l.gerr = err
+	for _, r := range l.gqueue {
+		r.done <- err
+	}
+	l.gqueue = nil
+}
@@ -0,0 +1,144 @@
+package wal
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupCommit(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	opts := makeOpts(1024, false, Binary)
+	opts.GroupCommit = true
+	opts.GroupCommitWait = 5 * time.Second
+	l, err := Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 20 writers take indexes from a shared counter, so they may queue their
+	// entries out of order.
+	var index uint64
+	var wg sync.WaitGroup
+	errC := make(chan error, 1000)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				idx := atomic.AddUint64(&index, 1)
+				if err := l.Write(idx, []byte(dataStr(idx))); err != nil {
+					errC <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errC)
+	for err = range errC {
+		t.Fatal(err)
+	}
+	testFirstLast(t, l, 1, 1000, func(index uint64) []byte {
+		return []byte(dataStr(index))
+	})
+
+	// stale index
+	err = l.Write(10, []byte(dataStr(10)))
+	if !errors.Is(err, ErrOutOfOrder) {
+		t.Fatalf("expected %v, got %v", ErrOutOfOrder, err)
+	}
+
+	// an entry ahead of the log waits until the missing one is written
+	doneC := make(chan error, 1)
+	go func() {
+		doneC <- l.Write(1002, []byte(dataStr(1002)))
+	}()
+	if err = l.Write(1001, []byte(dataStr(1001))); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-doneC; err != nil {
+		t.Fatal(err)
+	}
+
+	// a waiting entry fails when the log is closed
+	go func() {
+		doneC <- l.Write(1010, []byte(dataStr(1010)))
+	}()
+	for {
+		l.gmu.Lock()
+		n := len(l.gqueue)
+		l.gmu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-doneC; err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+
+	// reopen and check durability
+	l, err = Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	testFirstLast(t, l, 1, 1002, func(index uint64) []byte {
+		return []byte(dataStr(index))
+	})
+}
+
+func TestGroupCommitGap(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	opts := makeOpts(1024, true, Binary)
+	opts.GroupCommit = true
+	opts.GroupCommitWait = 10 * time.Millisecond
+	l, err := Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Write(1, []byte(dataStr(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	// an entry whose missing ones never arrive fails
+	err = l.Write(3, []byte(dataStr(3)))
+	if !errors.Is(err, ErrOutOfOrder) {
+		t.Fatalf("expected %v, got %v", ErrOutOfOrder, err)
+	}
+	if err = l.Write(2, []byte(dataStr(2))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writers ahead of the log return when it is closed under them
+	doneC := make(chan error, 2)
+	go func() {
+		doneC <- l.Write(4, []byte(dataStr(4)))
+	}()
+	go func() {
+		doneC <- l.Write(10, []byte(dataStr(10)))
+	}()
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err = <-doneC:
+			if err != nil && err != ErrClosed && !errors.Is(err, ErrOutOfOrder) {
+				t.Fatalf("expected %v or %v, got %v", ErrClosed, ErrOutOfOrder, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("write blocked after close")
+		}
+	}
+	if err = l.Write(11, []byte(dataStr(11))); err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+}
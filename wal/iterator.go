@@ -0,0 +1,160 @@
+package wal
+
+import (
+	"fmt"
+)
+
+// CorruptError is returned when an entry fails its checksum or cannot be
+// decoded. It matches ErrCorrupt with errors.Is.
+type CorruptError struct {
+	Index uint64 // index of the first entry that failed to decode
+}
+
+// Error implements the error interface.
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("%s at index %d", ErrCorrupt.Error(), e.Index)
+}
+
+// Unwrap returns ErrCorrupt.
+func (e *CorruptError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// Iterator walks the entries of a log in index order. The log lock is only
+// held while the next segment is looked up, so writers are not blocked while
+// the entries of a segment are decoded. An Iterator is not safe for
+// concurrent use.
+type Iterator struct {
+	l     *Log
+	next  uint64          // index of the next entry to return
+	to    uint64          // last index to return, zero means the end of the log
+	enc   segmentEncoding // encoding of the current segment
+	ebuf  []byte          // entries buffer of the current segment
+	epos  []bpos          // positions of the remaining entries of the current segment
+	index uint64          // index of the current entry
+	data  []byte          // data of the current entry
+	err   error
+}
+
+// Iterator returns an iterator over the entries from index `from` through
+// index `to`. A `to` of zero iterates through the last entry of the log,
+// including entries written while iterating.
+func (l *Log) Iterator(from, to uint64) (*Iterator, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.corrupt {
+		return nil, ErrCorrupt
+	} else if l.closed {
+		return nil, ErrClosed
+	}
+	if from == 0 || from < l.firstIndex || from > l.lastIndex {
+		return nil, ErrNotFound
+	}
+	if to != 0 && to < from {
+		return nil, ErrOutOfRange
+	}
+	return &Iterator{l: l, next: from, to: to}, nil
+}
+
+// Scan calls fn for every entry from index `from` through the last entry of
+// the log. Scanning stops early when fn returns false. The data passed to fn
+// follows the NoCopy option, the same as Read.
+func (l *Log) Scan(from uint64, fn func(index uint64, data []byte) bool) error {
+	it, err := l.Iterator(from, 0)
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		if !fn(it.Index(), it.Data()) {
+			break
+		}
+	}
+	return it.Err()
+}
+
+// Next advances the iterator to the next entry. It returns false when the
+// iteration is finished or an error occurred, see Err.
+func (it *Iterator) Next() bool {
+	if it.err != nil || (it.to != 0 && it.next > it.to) {
+		return false
+	}
+	if len(it.epos) == 0 && !it.fill() {
+		return false
+	}
+	epos := it.epos[0]
+	data, err := it.l.readEntry(it.enc, it.ebuf[epos.pos:epos.end])
+	if err != nil {
+		it.err = &CorruptError{Index: it.next}
+		return false
+	}
+	it.index = it.next
+	it.data = data
+	it.epos = it.epos[1:]
+	it.next++
+	return true
+}
+
+// fill loads the entries of the segment that holds the next index.
+func (it *Iterator) fill() bool {
+	l := it.l
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.corrupt {
+		it.err = ErrCorrupt
+		return false
+	} else if l.closed {
+		it.err = ErrClosed
+		return false
+	}
+	if it.next > l.lastIndex {
+		return false
+	}
+	if it.next < l.firstIndex {
+		// the front of the log was truncated while iterating
+		it.err = ErrNotFound
+		return false
+	}
+	s, err := l.loadSegment(it.next)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	last := s.index + uint64(len(s.epos)) - 1
+	if it.to != 0 && last > it.to {
+		last = it.to
+	}
+	it.enc = s.enc
+	epos := s.epos[it.next-s.index : last-s.index+1]
+	if s != l.segments[len(l.segments)-1] {
+		// the buffers of the sealed segments are never modified, so their
+		// slices stay valid after the lock is released.
+		it.ebuf = s.ebuf[:len(s.ebuf):len(s.ebuf)]
+		it.epos = epos[:len(epos):len(epos)]
+		return true
+	}
+	// the buffer of the tail segment is rewritten by TruncateBack and by the
+	// writes that follow it, so its entries are copied.
+	start := epos[0].pos
+	it.ebuf = append([]byte(nil), s.ebuf[start:epos[len(epos)-1].end]...)
+	it.epos = make([]bpos, len(epos))
+	for i, p := range epos {
+		it.epos[i] = bpos{p.pos - start, p.end - start}
+	}
+	return true
+}
+
+// Index returns the index of the current entry.
+func (it *Iterator) Index() uint64 {
+	return it.index
+}
+
+// Data returns the data of the current entry. When the NoCopy option is set
+// the returned slice must not be modified.
+func (it *Iterator) Data() []byte {
+	return it.data
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,208 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testIteratorLog(t *testing.T, opts *Options, n int) *Log {
+	t.Helper()
+	l, err := Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		if err = l.Write(uint64(i), []byte(dataStr(uint64(i)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l
+}
+
+func TestIterator(t *testing.T) {
+	for _, lf := range []LogFormat{Binary, JSON} {
+		func() {
+			os.RemoveAll("testlog")
+			defer os.RemoveAll("testlog")
+			l := testIteratorLog(t, makeOpts(512, true, lf), 100)
+			defer l.Close()
+
+			// full range through several segments
+			it, err := l.Iterator(1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect := uint64(1)
+			for it.Next() {
+				if it.Index() != expect {
+					t.Fatalf("expected index %d, got %d", expect, it.Index())
+				}
+				if string(it.Data()) != dataStr(expect) {
+					t.Fatalf("expected %s, got %s", dataStr(expect), it.Data())
+				}
+				expect++
+			}
+			if it.Err() != nil {
+				t.Fatal(it.Err())
+			}
+			if expect != 101 {
+				t.Fatalf("expected %d entries, got %d", 100, expect-1)
+			}
+
+			// bounded range
+			it, err = l.Iterator(30, 60)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := 0
+			for it.Next() {
+				count++
+			}
+			if count != 31 {
+				t.Fatalf("expected %d entries, got %d", 31, count)
+			}
+
+			// invalid ranges
+			if _, err = l.Iterator(0, 0); err != ErrNotFound {
+				t.Fatalf("expected %v, got %v", ErrNotFound, err)
+			}
+			if _, err = l.Iterator(101, 0); err != ErrNotFound {
+				t.Fatalf("expected %v, got %v", ErrNotFound, err)
+			}
+			if _, err = l.Iterator(10, 5); err != ErrOutOfRange {
+				t.Fatalf("expected %v, got %v", ErrOutOfRange, err)
+			}
+		}()
+	}
+}
+
+func TestScan(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	l := testIteratorLog(t, makeOpts(512, true, Binary), 50)
+	defer l.Close()
+
+	var last uint64
+	err := l.Scan(10, func(index uint64, data []byte) bool {
+		last = index
+		return index < 20
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != 20 {
+		t.Fatalf("expected %d, got %d", 20, last)
+	}
+
+	// entries written while scanning are visited too
+	last = 0
+	err = l.Scan(45, func(index uint64, data []byte) bool {
+		if index == 50 {
+			if err := l.Write(51, []byte(dataStr(51))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		last = index
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != 51 {
+		t.Fatalf("expected %d, got %d", 51, last)
+	}
+}
+
+func TestIteratorTruncateBack(t *testing.T) {
+	for _, lf := range []LogFormat{Binary, JSON} {
+		func() {
+			os.RemoveAll("testlog")
+			defer os.RemoveAll("testlog")
+			l := testIteratorLog(t, makeOpts(1024*1024, true, lf), 100)
+			defer l.Close()
+
+			it, err := l.Iterator(1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 10; i++ {
+				it.Next()
+			}
+
+			// the entries loaded by the iterator are not overwritten by the
+			// writes that follow a truncation of the tail segment
+			if err = l.TruncateBack(50); err != nil {
+				t.Fatal(err)
+			}
+			for i := uint64(51); i <= 100; i++ {
+				if err = l.Write(i, []byte(fmt.Sprintf("rewritten-%d", i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expect := uint64(11)
+			for it.Next() {
+				if it.Index() != expect {
+					t.Fatalf("expected index %d, got %d", expect, it.Index())
+				}
+				if string(it.Data()) != dataStr(expect) {
+					t.Fatalf("expected %s, got %s", dataStr(expect), it.Data())
+				}
+				expect++
+			}
+			if it.Err() != nil {
+				t.Fatal(it.Err())
+			}
+			if expect != 101 {
+				t.Fatalf("expected %d entries, got %d", 100, expect-1)
+			}
+		}()
+	}
+}
+
+func TestIteratorCorrupt(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	opts := makeOpts(512, true, Binary)
+	l := testIteratorLog(t, opts, 100)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a byte of the second entry of the first segment
+	path := "testlog/" + segmentName(1)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n1, err := loadNextBinaryEntry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2, err := loadNextBinaryEntry(data[n1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[n1+n2-1] ^= 0xff
+	if err = ioutil.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	err = l.Scan(1, func(index uint64, data []byte) bool {
+		return true
+	})
+	var cerr *CorruptError
+	if !errors.As(err, &cerr) || !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected %v, got %v", ErrCorrupt, err)
+	}
+	if cerr.Index != 2 {
+		t.Fatalf("expected corrupt index %d, got %d", 2, cerr.Index)
+	}
+}
@@ -0,0 +1,202 @@
+package wal
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// VerifyReport is the result of verifying the segments of a log.
+type VerifyReport struct {
+	Segments   int    // number of segment files
+	FirstIndex uint64 // index of the first entry
+	LastIndex  uint64 // index of the last good entry, FirstIndex-1 when there is none
+	Corrupt    bool   // a bad entry or a gap between segments was found
+	BadIndex   uint64 // index of the first bad or missing entry
+	BadSegment string // path of the segment holding the first bad entry
+	BadOffset  int64  // byte offset of the first bad entry in BadSegment
+
+	badSeg int  // position of BadSegment in the segment list
+	gap    bool // BadSegment does not start at BadIndex
+}
+
+// String returns a short description of the report.
+func (r *VerifyReport) String() string {
+	if !r.Corrupt {
+		return fmt.Sprintf("ok, segments: %d, first index: %d, last index: %d",
+			r.Segments, r.FirstIndex, r.LastIndex)
+	}
+	return fmt.Sprintf("corrupt, segments: %d, first index: %d, last good index: %d, "+
+		"bad index: %d, bad segment: %s, bad offset: %d",
+		r.Segments, r.FirstIndex, r.LastIndex, r.BadIndex, r.BadSegment, r.BadOffset)
+}
+
+// Verify scans every segment of the log at path and checks the checksum of
+// every entry, without opening the log. Segments without a header are read
+// with the LogFormat of the options. The log must not be written while it is
+// verified. Truncations that were interrupted (START and END files) are
+// completed by Open and are not verified.
+func Verify(path string, opts *Options) (*VerifyReport, error) {
+	if opts == nil {
+		opts = DefaultOptions
+	}
+	segs, err := listSegments(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{Segments: len(segs)}
+	if len(segs) == 0 {
+		return report, nil
+	}
+	report.FirstIndex = segs[0].index
+	next := segs[0].index
+	for i, s := range segs {
+		if s.index != next {
+			report.setBad(i, s.path, next, 0)
+			report.gap = true
+			break
+		}
+		n, offset, err := verifySegment(s.path, opts.LogFormat)
+		next += uint64(n)
+		if err == ErrCorrupt {
+			report.setBad(i, s.path, next, offset)
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	report.LastIndex = next - 1
+	return report, nil
+}
+
+func (r *VerifyReport) setBad(segIdx int, path string, index uint64, offset int64) {
+	r.Corrupt = true
+	r.BadIndex = index
+	r.BadSegment = path
+	r.BadOffset = offset
+	r.badSeg = segIdx
+}
+
+// Repair truncates the log at path after the last good entry found by Verify.
+// The original files of every segment that is truncated or removed are
+// copied into the backup directory first. The log must not be open while it
+// is repaired.
+func Repair(path, backup string, opts *Options) (*VerifyReport, error) {
+	report, err := Verify(path, opts)
+	if err != nil || !report.Corrupt {
+		return report, err
+	}
+	segs, err := listSegments(path)
+	if err != nil {
+		return nil, err
+	}
+	segs = segs[report.badSeg:]
+	if err = os.MkdirAll(backup, 0777); err != nil {
+		return nil, err
+	}
+	for _, s := range segs {
+		if err = copyFile(s.path, filepath.Join(backup, filepath.Base(s.path))); err != nil {
+			return nil, err
+		}
+	}
+	if report.gap {
+		if err = os.Remove(segs[0].path); err != nil {
+			return nil, err
+		}
+	} else if err = truncateFile(segs[0].path, report.BadOffset); err != nil {
+		return nil, err
+	}
+	for _, s := range segs[1:] {
+		if err = os.Remove(s.path); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// listSegments returns the segments of the log at path in index order.
+func listSegments(path string) ([]*segment, error) {
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var segs []*segment
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || len(name) != 20 {
+			continue
+		}
+		index, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || index == 0 {
+			continue
+		}
+		segs = append(segs, &segment{index: index, path: filepath.Join(path, name)})
+	}
+	return segs, nil
+}
+
+// verifySegment returns the number of good entries in the segment file and
+// the offset following the last good entry. ErrCorrupt is returned when the
+// segment holds a bad entry.
+func verifySegment(path string, format LogFormat) (n int, offset int64, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	enc, pos, err := parseSegmentHeader(data, format)
+	if err != nil {
+		return 0, 0, err
+	}
+	for pos < len(data) {
+		var size int
+		if enc.format == JSON {
+			size, err = verifyNextJSONEntry(data[pos:])
+		} else {
+			size, err = loadNextBinaryEntry(data[pos:])
+		}
+		if err != nil {
+			return n, int64(pos), ErrCorrupt
+		}
+		pos += size
+		n++
+	}
+	return n, int64(pos), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func truncateFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = f.Truncate(size); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,123 @@
+package wal
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	os.RemoveAll("testlog-backup")
+	defer os.RemoveAll("testlog-backup")
+	opts := makeOpts(512, true, Binary)
+	l := testIteratorLog(t, opts, 100)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Verify("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Corrupt || report.FirstIndex != 1 || report.LastIndex != 100 || report.Segments < 3 {
+		t.Fatalf("unexpected report: %v", report)
+	}
+
+	// corrupt the third entry of the second segment
+	segs, err := listSegments("testlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := segs[1]
+	data, err := ioutil.ReadFile(bad.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offset int
+	for i := 0; i < 2; i++ {
+		n, err := loadNextBinaryEntry(data[offset:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset += n
+	}
+	data[offset] ^= 0xff
+	if err = ioutil.WriteFile(bad.path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Verify("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Corrupt || report.BadIndex != bad.index+2 || report.LastIndex != bad.index+1 ||
+		report.BadSegment != bad.path || report.BadOffset != int64(offset) {
+		t.Fatalf("unexpected report: %v", report)
+	}
+
+	// repair keeps the good entries and backs up the removed ones
+	if _, err = Repair("testlog", "testlog-backup", opts); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ioutil.ReadFile("testlog-backup/" + segmentName(bad.index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != string(data) {
+		t.Fatal("backup mismatch")
+	}
+	report, err = Verify("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Corrupt || report.LastIndex != bad.index+1 {
+		t.Fatalf("unexpected report: %v", report)
+	}
+	l, err = Open("testlog", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	testFirstLast(t, l, 1, bad.index+1, func(index uint64) []byte {
+		return []byte(dataStr(index))
+	})
+	if err = l.Write(bad.index+2, []byte(dataStr(bad.index+2))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyGap(t *testing.T) {
+	os.RemoveAll("testlog")
+	defer os.RemoveAll("testlog")
+	os.RemoveAll("testlog-backup")
+	defer os.RemoveAll("testlog-backup")
+	opts := makeOpts(512, true, JSON)
+	l := testIteratorLog(t, opts, 100)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segs, err := listSegments("testlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(segs[1].path); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Repair("testlog", "testlog-backup", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Corrupt || report.BadIndex != segs[1].index || report.BadSegment != segs[2].path {
+		t.Fatalf("unexpected report: %v", report)
+	}
+	remain, err := listSegments("testlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remain) != 1 {
+		t.Fatalf("expected %d segments, got %d", 1, len(remain))
+	}
+}
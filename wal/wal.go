@@ -13,9 +13,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 	"unsafe"
 
+	"chainmaker.org/chainmaker/common/v2/crypto"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/tinylru"
 )
@@ -76,6 +78,29 @@ type Options struct {
 	// option is set, do not modify the returned data because it may affect
 	// other Read calls. Default false
 	NoCopy bool
+	// Customize part start
+	// GroupCommit merges concurrent Write() calls into a single batch that is
+	// written and synced once. Each Write() still returns only after its own
+	// entry is written (and synced unless NoSync is set). A Write() whose
+	// index is ahead of the log waits up to GroupCommitWait for the missing
+	// entries before failing with ErrOutOfOrder. Default false
+	GroupCommit bool
+	// GroupCommitWait is how long a group committed Write() waits for the
+	// entries missing before its index. Default 100 ms
+	GroupCommitWait time.Duration
+	// Compression of the entry data in new segments. Gzip is built in, other
+	// codecs must be registered with RegisterCodec. Default NoCompression
+	Compression CodecType
+	// Cipher encrypts the entry data in new segments when set. Encrypted
+	// segments can only be read with a key of the same type. Default nil
+	Cipher crypto.SymmetricKey
+	// CheckpointRetention is the number of entries up to and including the
+	// index of a checkpoint that are kept when SaveCheckpoint() is called.
+	// Older segments are truncated in the background. The segment holding
+	// the first retained entry is kept whole, so up to SegmentSize bytes of
+	// older entries remain. Default 0, which disables automatic truncation
+	CheckpointRetention uint64
+	// Customize part end
 }
 
 // DefaultOptions for Open().
@@ -85,6 +110,9 @@ var DefaultOptions = &Options{
 	LogFormat:        Binary,   // Binary format is small and fast.
 	SegmentCacheSize: 2,        // Number of cached in-memory segments
 	NoCopy:           false,    // Make a new copy of data for every Read call.
+	GroupCommit:      false,    // Every Write call is committed on its own.
+	GroupCommitWait:  100 * time.Millisecond,
+	Compression:      NoCompression,
 }
 
 // Log represents a write ahead log
@@ -100,6 +128,14 @@ type Log struct {
 	sfile      *os.File    // tail segment file handle
 	wbatch     Batch       // reusable write batch
 	scache     tinylru.LRU // segment entries cache
+	// Customize part start
+	gmu     sync.Mutex       // protects the group commit state
+	gqueue  []*commitRequest // writes waiting for the next group commit
+	gleader bool             // a writer is committing groups
+	gerr    error            // error of the writes once the log is closed
+	cmu     sync.Mutex       // serializes checkpoint file access
+	ckptC   chan uint64      // checkpoint indexes for background truncation
+	// Customize part end
 }
 
 // segment represents a single segment file.
@@ -108,6 +144,9 @@ type segment struct {
 	index uint64 // first index of segment
 	ebuf  []byte // cached entries buffer, storage format of one log entry: checksum|data_size|data
 	epos  []bpos // cached entries positions in buffer
+	// Customize part start
+	enc segmentEncoding // encoding of the entries, known once they are loaded
+	// Customize part end
 }
 
 type bpos struct {
@@ -126,6 +165,16 @@ func Open(path string, opts *Options) (*Log, error) {
 	if opts.SegmentSize <= 0 {
 		opts.SegmentSize = DefaultOptions.SegmentSize
 	}
+	// Customize part start
+	if opts.GroupCommitWait <= 0 {
+		opts.GroupCommitWait = DefaultOptions.GroupCommitWait
+	}
+	if opts.Compression != NoCompression {
+		if _, err := getCodec(opts.Compression); err != nil {
+			return nil, err
+		}
+	}
+	// Customize part end
 	var err error
 	path, err = abs(path)
 	if err != nil {
@@ -139,6 +188,12 @@ func Open(path string, opts *Options) (*Log, error) {
 	if err := l.load(); err != nil {
 		return nil, err
 	}
+	// Customize part start
+	if l.opts.CheckpointRetention > 0 {
+		l.ckptC = make(chan uint64, 1)
+		go l.checkpointLoop(l.ckptC)
+	}
+	// Customize part end
 	return l, nil
 }
 
@@ -203,8 +258,9 @@ func (l *Log) load() error {
 		})
 		l.firstIndex = 1
 		l.lastIndex = 0
-		l.sfile, err = os.Create(l.segments[0].path)
-		return err
+		// Customize part start
+		return l.createSegmentFile(l.segments[0])
+		// Customize part end
 	}
 	// Open existing log. Clean up log if START of END segments exists.
 	if startIdx != -1 {
@@ -297,6 +353,12 @@ func (l *Log) Close() error {
 		return err
 	}
 	l.closed = true
+	// Customize part start
+	l.failGroup(ErrClosed)
+	if l.ckptC != nil {
+		close(l.ckptC)
+	}
+	// Customize part end
 	if l.corrupt {
 		return ErrCorrupt
 	}
@@ -305,6 +367,11 @@ func (l *Log) Close() error {
 
 // Write an entry to the log.
 func (l *Log) Write(index uint64, data []byte) error {
+	// Customize part start
+	if l.opts.GroupCommit {
+		return l.groupWrite(index, data)
+	}
+	// Customize part end
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if l.corrupt {
@@ -317,9 +384,11 @@ func (l *Log) Write(index uint64, data []byte) error {
 	return l.writeBatch(&l.wbatch)
 }
 
-func (l *Log) appendEntry(dst []byte, index uint64, data []byte) (out []byte,
+// Customize part start
+func (l *Log) appendEntry(s *segment, dst []byte, index uint64, data []byte) (out []byte,
 	epos bpos) {
-	if l.opts.LogFormat == JSON {
+	if s.enc.format == JSON {
+		// Customize part end
 		return appendJSONEntry(dst, index, data)
 	}
 	return appendBinaryEntry(dst, data)
@@ -339,15 +408,51 @@ func (l *Log) cycle() error {
 		index: l.lastIndex + 1,
 		path:  filepath.Join(l.path, segmentName(l.lastIndex+1)),
 	}
+	// Customize part start
+	if err := l.createSegmentFile(s); err != nil {
+		return err
+	}
+	// Customize part end
+	l.segments = append(l.segments, s)
+	return nil
+}
+
+// Customize part start
+
+// cycleEncoding starts a tail segment with the encoding of the options. An
+// empty tail segment is recreated instead because the new segment would share
+// its first index.
+func (l *Log) cycleEncoding(s *segment) error {
+	if len(s.epos) > 0 {
+		return l.cycle()
+	}
+	if err := l.sfile.Close(); err != nil {
+		return err
+	}
+	s.ebuf = nil
+	return l.createSegmentFile(s)
+}
+
+// createSegmentFile creates the file of a new tail segment and writes the
+// segment header for the encoding of the options.
+func (l *Log) createSegmentFile(s *segment) error {
 	var err error
 	l.sfile, err = os.Create(s.path)
 	if err != nil {
 		return err
 	}
-	l.segments = append(l.segments, s)
+	s.enc = l.newEncoding()
+	if hdr := s.enc.headerBytes(); hdr != nil {
+		if _, err = l.sfile.Write(hdr); err != nil {
+			return err
+		}
+		s.ebuf = hdr
+	}
 	return nil
 }
 
+// Customize part end
+
 func appendJSONEntry(dst []byte, index uint64, data []byte) (out []byte,
 	epos bpos) {
 	// {"index":number,"checksum":checksum,"data":string}
@@ -451,6 +556,15 @@ func (l *Log) writeBatch(b *Batch) error {
 	}
 	// load the tail segment
 	s := l.segments[len(l.segments)-1]
+	// Customize part start
+	// entries are only appended to a segment of the current encoding
+	if s.enc != l.newEncoding() {
+		if err := l.cycleEncoding(s); err != nil {
+			return err
+		}
+		s = l.segments[len(l.segments)-1]
+	}
+	// Customize part end
 	if len(s.ebuf) > l.opts.SegmentSize {
 		// tail segment has reached capacity. Close it and create a new one.
 		if err := l.cycle(); err != nil {
@@ -460,11 +574,23 @@ func (l *Log) writeBatch(b *Batch) error {
 	}
 
 	mark := len(s.ebuf)
+	// Customize part start
+	emark := len(s.epos)
+	// Customize part end
 	datas := b.datas
 	for i := 0; i < len(b.entries); i++ {
 		data := datas[:b.entries[i].size]
+		// Customize part start
+		data, err := l.encodeData(s.enc, data)
+		if err != nil {
+			// drop the entries of the batch that were not written
+			s.ebuf = s.ebuf[:mark]
+			s.epos = s.epos[:emark]
+			return err
+		}
 		var epos bpos
-		s.ebuf, epos = l.appendEntry(s.ebuf, b.entries[i].index, data)
+		s.ebuf, epos = l.appendEntry(s, s.ebuf, b.entries[i].index, data)
+		// Customize part end
 		s.epos = append(s.epos, epos)
 		if len(s.ebuf) >= l.opts.SegmentSize {
 			// segment has reached capacity, cycle now
@@ -476,7 +602,11 @@ func (l *Log) writeBatch(b *Batch) error {
 				return err
 			}
 			s = l.segments[len(l.segments)-1]
-			mark = 0
+			// Customize part start
+			// the header of the new segment is already written
+			mark = len(s.ebuf)
+			emark = len(s.epos)
+			// Customize part end
 		}
 		datas = datas[b.entries[i].size:]
 	}
@@ -552,15 +682,25 @@ func (l *Log) loadSegmentEntries(s *segment) error {
 	ebuf := data
 	var epos []bpos
 	var pos int
+	// Customize part start
+	enc, pos, err := parseSegmentHeader(data, l.opts.LogFormat)
+	if err != nil {
+		return err
+	}
+	s.enc = enc
+	data = data[pos:]
+	// Customize part end
 	for exidx := s.index; len(data) > 0; exidx++ {
 		var n int
-		if l.opts.LogFormat == JSON {
+		if enc.format == JSON {
 			n, err = loadNextJSONEntry(data)
 		} else {
 			n, err = loadNextBinaryEntry(data)
 		}
 		if err != nil {
-			return err
+			// Customize part start
+			return &CorruptError{Index: exidx}
+			// Customize part end
 		}
 		data = data[n:]
 		epos = append(epos, bpos{pos, pos + n})
@@ -580,9 +720,17 @@ func (l *Log) loadSegmentEntriesForRestarting(s *segment) error {
 	ebuf := data
 	var epos []bpos
 	var pos int
+	// Customize part start
+	enc, pos, err := parseSegmentHeader(data, l.opts.LogFormat)
+	if err != nil {
+		return err
+	}
+	s.enc = enc
+	data = data[pos:]
+	// Customize part end
 	for exidx := s.index; len(data) > 0; exidx++ {
 		var n int
-		if l.opts.LogFormat == JSON {
+		if enc.format == JSON {
 			n, err = loadNextJSONEntry(data)
 		} else {
 			n, err = loadNextBinaryEntry(data)
@@ -608,24 +756,40 @@ func loadNextJSONEntry(data []byte) (n int, err error) {
 		return 0, ErrCorrupt
 	}
 	line := data[:idx]
-	dres := gjson.Get(*(*string)(unsafe.Pointer(&line)), "data")
-	if dres.Type != gjson.String {
+	// Customize part start
+	// only the index is parsed, the data is decoded and its checksum verified
+	// when it is read
+	ires := gjson.Get(*(*string)(unsafe.Pointer(&line)), "index")
+	if _, err = strconv.ParseUint(ires.String(), 10, 64); err != nil {
 		return 0, ErrCorrupt
 	}
-	// Customize part start
-	// verify checksum
-	cs := gjson.Get(*(*string)(unsafe.Pointer(&line)), "checksum").String()
 	// Customize part end
-	dt := gjson.Get(*(*string)(unsafe.Pointer(&line)), "data").String()
-	if cs != strconv.FormatUint(uint64(NewCRC([]byte(dt[1:])).Value()), 10) {
+	return idx + 1, nil
+}
+
+// Customize part start
+
+// verifyNextJSONEntry is loadNextJSONEntry that also verifies the checksum of
+// the entry data
+func verifyNextJSONEntry(data []byte) (n int, err error) {
+	if n, err = loadNextJSONEntry(data); err != nil {
+		return 0, err
+	}
+	if _, err = readJSON(data[:n-1]); err != nil {
 		return 0, ErrCorrupt
 	}
-	return idx + 1, nil
+	return n, nil
 }
 
+// Customize part end
+
 func loadNextBinaryEntry(data []byte) (n int, err error) {
 	// Customize part start
 	// checksum + data_size + data
+	// a partially written entry may be shorter than the checksum
+	if len(data) < 4 {
+		return 0, ErrCorrupt
+	}
 	// checksum read
 	checksum := binary.LittleEndian.Uint32(data[:4])
 	// binary read
@@ -699,10 +863,29 @@ func (l *Log) Read(index uint64) (data []byte, err error) {
 		return nil, err
 	}
 	epos := s.epos[index-s.index]
-	edata := s.ebuf[epos.pos:epos.end]
-	if l.opts.LogFormat == JSON {
-		return readJSON(edata)
+	// Customize part start
+	return l.readEntry(s.enc, s.ebuf[epos.pos:epos.end])
+	// Customize part end
+}
+
+// Customize part start
+
+// readEntry decodes a single stored entry, verifies its checksum and decodes
+// the data with the encoding of its segment.
+func (l *Log) readEntry(enc segmentEncoding, edata []byte) (data []byte, err error) {
+	if enc.format == JSON {
+		data, err = readJSON(edata)
+	} else {
+		data, err = l.readBinary(edata)
 	}
+	if err != nil || (enc.codec == NoCompression && enc.cipher == 0) {
+		return data, err
+	}
+	return l.decodeData(enc, data)
+}
+
+func (l *Log) readBinary(edata []byte) (data []byte, err error) {
+	// Customize part end
 	// Customize part start
 	// checksum read
 	checksum := binary.LittleEndian.Uint32(edata[:4])
@@ -819,6 +1002,10 @@ func (l *Log) truncateFront(index uint64) (err error) {
 	}
 	epos := s.epos[index-s.index:]
 	ebuf := s.ebuf[epos[0].pos:]
+	// Customize part start
+	// the truncated segment keeps its header
+	hdr := s.enc.headerBytes()
+	// Customize part end
 	// Create a temp file contains the truncated segment.
 	tempName := filepath.Join(l.path, "TEMP")
 	err = func() error {
@@ -828,6 +1015,11 @@ func (l *Log) truncateFront(index uint64) (err error) {
 			return err
 		}
 		defer f.Close()
+		// Customize part start
+		if _, err = f.Write(hdr); err != nil {
+			return err
+		}
+		// Customize part end
 		if _, err = f.Write(ebuf); err != nil {
 			return err
 		}
@@ -880,7 +1072,9 @@ func (l *Log) truncateFront(index uint64) (err error) {
 		if n, err = l.sfile.Seek(0, 2); err != nil {
 			return err
 		}
-		if n != int64(len(ebuf)) {
+		// Customize part start
+		if n != int64(len(hdr)+len(ebuf)) {
+			// Customize part end
 			err = errors.New("invalid seek")
 			return err
 		}